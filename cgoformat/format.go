@@ -0,0 +1,356 @@
+// Package cgoformat: Clang-Format engine for C code in cgo preambles
+// Locates the comment directly above import "C" in Go files with go/parser
+// Formats the C content through clangformat and rewrites only the comment block
+// Keeps the rest of the Go file byte-for-byte unchanged, including #cgo directives
+//
+// cgoformat: cgo 前导注释中 C 代码的 Clang-Format 引擎
+// 使用 go/parser 定位 Go 文件中紧邻 import "C" 上方的注释
+// 通过 clangformat 格式化其中的 C 内容，只重写该注释块
+// 保持 Go 文件其余部分逐字节不变，包括 #cgo 指令
+package cgoformat
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/osexistpath/osmustexist"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// clangFormatOff and clangFormatOn protect #cgo directive lines from clang-format
+// clangFormatOff 和 clangFormatOn 保护 #cgo 指令行不被 clang-format 修改
+const (
+	clangFormatOff = "// clang-format off"
+	clangFormatOn  = "// clang-format on"
+)
+
+// NewStyle creates the Style used on cgo preambles
+// Returns Google-based style with 2-space indentation, matching clangformat defaults
+//
+// NewStyle 创建用于 cgo 前导注释的样式
+// 返回基于 Google 的 2 空格缩进样式，与 clangformat 默认值一致
+func NewStyle() *clangformat.Style {
+	return clangformat.NewStyle()
+}
+
+// Formatter formats the cgo preambles with the clangformat.Options running clang-format and writing the files
+// The package-level functions use NewFormatter(), set the Options to format with the settings of a run
+//
+// Formatter 使用运行 clang-format 和写入文件的 clangformat.Options 格式化cgo 前导注释
+// 包级函数使用 NewFormatter()，设置 Options 即可使用一次运行的设置进行格式化
+type Formatter struct {
+	options *clangformat.Options
+}
+
+// NewFormatter creates a Formatter with clangformat.NewOptions()
+//
+// NewFormatter 创建使用 clangformat.NewOptions() 的 Formatter
+func NewFormatter() *Formatter {
+	return &Formatter{options: clangformat.NewOptions()}
+}
+
+// WithOptions sets the clangformat.Options and returns the updated Formatter
+//
+// WithOptions 设置 clangformat.Options 并返回更新后的 Formatter
+func (f *Formatter) WithOptions(options *clangformat.Options) *Formatter {
+	f.options = options
+	return f
+}
+
+// DryRun returns the Go file content with formatted cgo preambles
+// The Go file is not modified
+//
+// DryRun 返回 cgo 前导注释已格式化的 Go 文件内容
+// 不会修改 Go 文件
+func DryRun(config *osexec.ExecConfig, path string, style *clangformat.Style) (output []byte, err error) {
+	return NewFormatter().DryRun(config, path, style)
+}
+
+// DryRun works like the package-level DryRun, running clang-format through the options of the Formatter
+// DryRun 与包级 DryRun 相同，通过 Formatter 的 options 运行 clang-format
+func (f *Formatter) DryRun(config *osexec.ExecConfig, path string, style *clangformat.Style) (output []byte, err error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return f.FormatSource(config, path, source, style)
+}
+
+// Format formats the cgo preambles in the Go file and writes the result back
+// Writes only when the content changes, atomically through clangformat.WriteFile
+//
+// Format 格式化 Go 文件中的 cgo 前导注释并写回结果
+// 仅在内容变化时通过 clangformat.WriteFile 原子写入
+func Format(config *osexec.ExecConfig, path string, style *clangformat.Style) (output []byte, err error) {
+	return NewFormatter().Format(config, path, style)
+}
+
+// Format works like the package-level Format, running clang-format and writing the files through the options of the Formatter
+// Format 与包级 Format 相同，通过 Formatter 的 options 运行 clang-format 并写入文件
+func (f *Formatter) Format(config *osexec.ExecConfig, path string, style *clangformat.Style) (output []byte, err error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	output, err = f.FormatSource(config, path, source, style)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if !bytes.Equal(source, output) {
+		if err := f.options.WriteFile(path, output); err != nil {
+			return nil, erero.Wro(err)
+		}
+	}
+	return nil, nil
+}
+
+// FormatSource formats the cgo preambles in the Go source and returns the new source
+// The path is used in parse errors and as the clang-format --assume-filename base
+// Returns the source unchanged when it has no import "C"
+//
+// FormatSource 格式化 Go 源码中的 cgo 前导注释并返回新的源码
+// path 用于解析错误信息，并作为 clang-format --assume-filename 的基础
+// 源码中没有 import "C" 时原样返回
+func FormatSource(config *osexec.ExecConfig, path string, source []byte, style *clangformat.Style) ([]byte, error) {
+	return NewFormatter().FormatSource(config, path, source, style)
+}
+
+// FormatSource works like the package-level FormatSource, running clang-format through the options of the Formatter
+// FormatSource 与包级 FormatSource 相同，通过 Formatter 的 options 运行 clang-format
+func (f *Formatter) FormatSource(config *osexec.ExecConfig, path string, source []byte, style *clangformat.Style) ([]byte, error) {
+	preambles, err := findPreambles(path, source)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	// splice from the end so earlier offsets stay valid
+	// 从末尾开始替换，使前面的偏移量保持有效
+	sort.Slice(preambles, func(i, j int) bool { return preambles[i].start > preambles[j].start })
+
+	var result = source
+	for _, preamble := range preambles {
+		code, ok := preamble.extract()
+		if !ok {
+			continue
+		}
+		output, err := f.options.DryRunSource(config, []byte(protectDirectives(code)), path+".c", style)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		formatted := restoreDirectives(string(output))
+		if preamble.block && strings.Contains(formatted, "*/") {
+			return nil, erero.Errorf("formatted preamble in %s contains */", path)
+		}
+		comment := preamble.rebuild(formatted)
+		result = append(append(append([]byte{}, result[:preamble.start]...), comment...), result[preamble.end:]...)
+	}
+	return result, nil
+}
+
+// FormatProject formats cgo preambles of all .go files in the project
+// Files without import "C" are left untouched
+//
+// FormatProject 格式化项目中所有 .go 文件的 cgo 前导注释
+// 没有 import "C" 的文件保持不变
+func FormatProject(config *osexec.ExecConfig, projectPath string, style *clangformat.Style) error {
+	return NewFormatter().FormatProject(config, projectPath, style)
+}
+
+// FormatProject works like the package-level FormatProject, running clang-format and writing the files through the options of the Formatter
+// FormatProject 与包级 FormatProject 相同，通过 Formatter 的 options 运行 clang-format 并写入文件
+func (f *Formatter) FormatProject(config *osexec.ExecConfig, projectPath string, style *clangformat.Style) error {
+	if err := utils.WalkFilesWithExt(projectPath, ".go", func(path string, info os.FileInfo) error {
+		zaplog.LOG.Debug("cgo-format", zap.String("path", path))
+		osmustexist.MustFile(path)
+
+		if _, err := f.Format(config, path, style); err != nil {
+			return erero.Wro(err)
+		}
+		return nil
+	}); err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
+
+// preamble is the location and shape of a cgo preamble comment
+// preamble 是 cgo 前导注释的位置和形态
+type preamble struct {
+	start  int    // Offset of the comment start // 注释起始偏移量
+	end    int    // Offset after the comment end // 注释结束后的偏移量
+	text   string // Raw comment text // 原始注释文本
+	block  bool   // Whether it is a /* */ comment // 是否为 /* */ 注释
+	spaced bool   // Whether // comment lines have a space after the slashes // // 注释行的斜杠后是否带空格
+	indent string // Indentation before the comment // 注释前的缩进
+}
+
+// findPreambles parses the Go source and returns the doc comments of import "C"
+// findPreambles 解析 Go 源码并返回 import "C" 的文档注释
+func findPreambles(path string, source []byte) ([]*preamble, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, source, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	var preambles []*preamble
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			importSpec := spec.(*ast.ImportSpec)
+			if importSpec.Path.Value != `"C"` {
+				continue
+			}
+			doc := importSpec.Doc
+			if doc == nil && len(genDecl.Specs) == 1 {
+				doc = genDecl.Doc
+			}
+			if doc == nil || !isUniform(doc) {
+				continue
+			}
+			start := fset.Position(doc.Pos()).Offset
+			end := fset.Position(doc.End()).Offset
+			lineStart := bytes.LastIndexByte(source[:start], '\n') + 1
+			indent := string(source[lineStart:start])
+			if strings.TrimSpace(indent) != "" {
+				continue
+			}
+			preambles = append(preambles, &preamble{
+				start:  start,
+				end:    end,
+				text:   string(source[start:end]),
+				block:  strings.HasPrefix(doc.List[0].Text, "/*"),
+				spaced: isSpaced(doc),
+				indent: indent,
+			})
+		}
+	}
+	return preambles, nil
+}
+
+// isUniform reports whether the comment group is one /* */ comment or only // comments
+// isUniform 判断注释组是单个 /* */ 注释还是全部为 // 注释
+func isUniform(doc *ast.CommentGroup) bool {
+	if strings.HasPrefix(doc.List[0].Text, "/*") {
+		return len(doc.List) == 1
+	}
+	for _, comment := range doc.List {
+		if !strings.HasPrefix(comment.Text, "//") {
+			return false
+		}
+	}
+	return true
+}
+
+// isSpaced reports whether every non-empty // comment line has a space after the slashes
+// isSpaced 判断每个非空的 // 注释行在斜杠后是否都带空格
+func isSpaced(doc *ast.CommentGroup) bool {
+	for _, comment := range doc.List {
+		text := strings.TrimPrefix(comment.Text, "//")
+		if text != "" && !strings.HasPrefix(text, " ") {
+			return false
+		}
+	}
+	return true
+}
+
+// extract returns the C code inside the comment
+// Returns false when the comment holds nothing to format
+//
+// extract 返回注释中的 C 代码
+// 注释中没有可格式化内容时返回 false
+func (p *preamble) extract() (string, bool) {
+	var code string
+	if p.block {
+		code = strings.TrimSuffix(strings.TrimPrefix(p.text, "/*"), "*/")
+	} else {
+		lines := strings.Split(p.text, "\n")
+		for idx, line := range lines {
+			lines[idx] = strings.TrimPrefix(strings.TrimSpace(line), "//")
+			if p.spaced {
+				lines[idx] = strings.TrimPrefix(lines[idx], " ")
+			}
+		}
+		code = strings.Join(lines, "\n")
+	}
+	if strings.TrimSpace(code) == "" {
+		return "", false
+	}
+	return code, true
+}
+
+// rebuild wraps the formatted C code back into a comment of the original shape
+// rebuild 将格式化后的 C 代码重新包装为原有形态的注释
+func (p *preamble) rebuild(formatted string) string {
+	if p.block {
+		formatted = strings.TrimLeft(formatted, "\n")
+		// keep the original layout after "/*" on single-line and multi-line comments
+		// 保持单行和多行注释在 "/*" 之后的原有布局
+		if strings.HasPrefix(p.text, "/*\n") {
+			return "/*\n" + formatted + "*/"
+		}
+		return "/* " + strings.TrimSuffix(formatted, "\n") + " */"
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(formatted, "\n"), "\n") {
+		switch {
+		case line == "":
+			lines = append(lines, "//")
+		case p.spaced:
+			lines = append(lines, "// "+line)
+		default:
+			lines = append(lines, "//"+line)
+		}
+	}
+	return strings.Join(lines, "\n"+p.indent)
+}
+
+// protectDirectives wraps runs of #cgo lines with clang-format off/on markers
+// protectDirectives 用 clang-format off/on 标记包裹连续的 #cgo 行
+func protectDirectives(code string) string {
+	var lines []string
+	var inside bool
+	for _, line := range strings.Split(code, "\n") {
+		directive := strings.HasPrefix(strings.TrimSpace(line), "#cgo")
+		if directive && !inside {
+			lines = append(lines, clangFormatOff)
+		}
+		if !directive && inside {
+			lines = append(lines, clangFormatOn)
+		}
+		inside = directive
+		lines = append(lines, line)
+	}
+	if inside {
+		lines = append(lines, clangFormatOn)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// restoreDirectives removes the markers added by protectDirectives
+// restoreDirectives 移除 protectDirectives 添加的标记
+func restoreDirectives(code string) string {
+	lines := strings.Split(code, "\n")
+	var results []string
+	for idx, line := range lines {
+		if line == clangFormatOff && idx+1 < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[idx+1]), "#cgo") {
+			continue
+		}
+		if line == clangFormatOn && len(results) > 0 && strings.HasPrefix(strings.TrimSpace(results[len(results)-1]), "#cgo") {
+			continue
+		}
+		results = append(results, line)
+	}
+	return strings.Join(results, "\n")
+}
@@ -0,0 +1,130 @@
+package cgoformat_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-xlan/clang-format/cgoformat"
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/rese"
+)
+
+func TestFormatSourceWithoutCgo(t *testing.T) {
+	// 没有 import "C" 的文件不会调用 clang-format，内容保持不变
+	const source = `package demo
+
+// Hello says hello
+import "fmt"
+
+func Hello() { fmt.Println("hello") }
+`
+	output, err := cgoformat.FormatSource(osexec.NewExecConfig(), "demo.go", []byte(source), cgoformat.NewStyle())
+	require.NoError(t, err)
+	require.Equal(t, source, string(output))
+}
+
+func TestDryRun(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "cgo-format-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	// 创建带有格式不规范的 cgo 前导注释的 Go 文件
+	goFile := filepath.Join(tempDIR, "demo.go")
+	const originalContent = `package demo
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/include  -O2
+#include<stdlib.h>
+static int add(int a,int b){return a+b;}
+*/
+import "C"
+
+func Add(a, b int) int { return int(C.add(C.int(a), C.int(b))) }
+`
+	must.Done(os.WriteFile(goFile, []byte(originalContent), 0644))
+
+	output, err := cgoformat.DryRun(osexec.NewExecConfig().WithDebug(), goFile, cgoformat.NewStyle())
+	require.NoError(t, err)
+	t.Log(string(output))
+
+	// #cgo 指令保持原样，C 代码被格式化，其余 Go 代码逐字节不变
+	const expectedResult = `package demo
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/include  -O2
+#include <stdlib.h>
+static int add(int a, int b) { return a + b; }
+*/
+import "C"
+
+func Add(a, b int) int { return int(C.add(C.int(a), C.int(b))) }
+`
+	require.Equal(t, expectedResult, string(output))
+
+	// DryRun 不应该修改文件
+	require.Equal(t, originalContent, string(rese.V1(os.ReadFile(goFile))))
+}
+
+func TestFormatLineComments(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "cgo-format-line-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	// 使用 // 注释的 cgo 前导注释，位于分组 import 中
+	goFile := filepath.Join(tempDIR, "demo.go")
+	const originalContent = `package demo
+
+import (
+	"fmt"
+
+	// #include<stdio.h>
+	// static void hello(){printf("hello\n");}
+	"C"
+)
+
+func Hello() { fmt.Println(); C.hello() }
+`
+	must.Done(os.WriteFile(goFile, []byte(originalContent), 0644))
+
+	rese.V1(cgoformat.Format(osexec.NewExecConfig().WithDebug(), goFile, cgoformat.NewStyle()))
+
+	const expectedResult = `package demo
+
+import (
+	"fmt"
+
+	// #include <stdio.h>
+	// static void hello() { printf("hello\n"); }
+	"C"
+)
+
+func Hello() { fmt.Println(); C.hello() }
+`
+	require.Equal(t, expectedResult, string(rese.V1(os.ReadFile(goFile))))
+}
+
+func TestFormatSourceParenthesizedImport(t *testing.T) {
+	// 使用压缩连续空格的假执行器，无需 clang-format
+	fake := clangformat.NewFakeExecutor().WithScript(func(call *clangformat.Call) (*clangformat.Execution, error) {
+		return &clangformat.Execution{Stdout: bytes.ReplaceAll(call.Stdin, []byte("  "), []byte(" "))}, nil
+	})
+	formatter := cgoformat.NewFormatter().WithOptions(clangformat.NewOptions().WithExecutor(fake))
+
+	// 与 cgo 一致，只有一个导入的括号分组中，分组的文档注释就是前导注释
+	const source = "package demo\n\n// int  x;\nimport (\n\t\"C\"\n)\n"
+	output, err := formatter.FormatSource(osexec.NewExecConfig(), "demo.go", []byte(source), cgoformat.NewStyle())
+	require.NoError(t, err)
+	require.Equal(t, "package demo\n\n// int x;\nimport (\n\t\"C\"\n)\n", string(output))
+
+	// 分组中有多个导入时，分组的文档注释不是前导注释，保持不变
+	const grouped = "package demo\n\n// int  x;\nimport (\n\t\"C\"\n\t\"fmt\"\n)\n\nvar _ = fmt.Sprint\n"
+	output, err = formatter.FormatSource(osexec.NewExecConfig(), "demo.go", []byte(grouped), cgoformat.NewStyle())
+	require.NoError(t, err)
+	require.Equal(t, grouped, string(output))
+	require.Len(t, fake.Calls(), 1)
+}
@@ -0,0 +1,190 @@
+package clangformat
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+
+	"github.com/yyle88/erero"
+	"github.com/yyle88/neatjson/neatjsons"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// maxBatchBytes bounds the args of one clang-format run, style JSON included, below the 32 KiB command line limit of Windows
+// maxBatchBytes 限制单次 clang-format 运行的参数长度（包括样式 JSON），低于 Windows 32 KiB 的命令行限制
+const maxBatchBytes = 24 * 1024
+
+// FormatFiles formats the files with as few clang-format runs as the command line length allows
+// Each run reports the replacements of its files with --output-replacements-xml, they are applied and written per file through WriteFile
+// When a run fails, its files are run one by one so the returned error names the failing file
+//
+// FormatFiles 在命令行长度允许的范围内以尽量少的 clang-format 运行次数格式化这些文件
+// 每次运行通过 --output-replacements-xml 报告各文件的替换内容，逐个文件应用后通过 WriteFile 写入
+// 某次运行失败时，其中的文件会逐个运行，使返回的错误指明失败的文件
+func FormatFiles(config *osexec.ExecConfig, paths []string, style *Style) error {
+	return NewOptions().FormatFiles(config, paths, style)
+}
+
+// FormatFiles formats the files like the package FormatFiles, with the settings of the options
+// FormatFiles 像包级 FormatFiles 一样格式化文件，使用 options 的设置
+func (o *Options) FormatFiles(config *osexec.ExecConfig, paths []string, style *Style) error {
+	return o.formatFiles(config, paths, style, false)
+}
+
+// formatFiles formats the files in batches, with the Verify guard when verify is set
+// Content recorded in the Cache of the options is skipped before the batches are built
+//
+// formatFiles 分批格式化文件，verify 为 true 时启用 Verify 保护
+// 已记录在 options 的 Cache 中的内容在分批之前被跳过
+func (o *Options) formatFiles(config *osexec.ExecConfig, paths []string, style *Style, verify bool) error {
+	var pending []string
+	var sources [][]byte
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return erero.Wro(err)
+		}
+		policy, err := o.endingPolicyFor(path)
+		if err != nil {
+			return erero.Wro(err)
+		}
+		if o.cache.lookup(path, path, source, style, policy) {
+			continue
+		}
+		pending = append(pending, path)
+		sources = append(sources, source)
+	}
+	var base int
+	for _, arg := range batchArgs(style) {
+		base += len(arg) + 1
+	}
+	for start := 0; start < len(pending); {
+		end, size := start+1, base+len(pending[start])
+		for end < len(pending) && size+1+len(pending[end]) <= maxBatchBytes {
+			size += 1 + len(pending[end])
+			end++
+		}
+		if err := o.formatBatch(config, pending[start:end], sources[start:end], style, verify); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// formatBatch formats the files with one clang-format run and writes back the changed ones
+// A file saved while clang-format ran no longer matches its replacements, it is formatted again on its own through stdin
+//
+// formatBatch 以一次 clang-format 运行格式化这些文件并写回发生变化的文件
+// 在 clang-format 运行期间被保存的文件不再与其替换内容对应，会单独通过标准输入重新格式化
+func (o *Options) formatBatch(config *osexec.ExecConfig, paths []string, sources [][]byte, style *Style, verify bool) error {
+	outputs, err := o.dryRunBatch(config, paths, sources, style)
+	if err != nil {
+		if len(paths) == 1 {
+			return erero.WithMessage(err, paths[0])
+		}
+		// a failed run does not tell which file broke it, running the files one by one does
+		// 失败的运行无法说明是哪个文件导致的，逐个运行可以
+		zaplog.LOG.Debug("clang-format", zap.Int("batch", len(paths)), zap.Error(err))
+		for idx := range paths {
+			if err := o.formatBatch(config, paths[idx:idx+1], sources[idx:idx+1], style, verify); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for idx, path := range paths {
+		current, err := os.ReadFile(path)
+		if err != nil {
+			return erero.WithMessage(err, path)
+		}
+		if !bytes.Equal(current, sources[idx]) {
+			zaplog.LOG.Debug("clang-format", zap.String("path", path), zap.String("fallback", "changed during the batch run"))
+			if _, err := o.formatSource(config, path, path, style, verify); err != nil {
+				return erero.WithMessage(err, path)
+			}
+			continue
+		}
+		if verify {
+			if err := Verify(path, sources[idx], outputs[idx]); err != nil {
+				return err
+			}
+		}
+		// WriteFile applies the ending policy and skips the write when the content stays the same
+		// WriteFile 应用换行策略，内容不变时跳过写入
+		if err := o.WriteFile(path, outputs[idx]); err != nil {
+			return erero.WithMessage(err, path)
+		}
+		policy, err := o.endingPolicyFor(path)
+		if err != nil {
+			return erero.WithMessage(err, path)
+		}
+		o.cache.store(path, path, style, policy)
+	}
+	return nil
+}
+
+// xmlReplacements is one document of the clang-format --output-replacements-xml output
+// xmlReplacements 是 clang-format --output-replacements-xml 输出中的一个文档
+type xmlReplacements struct {
+	Items []*xmlReplacement `xml:"replacement"`
+}
+
+// xmlReplacement replaces length bytes at offset of the original content with the text
+// xmlReplacement 将原始内容中 offset 处的 length 个字节替换为 text
+type xmlReplacement struct {
+	Offset int    `xml:"offset,attr"`
+	Length int    `xml:"length,attr"`
+	Text   string `xml:",chardata"`
+}
+
+// dryRunBatch runs clang-format once on the files and returns their formatted contents in order
+// The sources are the contents the replacements apply to
+//
+// dryRunBatch 对这些文件运行一次 clang-format 并按顺序返回格式化后的内容
+// sources 是替换所作用的内容
+func (o *Options) dryRunBatch(config *osexec.ExecConfig, paths []string, sources [][]byte, style *Style) ([][]byte, error) {
+	output, err := o.run(config, append(batchArgs(style), paths...), nil)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(output))
+	outputs := make([][]byte, 0, len(paths))
+	for idx, path := range paths {
+		var replacements xmlReplacements
+		if err := decoder.Decode(&replacements); err != nil {
+			return nil, erero.WithMessage(err, "reading the replacements of "+path)
+		}
+		formatted, err := applyReplacements(sources[idx], replacements.Items)
+		if err != nil {
+			return nil, erero.WithMessage(err, path)
+		}
+		outputs = append(outputs, formatted)
+	}
+	return outputs, nil
+}
+
+// batchArgs returns the args of a batch run before the file paths, ending with -- so paths starting with - stay paths
+// batchArgs 返回批量运行中位于文件路径之前的参数，以 -- 结尾，使以 - 开头的路径仍被视为路径
+func batchArgs(style *Style) []string {
+	return []string{"--output-replacements-xml", "-style", neatjsons.Sjson(style), "--"}
+}
+
+// applyReplacements applies the replacements, sorted by offset and not overlapping, to the source
+// applyReplacements 将按偏移排序且互不重叠的替换应用到源码
+func applyReplacements(source []byte, replacements []*xmlReplacement) ([]byte, error) {
+	var result bytes.Buffer
+	var pos int
+	for _, replacement := range replacements {
+		if replacement.Offset < pos || replacement.Length < 0 || replacement.Offset+replacement.Length > len(source) {
+			return nil, erero.Errorf("replacement at offset %d length %d is out of order or range", replacement.Offset, replacement.Length)
+		}
+		result.Write(source[pos:replacement.Offset])
+		result.WriteString(replacement.Text)
+		pos = replacement.Offset + replacement.Length
+	}
+	result.Write(source[pos:])
+	return result.Bytes(), nil
+}
@@ -0,0 +1,120 @@
+package clangformat_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/rese"
+)
+
+// fakeReplacements is a clang-format stand-in printing a replacement document per file argument
+// It inserts a comment line at the start of each file, fails on files named bad*, and counts its runs
+//
+// fakeReplacements 是替代 clang-format 的脚本，为每个文件参数输出一个替换文档
+// 在每个文件开头插入一行注释，遇到名为 bad* 的文件时失败，并记录运行次数
+const fakeReplacements = `#!/bin/sh
+echo x >> "$CLANG_FORMAT_CALLS"
+while [ $# -gt 0 ]; do
+	case "$1" in
+	-style) shift 2 ;;
+	--) shift; break ;;
+	-*) shift ;;
+	*) break ;;
+	esac
+done
+for f in "$@"; do
+	case "$(basename "$f")" in bad*) echo "error: $f" >&2; exit 1 ;; esac
+	echo "<?xml version='1.0'?>"
+	echo "<replacements xml:space='preserve' incomplete_format='false'>"
+	echo "<replacement offset='0' length='0'>// ok&#10;</replacement>"
+	echo "</replacements>"
+done
+`
+
+func TestFormatProjectBatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake clang-format is a shell script")
+	}
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-batch-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	binDIR := filepath.Join(tempDIR, "bin")
+	counter := filepath.Join(tempDIR, "calls")
+	must.Done(os.Mkdir(binDIR, 0755))
+	must.Done(os.WriteFile(filepath.Join(binDIR, "clang-format"), []byte(fakeReplacements), 0755))
+	t.Setenv("PATH", binDIR+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("CLANG_FORMAT_CALLS", counter)
+	calls := func() int {
+		return strings.Count(string(rese.V1(os.ReadFile(counter))), "x")
+	}
+
+	projectDIR := filepath.Join(tempDIR, "project")
+	must.Done(os.MkdirAll(filepath.Join(projectDIR, "sub"), 0755))
+	for _, name := range []string{"a.cc", "b.cc", filepath.Join("sub", "c.cc")} {
+		must.Done(os.WriteFile(filepath.Join(projectDIR, name), []byte("int x;\n"), 0644))
+	}
+
+	// 所有文件在一次 clang-format 运行中完成格式化
+	must.Done(clangformat.FormatProject(osexec.NewExecConfig(), projectDIR, ".cc", clangformat.NewStyle()))
+	require.Equal(t, 1, calls())
+	require.Equal(t, "// ok\nint x;\n", string(rese.V1(os.ReadFile(filepath.Join(projectDIR, "sub", "c.cc")))))
+
+	// 批次失败时逐个运行，错误指明失败的文件
+	must.Done(os.WriteFile(filepath.Join(projectDIR, "bad.cc"), []byte("int y;\n"), 0644))
+	err := clangformat.FormatProject(osexec.NewExecConfig(), projectDIR, ".cc", clangformat.NewStyle())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "bad.cc")
+	require.Equal(t, "// ok\n// ok\nint x;\n", string(rese.V1(os.ReadFile(filepath.Join(projectDIR, "a.cc")))))
+	require.Equal(t, "int y;\n", string(rese.V1(os.ReadFile(filepath.Join(projectDIR, "bad.cc")))))
+}
+
+func TestFormatFilesChangedDuringRun(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-batch-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	savedPath := filepath.Join(tempDIR, "saved.cc")
+	dashPath := filepath.Join(tempDIR, "-dash.cc")
+	must.Done(os.WriteFile(savedPath, []byte("int a;\n"), 0644))
+	must.Done(os.WriteFile(dashPath, []byte("int d;\n"), 0644))
+
+	// the file is saved once clang-format has read it, as an editor may do during the batch run
+	// clang-format 读取文件后文件被保存，就像编辑器在批量运行期间可能做的那样
+	fake := clangformat.NewFakeExecutor()
+	fake.WithScript(func(call *clangformat.Call) (*clangformat.Execution, error) {
+		execution, err := upperScript(call)
+		if slices.Contains(call.Args, "--output-replacements-xml") {
+			must.Done(os.WriteFile(savedPath, []byte("int a;\nint b;\n"), 0644))
+		}
+		return execution, err
+	})
+	options := clangformat.NewOptions().WithExecutor(fake)
+	must.Done(options.FormatFiles(nil, []string{savedPath, dashPath}, clangformat.NewStyle()))
+
+	// 保存后的内容被单独重新格式化，不会被旧内容的替换覆盖
+	require.Equal(t, "INT A;\nINT B;\n", string(rese.V1(os.ReadFile(savedPath))))
+	require.Equal(t, "INT D;\n", string(rese.V1(os.ReadFile(dashPath))))
+
+	// 文件路径位于 -- 之后，以 - 开头的文件名不会被当作选项
+	calls := fake.Calls()
+	require.Len(t, calls, 2)
+	args := calls[0].Args
+	require.Equal(t, []string{"--", savedPath, dashPath}, args[len(args)-3:])
+	require.Equal(t, []byte("int a;\nint b;\n"), calls[1].Stdin)
+
+	// 样式 JSON 计入命令行长度，样式很长时每个文件单独运行
+	fake = clangformat.NewFakeExecutor().WithScript(upperScript)
+	style := clangformat.NewStyle()
+	style.BasedOnStyle = strings.Repeat("x", 24*1024)
+	must.Done(clangformat.NewOptions().WithExecutor(fake).FormatFiles(nil, []string{savedPath, dashPath}, style))
+	require.Len(t, fake.Calls(), 2)
+}
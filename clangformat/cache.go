@@ -0,0 +1,134 @@
+package clangformat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/yyle88/erero"
+	"github.com/yyle88/neatjson/neatjsons"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// DefaultCacheDIR returns the DIR where the format cache is kept when none is given
+//
+// DefaultCacheDIR 返回未指定时保存格式化缓存的目录
+func DefaultCacheDIR() (string, error) {
+	cacheDIR, err := os.UserCacheDir()
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	return filepath.Join(cacheDIR, "clang-format-batch", "formatted"), nil
+}
+
+// ClangFormatVersion returns the version line printed by clang-format --version
+//
+// ClangFormatVersion 返回 clang-format --version 输出的版本行
+func ClangFormatVersion(config *osexec.ExecConfig) (string, error) {
+	return NewOptions().ClangFormatVersion(config)
+}
+
+// ClangFormatVersion returns the version line of the clang-format run through the Executor of the options
+// ClangFormatVersion 返回通过 options 的 Executor 运行的 clang-format 的版本行
+func (o *Options) ClangFormatVersion(config *osexec.ExecConfig) (string, error) {
+	output, err := o.run(config, []string{"--version"}, nil)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Cache remembers the contents already known to be formatted, so clang-format is not run on them again
+// An entry is keyed by the hash of the content, the style, the language, the ending policy and the clang-format version,
+// any change to one of them misses the cache, entries are empty files sharded by the first two hex digits of the key
+// Content keys stay valid across rollbacks and undos, remove the DIR to drop the cache
+//
+// Cache 记录已知格式化完成的内容，使 clang-format 不再对其重复运行
+// 条目以内容、样式、语言、换行策略和 clang-format 版本的哈希为键，任何一项变化都不会命中缓存，
+// 条目是按键的前两位十六进制字符分片存放的空文件
+// 以内容为键的条目在回滚和撤销之后依然有效，删除目录即可清空缓存
+type Cache struct {
+	dir     string
+	version string
+	hits    atomic.Int64
+	misses  atomic.Int64
+}
+
+// OpenCache opens the cache DIR, set it on the Options with WithCache to skip files recorded as formatted there
+// The version is the clang-format version the entries belong to, see ClangFormatVersion
+//
+// OpenCache 打开缓存目录，通过 WithCache 设置到 Options 上以跳过其中记录为已格式化的文件
+// version 是条目所属的 clang-format 版本，参见 ClangFormatVersion
+func OpenCache(cacheDIR string, version string) (*Cache, error) {
+	if err := os.MkdirAll(cacheDIR, 0700); err != nil {
+		return nil, erero.Wro(err)
+	}
+	return &Cache{dir: cacheDIR, version: version}, nil
+}
+
+// Close returns the number of skipped and formatted files
+//
+// Close 返回跳过和实际格式化的文件数量
+func (c *Cache) Close() (hits int, misses int) {
+	return int(c.hits.Load()), int(c.misses.Load())
+}
+
+// key returns the cache key of the content formatted as assumeFilename with the style and the ending policy
+// key 返回以 assumeFilename 的语言、该样式和该换行策略格式化该内容时的缓存键
+func (c *Cache) key(assumeFilename string, content []byte, style *Style, policy *EndingPolicy) string {
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%s\x00%s\x00%s\x00%+v\x00", c.version, filepath.Ext(assumeFilename), neatjsons.Sjson(style), *policy)
+	_, _ = hash.Write(content)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// entry returns the path of the entry file of the key
+// entry 返回该键对应的条目文件路径
+func (c *Cache) entry(key string) string {
+	return filepath.Join(c.dir, key[:2], key[2:])
+}
+
+// lookup reports whether the content of the path is recorded as formatted, a nil Cache knows nothing
+// lookup 判断该路径的内容是否已记录为格式化完成，nil 的 Cache 不包含任何记录
+func (c *Cache) lookup(path string, assumeFilename string, content []byte, style *Style, policy *EndingPolicy) bool {
+	if c == nil {
+		return false
+	}
+	if _, err := os.Stat(c.entry(c.key(assumeFilename, content, style, policy))); err != nil {
+		c.misses.Add(1)
+		return false
+	}
+	c.hits.Add(1)
+	zaplog.LOG.Debug("clang-format", zap.String("path", path), zap.String("skip", "cached"))
+	return true
+}
+
+// store records the current content of the file as formatted, a nil Cache records nothing
+// A cache that can not be written only costs speed, so failures are logged and not returned
+//
+// store 将文件的当前内容记录为格式化完成，nil 的 Cache 不做记录
+// 缓存无法写入只会影响速度，因此失败时仅记录日志而不返回错误
+func (c *Cache) store(path string, assumeFilename string, style *Style, policy *EndingPolicy) {
+	if c == nil {
+		return
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		zaplog.LOG.Warn("clang-format", zap.String("path", path), zap.Error(err))
+		return
+	}
+	entry := c.entry(c.key(assumeFilename, content, style, policy))
+	if err := os.MkdirAll(filepath.Dir(entry), 0700); err != nil {
+		zaplog.LOG.Warn("clang-format", zap.String("cache", entry), zap.Error(err))
+		return
+	}
+	if err := os.WriteFile(entry, nil, 0600); err != nil {
+		zaplog.LOG.Warn("clang-format", zap.String("cache", entry), zap.Error(err))
+	}
+}
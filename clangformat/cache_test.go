@@ -0,0 +1,83 @@
+package clangformat_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/rese"
+)
+
+func TestCacheSkipsFormatted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake clang-format is a shell script")
+	}
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-cache-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	// 使用记录调用次数的假 clang-format，将连续空格压缩为一个
+	binDIR := filepath.Join(tempDIR, "bin")
+	counter := filepath.Join(tempDIR, "calls")
+	must.Done(os.Mkdir(binDIR, 0755))
+	must.Done(os.WriteFile(filepath.Join(binDIR, "clang-format"), []byte("#!/bin/sh\necho x >> "+counter+"\ntr -s ' '\n"), 0755))
+	t.Setenv("PATH", binDIR+string(os.PathListSeparator)+os.Getenv("PATH"))
+	calls := func() int {
+		data, err := os.ReadFile(counter)
+		if os.IsNotExist(err) {
+			return 0
+		}
+		must.Done(err)
+		return strings.Count(string(data), "x")
+	}
+
+	path := filepath.Join(tempDIR, "demo.cc")
+	must.Done(os.WriteFile(path, []byte("int  a;\n"), 0644))
+
+	config := osexec.NewExecConfig()
+	cache := rese.P1(clangformat.OpenCache(filepath.Join(tempDIR, "cache"), "fake 1.0"))
+	options := clangformat.NewOptions().WithCache(cache)
+	rese.V1(options.Format(config, path, clangformat.NewStyle()))
+	require.Equal(t, "int a;\n", string(rese.V1(os.ReadFile(path))))
+	require.Equal(t, 1, calls())
+
+	// 已格式化的内容命中缓存，不再运行 clang-format
+	rese.V1(options.Format(config, path, clangformat.NewStyle()))
+	require.Equal(t, 1, calls())
+
+	// 样式变化时缓存不命中
+	style := clangformat.NewStyle()
+	style.IndentWidth = 4
+	rese.V1(options.Format(config, path, style))
+	require.Equal(t, 2, calls())
+
+	hits, misses := cache.Close()
+	require.Equal(t, 1, hits)
+	require.Equal(t, 2, misses)
+
+	// 版本变化时缓存不命中
+	cache = rese.P1(clangformat.OpenCache(filepath.Join(tempDIR, "cache"), "fake 2.0"))
+	rese.V1(clangformat.NewOptions().WithCache(cache).Format(config, path, clangformat.NewStyle()))
+	require.Equal(t, 3, calls())
+
+	// 没有设置缓存的 Options 总是运行 clang-format
+	rese.V1(clangformat.Format(config, path, clangformat.NewStyle()))
+	require.Equal(t, 4, calls())
+}
+
+func TestOpenCacheTwice(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-cache-twice-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	// 缓存属于各自的 Options，同一目录可以同时打开多次
+	cache := rese.P1(clangformat.OpenCache(tempDIR, "fake 1.0"))
+	other := rese.P1(clangformat.OpenCache(tempDIR, "fake 1.0"))
+	require.NotSame(t, cache, other)
+}
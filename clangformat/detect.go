@@ -0,0 +1,127 @@
+package clangformat
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// modelinePattern matches editor modelines such as "-*- C++ -*-", "-*- mode: objc -*-" and "vim: set ft=cpp:"
+// modelinePattern 匹配编辑器模式行，例如 "-*- C++ -*-"、"-*- mode: objc -*-" 和 "vim: set ft=cpp:"
+var modelinePattern = regexp.MustCompile(`(?i)-\*-\s*(?:mode:\s*)?([a-z+-]+)\s*;?.*-\*-|vim?:.*\b(?:ft|filetype)=([a-z+]+)`)
+
+// objcPrefixes are line prefixes only seen in Objective-C sources
+// objcPrefixes 是只出现在 Objective-C 源码中的行前缀
+var objcPrefixes = []string{"@interface", "@implementation", "@protocol", "@end", "@class", "@property", "#import <Foundation/", "#import <UIKit/", "#import <Cocoa/"}
+
+// cppDirectivePattern matches preprocessor lines that only C-family sources have: includes of a header and #pragma once
+// cppDirectivePattern 匹配只有 C 家族源码才有的预处理行：头文件包含和 #pragma once
+var cppDirectivePattern = regexp.MustCompile(`^#\s*(?:include|include_next)\s*[<"][^>"]+[>"]|^#\s*pragma\s+once\b`)
+
+// guardPattern matches the #ifndef and #define lines of an include guard, the name is captured
+// guardPattern 匹配头文件保护的 #ifndef 和 #define 行，并捕获其名称
+var guardPattern = regexp.MustCompile(`^#\s*(ifndef|define)\s+([A-Za-z_][A-Za-z0-9_]*)\s*$`)
+
+// cppDeclarationPattern matches lines opening C/C++ declarations, they count only in content with braces and semicolons
+// cppDeclarationPattern 匹配开启 C/C++ 声明的行，只有在包含花括号和分号的内容中才计入
+var cppDeclarationPattern = regexp.MustCompile(`^(?:namespace(?:\s+[A-Za-z_][\w:]*)?\s*\{|template\s*<|extern\s+"C"\s*\{?$|using\s+namespace\s+[\w:]+\s*;|typedef\s+(?:struct|enum|union)\b|(?:class|struct)\s+[A-Za-z_]\w*(?:\s*:\s*(?:public|protected|private)\b[^;{]*)?\s*\{?$)`)
+
+// DetectLanguage guesses the clang-format language of the content without relying on the file name
+// Checks editor modelines first, then Objective-C markers, then C/C++ markers
+// Words such as class or struct appear in prose and scripts too, so C/C++ needs an include, #pragma once, an include guard,
+// or a namespace, template or class declaration in content that has braces and semicolons
+// Returns "ObjC", "Cpp", or "" when the content is not text, a script with shebang, or unrecognized
+//
+// DetectLanguage 不依赖文件名猜测内容的 clang-format 语言
+// 先检查编辑器模式行，再检查 Objective-C 标记，最后检查 C/C++ 标记
+// class、struct 等单词同样出现在正文和脚本中，因此 C/C++ 需要头文件包含、#pragma once、头文件保护，
+// 或者在包含花括号和分号的内容中出现 namespace、template 或 class 声明
+// 当内容不是文本、是带 shebang 的脚本或无法识别时返回 ""
+func DetectLanguage(content []byte) string {
+	if bytes.HasPrefix(content, []byte("#!")) || !IsText(content) {
+		return ""
+	}
+
+	var directive, declaration bool
+	var guard string // name of the #ifndef on the previous line // 上一行 #ifndef 的名称
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNum := 0; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		// modelines are only honored in the leading lines, as editors do
+		// 与编辑器一致，只识别开头几行中的模式行
+		if lineNum < 5 {
+			if name := matchModeline(line); name != "" {
+				return name
+			}
+		}
+		for _, prefix := range objcPrefixes {
+			if strings.HasPrefix(line, prefix) {
+				return "ObjC"
+			}
+		}
+		if cppDirectivePattern.MatchString(line) {
+			directive = true
+		}
+		// an include guard is #ifndef NAME directly followed by #define NAME
+		// 头文件保护是 #ifndef NAME 紧跟 #define NAME
+		matches := guardPattern.FindStringSubmatch(line)
+		if matches != nil && matches[1] == "define" && matches[2] == guard {
+			directive = true
+		}
+		if matches != nil && matches[1] == "ifndef" {
+			guard = matches[2]
+		} else {
+			guard = ""
+		}
+		if cppDeclarationPattern.MatchString(line) {
+			declaration = true
+		}
+	}
+	if directive || (declaration && bytes.ContainsAny(content, "{") && bytes.ContainsAny(content, "}") && bytes.ContainsAny(content, ";")) {
+		return "Cpp"
+	}
+	return ""
+}
+
+// IsText reports whether the content looks like text: valid UTF-8 in the leading 8 KiB without NUL bytes
+// Used to skip binaries and other non-text files before reading them as source
+//
+// IsText 判断内容是否像文本：开头 8 KiB 是不含 NUL 字节的有效 UTF-8
+// 用于在将文件作为源码读取之前跳过二进制文件和其他非文本文件
+func IsText(content []byte) bool {
+	head := content[:min(len(content), 8*1024)]
+	if bytes.IndexByte(head, 0) >= 0 {
+		return false
+	}
+	if len(head) == len(content) {
+		return utf8.Valid(head)
+	}
+	// the cut may split a multibyte rune at the end, its leading bytes are forgiven
+	// 截断可能切开末尾的多字节字符，容忍其开头的几个字节
+	for cut := 0; cut < utf8.UTFMax && cut < len(head); cut++ {
+		if utf8.Valid(head[:len(head)-cut]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchModeline returns the language named by an editor modeline in the line
+// matchModeline 返回该行中编辑器模式行指定的语言
+func matchModeline(line string) string {
+	matches := modelinePattern.FindStringSubmatch(line)
+	if matches == nil {
+		return ""
+	}
+	mode := strings.ToLower(matches[1] + matches[2])
+	switch mode {
+	case "c", "c++", "cpp", "cc", "cxx":
+		return "Cpp"
+	case "objc", "objc++", "objective-c", "objcpp":
+		return "ObjC"
+	}
+	return ""
+}
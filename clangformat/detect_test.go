@@ -0,0 +1,62 @@
+package clangformat_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	for content, name := range map[string]string{
+		"// -*- C++ -*-\n#ifndef _GLIBCXX_VECTOR\n":                         "Cpp",
+		"/* -*- mode: objc -*- */\nint x;\n":                                "ObjC",
+		"// vim: set ft=cpp:\nint x;\n":                                     "Cpp",
+		"#import <Foundation/Foundation.h>\n":                               "ObjC",
+		"#include <stdint.h>\n\n@interface Foo : NSObject\n@end\n":          "ObjC",
+		"#pragma once\n\nnamespace std {\ntemplate <class T> class X;\n}\n": "Cpp",
+		"#!/bin/sh\n#include nothing\n":                                     "",
+		"Copyright notice\nMIT License\n":                                   "",
+		"\x00\x01binary #include":                                           "",
+		"#ifndef FOO_H\n#define FOO_H\nint foo(void);\n#endif\n":            "Cpp",
+		"namespace demo {\nint x;\n}\n":                                     "Cpp",
+		"This class covers the struct of the project.\nusing it is free;\n": "",
+		"class notes\nstruct ideas\ntypedef words\n":                        "",
+		"all:\n\tfor f in *.c; do { echo $$f; }; done\n# class Foo\n":       "",
+		"\xff\xfeL\x00I\x00C\x00":                                           "",
+	} {
+		require.Equal(t, name, clangformat.DetectLanguage([]byte(content)), content)
+	}
+}
+
+func TestEntryPointsDetectLanguage(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-detect-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	objcPath := filepath.Join(tempDIR, "view.h")
+	must.Done(os.WriteFile(objcPath, []byte("#import <UIKit/UIKit.h>\n@interface View : UIView\n@end\n"), 0644))
+	cppPath := filepath.Join(tempDIR, "vector")
+	must.Done(os.WriteFile(cppPath, []byte("#pragma once\nnamespace demo {\nclass Vector {};\n}\n"), 0644))
+
+	fake := clangformat.NewFakeExecutor()
+	options := clangformat.NewOptions().WithExecutor(fake)
+	language, ok := options.NewRegistry().Lookup(".h")
+	require.True(t, ok)
+
+	// Format、DryRun 以及注册表的内存格式化都按检测到的语言传入
+	rese.V1(options.Format(nil, objcPath, clangformat.NewStyle()))
+	rese.V1(options.DryRun(nil, cppPath, clangformat.NewStyle()))
+	rese.V1(language.DryRunSource(nil, rese.V1(os.ReadFile(objcPath)), objcPath, clangformat.NewStyle()))
+	rese.V1(language.Formatter.Format(nil, cppPath, clangformat.NewStyle()))
+
+	var names []string
+	for _, call := range fake.Calls() {
+		names = append(names, call.Args[1])
+	}
+	require.Equal(t, []string{objcPath + ".m", cppPath + ".h", objcPath + ".m", cppPath + ".h"}, names)
+}
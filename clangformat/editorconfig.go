@@ -0,0 +1,178 @@
+package clangformat
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/yyle88/erero"
+)
+
+// EditorConfigProperties returns the .editorconfig properties that apply to the file
+// Files are read from the DIR of the file upward until one declares root = true,
+// nearer files and later sections override earlier ones, keys and values are lowercased
+// Sections use the EditorConfig globs: *, **, ?, [chars], [!chars] and {a,b}
+//
+// EditorConfigProperties 返回适用于该文件的 .editorconfig 属性
+// 从文件所在目录向上读取，直到某个文件声明 root = true，
+// 更近的文件和更靠后的节覆盖前面的设置，键和值均转为小写
+// 节名使用 EditorConfig 通配符：*、**、?、[chars]、[!chars] 和 {a,b}
+func EditorConfigProperties(path string) (map[string]string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	var configs []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		config := filepath.Join(dir, ".editorconfig")
+		if _, err := os.Stat(config); err == nil {
+			configs = append(configs, config)
+			root, err := isRootEditorConfig(config)
+			if err != nil {
+				return nil, erero.Wro(err)
+			}
+			if root {
+				break
+			}
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+	properties := map[string]string{}
+	for idx := len(configs) - 1; idx >= 0; idx-- {
+		if err := applyEditorConfig(configs[idx], path, properties); err != nil {
+			return nil, erero.Wro(err)
+		}
+	}
+	return properties, nil
+}
+
+// isRootEditorConfig reports whether the preamble of the .editorconfig file declares root = true
+// isRootEditorConfig 判断 .editorconfig 文件的前导部分是否声明了 root = true
+func isRootEditorConfig(config string) (bool, error) {
+	var root bool
+	err := scanEditorConfig(config, func(section string, key string, value string) {
+		if section == "" && key == "root" {
+			root = value == "true"
+		}
+	})
+	return root, err
+}
+
+// applyEditorConfig sets the properties of the sections matching the file
+// applyEditorConfig 设置与该文件匹配的节中的属性
+func applyEditorConfig(config string, path string, properties map[string]string) error {
+	rel, err := filepath.Rel(filepath.Dir(config), path)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	rel = filepath.ToSlash(rel)
+	var matched = map[string]bool{}
+	return scanEditorConfig(config, func(section string, key string, value string) {
+		if section == "" {
+			return
+		}
+		match, ok := matched[section]
+		if !ok {
+			match = editorConfigGlob(section).MatchString(rel)
+			matched[section] = match
+		}
+		if match {
+			properties[key] = value
+		}
+	})
+}
+
+// scanEditorConfig calls visit on each key = value line with the section it belongs to
+// scanEditorConfig 对每个 key = value 行及其所属的节调用 visit
+func scanEditorConfig(config string, visit func(section string, key string, value string)) error {
+	file, err := os.Open(config)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var section string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = line[1 : len(line)-1]
+		default:
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			visit(section, strings.ToLower(strings.TrimSpace(key)), strings.ToLower(strings.TrimSpace(value)))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
+
+// editorConfigGlob converts a section glob into a regexp matching slash-separated paths relative to the .editorconfig DIR
+// Globs without a slash match the file name in any DIR
+//
+// editorConfigGlob 将节通配符转换为正则表达式，匹配相对于 .editorconfig 所在目录、以斜杠分隔的路径
+// 不含斜杠的通配符匹配任意目录中的文件名
+func editorConfigGlob(glob string) *regexp.Regexp {
+	var result strings.Builder
+	if strings.Contains(glob, "/") {
+		glob = strings.TrimPrefix(glob, "/")
+	} else {
+		result.WriteString("(?:.*/)?")
+	}
+	var depth int
+	for idx := 0; idx < len(glob); idx++ {
+		char := glob[idx]
+		switch {
+		case char == '\\' && idx+1 < len(glob):
+			idx++
+			result.WriteString(regexp.QuoteMeta(string(glob[idx])))
+		case char == '*' && idx+1 < len(glob) && glob[idx+1] == '*':
+			idx++
+			result.WriteString(".*")
+		case char == '*':
+			result.WriteString("[^/]*")
+		case char == '?':
+			result.WriteString("[^/]")
+		case char == '[':
+			end := strings.IndexByte(glob[idx:], ']')
+			if end < 0 {
+				result.WriteString(`\[`)
+				continue
+			}
+			class := glob[idx+1 : idx+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			result.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			idx += end
+		case char == '{' && strings.IndexByte(glob[idx:], '}') > 0:
+			depth++
+			result.WriteString("(?:")
+		case char == ',' && depth > 0:
+			result.WriteString("|")
+		case char == '}' && depth > 0:
+			depth--
+			result.WriteString(")")
+		default:
+			result.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+	pattern, err := regexp.Compile("^" + result.String() + "$")
+	if err != nil {
+		// a glob this converter can not express matches nothing
+		// 该转换器无法表达的通配符不匹配任何路径
+		return regexp.MustCompile(`^\z.`)
+	}
+	return pattern
+}
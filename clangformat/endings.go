@@ -0,0 +1,250 @@
+package clangformat
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/yyle88/erero"
+)
+
+// LineEnding names a line ending style
+//
+// LineEnding 表示换行符风格
+type LineEnding string
+
+const (
+	LineEndingPreserve LineEnding = ""      // Keep the style of the original file // 保持原始文件的风格
+	LineEndingLF       LineEnding = "lf"    // Unix \n // Unix 的 \n
+	LineEndingCRLF     LineEnding = "crlf"  // Windows \r\n // Windows 的 \r\n
+	LineEndingMixed    LineEnding = "mixed" // Detected only, both styles appear // 仅用于检测结果，两种风格同时出现
+)
+
+// Presence decides whether a BOM or final newline is kept, added or removed
+//
+// Presence 决定 BOM 或末尾换行是保持、添加还是删除
+type Presence string
+
+const (
+	PresencePreserve Presence = ""       // Keep the state of the original file // 保持原始文件的状态
+	PresenceAdd      Presence = "add"    // Make sure it is there // 确保存在
+	PresenceRemove   Presence = "remove" // Make sure it is not there // 确保不存在
+)
+
+// EndingPolicy decides the line endings, BOM and final newline of the files written by WriteFile
+// Fields left to preserve restore the state of the original file, so formatting never flips them
+// With EditorConfig set, end_of_line, charset and insert_final_newline of .editorconfig files take precedence
+//
+// EndingPolicy 决定 WriteFile 写入的文件的换行符、BOM 和末尾换行
+// 保持为 preserve 的字段会恢复原始文件的状态，使格式化不会改变它们
+// 设置 EditorConfig 后，.editorconfig 文件中的 end_of_line、charset 和 insert_final_newline 优先生效
+type EndingPolicy struct {
+	LineEnding   LineEnding // Line ending style // 换行符风格
+	BOM          Presence   // UTF-8 BOM // UTF-8 BOM
+	FinalNewline Presence   // Newline at the end of the file // 文件末尾的换行
+	EditorConfig bool       // Whether .editorconfig files override the fields // 是否由 .editorconfig 文件覆盖这些字段
+}
+
+// NewEndingPolicy creates an EndingPolicy restoring the original line endings, BOM and final newline
+//
+// NewEndingPolicy 创建恢复原始换行符、BOM 和末尾换行的 EndingPolicy
+func NewEndingPolicy() *EndingPolicy {
+	return &EndingPolicy{FinalNewline: PresencePreserve}
+}
+
+// ParseLineEnding converts preserve, lf or crlf into a LineEnding
+//
+// ParseLineEnding 将 preserve、lf 或 crlf 转换为 LineEnding
+func ParseLineEnding(name string) (LineEnding, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "preserve":
+		return LineEndingPreserve, nil
+	case "lf":
+		return LineEndingLF, nil
+	case "crlf":
+		return LineEndingCRLF, nil
+	default:
+		return "", erero.Errorf("unknown line ending %s, expected preserve, lf or crlf", name)
+	}
+}
+
+// ParsePresence converts preserve, add or remove into a Presence
+//
+// ParsePresence 将 preserve、add 或 remove 转换为 Presence
+func ParsePresence(name string) (Presence, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "preserve":
+		return PresencePreserve, nil
+	case "add":
+		return PresenceAdd, nil
+	case "remove":
+		return PresenceRemove, nil
+	default:
+		return "", erero.Errorf("unknown policy %s, expected preserve, add or remove", name)
+	}
+}
+
+// Endings is the detected line ending style, BOM and final newline of a content
+//
+// Endings 是检测到的内容的换行符风格、BOM 和末尾换行
+type Endings struct {
+	LineEnding   LineEnding // Empty when the content has no newline // 内容没有换行时为空
+	BOM          bool       // Whether the content starts with a UTF-8 BOM // 内容是否以 UTF-8 BOM 开头
+	FinalNewline bool       // Whether the content ends with a newline // 内容是否以换行结尾
+}
+
+func (e *Endings) String() string {
+	var parts = []string{string(e.LineEnding)}
+	if e.LineEnding == LineEndingPreserve {
+		parts[0] = "no newline"
+	}
+	if e.BOM {
+		parts = append(parts, "BOM")
+	}
+	if !e.FinalNewline {
+		parts = append(parts, "no final newline")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// utf8BOM starts UTF-8 content with a byte order mark
+// utf8BOM 是 UTF-8 内容开头的字节顺序标记
+var utf8BOM = []byte("\ufeff")
+
+// DetectEndings returns the line ending style, BOM and final newline of the content
+//
+// DetectEndings 返回内容的换行符风格、BOM 和末尾换行
+func DetectEndings(content []byte) *Endings {
+	crlf := bytes.Count(content, []byte("\r\n"))
+	lf := bytes.Count(content, []byte("\n")) - crlf
+	endings := &Endings{
+		BOM:          bytes.HasPrefix(content, utf8BOM),
+		FinalNewline: bytes.HasSuffix(content, []byte("\n")),
+	}
+	switch {
+	case crlf > 0 && lf > 0:
+		endings.LineEnding = LineEndingMixed
+	case crlf > 0:
+		endings.LineEnding = LineEndingCRLF
+	case lf > 0:
+		endings.LineEnding = LineEndingLF
+	}
+	return endings
+}
+
+// ApplyEndings gives the formatted content the line endings, BOM and final newline the policy asks for
+// Preserved fields follow the original content, mixed original endings are left as formatted
+//
+// ApplyEndings 使格式化后的内容具有策略要求的换行符、BOM 和末尾换行
+// 保持的字段以原始内容为准，原始内容换行符混用时保持格式化后的样子
+func ApplyEndings(original []byte, formatted []byte, policy *EndingPolicy) []byte {
+	if len(formatted) == 0 {
+		return formatted
+	}
+	before := DetectEndings(original)
+
+	lineEnding := policy.LineEnding
+	if lineEnding == LineEndingPreserve {
+		lineEnding = before.LineEnding
+	}
+	bom := policy.BOM == PresenceAdd || (policy.BOM == PresencePreserve && before.BOM)
+	finalNewline := policy.FinalNewline == PresenceAdd || (policy.FinalNewline == PresencePreserve && before.FinalNewline)
+
+	content := bytes.TrimPrefix(formatted, utf8BOM)
+	switch lineEnding {
+	case LineEndingLF:
+		content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	case LineEndingCRLF:
+		content = bytes.ReplaceAll(bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+	}
+	newline := []byte("\n")
+	if lineEnding == LineEndingCRLF || (lineEnding != LineEndingLF && bytes.HasSuffix(content, []byte("\r\n"))) {
+		newline = []byte("\r\n")
+	}
+	switch {
+	case finalNewline && !bytes.HasSuffix(content, []byte("\n")):
+		content = append(bytes.Clone(content), newline...)
+	case !finalNewline && bytes.HasSuffix(content, []byte("\n")):
+		content = bytes.TrimSuffix(bytes.TrimSuffix(content, []byte("\n")), []byte("\r"))
+	}
+	if bom {
+		content = append(bytes.Clone(utf8BOM), content...)
+	}
+	return content
+}
+
+// EndingChange reports a file whose line endings, BOM or final newline were changed by WriteFile
+//
+// EndingChange 报告 WriteFile 改变了换行符、BOM 或末尾换行的文件
+type EndingChange struct {
+	Path   string   // File path // 文件路径
+	Before *Endings // Endings of the original content // 原始内容的换行状态
+	After  *Endings // Endings of the written content // 写入内容的换行状态
+}
+
+func (c *EndingChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, c.Before, c.After)
+}
+
+// endingReports collects the EndingChange reports of the files written with one Options
+// endingReports 收集使用同一 Options 写入的文件的 EndingChange 报告
+type endingReports struct {
+	mutex   sync.Mutex
+	changes []*EndingChange
+}
+
+// report collects an EndingChange when the endings of the content differ
+// report 在内容的换行状态不同时收集 EndingChange
+func (r *endingReports) report(path string, original []byte, content []byte) {
+	before := DetectEndings(original)
+	after := DetectEndings(content)
+	if *before == *after {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.changes = append(r.changes, &EndingChange{Path: path, Before: before, After: after})
+}
+
+// take returns the collected reports and clears them
+// take 返回已收集的报告并清空
+func (r *endingReports) take() []*EndingChange {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	changes := r.changes
+	r.changes = nil
+	return changes
+}
+
+// endingPolicyFor returns the EndingPolicy of the options with the .editorconfig settings of the file applied
+// endingPolicyFor 返回应用了该文件 .editorconfig 设置的 options 的 EndingPolicy
+func (o *Options) endingPolicyFor(path string) (*EndingPolicy, error) {
+	policy := *o.endingPolicy
+	if !policy.EditorConfig {
+		return &policy, nil
+	}
+	properties, err := EditorConfigProperties(path)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	switch properties["end_of_line"] {
+	case "lf":
+		policy.LineEnding = LineEndingLF
+	case "crlf":
+		policy.LineEnding = LineEndingCRLF
+	}
+	switch properties["charset"] {
+	case "utf-8-bom":
+		policy.BOM = PresenceAdd
+	case "utf-8", "latin1":
+		policy.BOM = PresenceRemove
+	}
+	switch properties["insert_final_newline"] {
+	case "true":
+		policy.FinalNewline = PresenceAdd
+	case "false":
+		policy.FinalNewline = PresenceRemove
+	}
+	return &policy, nil
+}
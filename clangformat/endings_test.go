@@ -0,0 +1,119 @@
+package clangformat_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+func TestDetectEndings(t *testing.T) {
+	endings := clangformat.DetectEndings([]byte("\ufeffint a;\r\nint b;\r\n"))
+	require.Equal(t, clangformat.LineEndingCRLF, endings.LineEnding)
+	require.True(t, endings.BOM)
+	require.True(t, endings.FinalNewline)
+
+	endings = clangformat.DetectEndings([]byte("int a;\r\nint b;\nint c;"))
+	require.Equal(t, clangformat.LineEndingMixed, endings.LineEnding)
+	require.False(t, endings.BOM)
+	require.False(t, endings.FinalNewline)
+}
+
+func TestApplyEndingsPreserve(t *testing.T) {
+	// 格式化结果为 LF 且丢失了 BOM 和末尾换行时，恢复原始文件的状态
+	original := []byte("\ufeffint  a;\r\nint  b;\r\n")
+	formatted := []byte("int a;\nint b;")
+	output := clangformat.ApplyEndings(original, formatted, clangformat.NewEndingPolicy())
+	require.Equal(t, "\ufeffint a;\r\nint b;\r\n", string(output))
+
+	// 原始文件没有末尾换行时同样保持
+	output = clangformat.ApplyEndings([]byte("int  a;"), []byte("int a;\n"), clangformat.NewEndingPolicy())
+	require.Equal(t, "int a;", string(output))
+
+	// 显式设置为添加时才添加末尾换行
+	policy := &clangformat.EndingPolicy{FinalNewline: clangformat.PresenceAdd}
+	output = clangformat.ApplyEndings([]byte("int  a;"), []byte("int a;"), policy)
+	require.Equal(t, "int a;\n", string(output))
+}
+
+func TestApplyEndingsPolicy(t *testing.T) {
+	// 显式策略统一换行符、删除 BOM 并添加末尾换行
+	policy := &clangformat.EndingPolicy{
+		LineEnding:   clangformat.LineEndingLF,
+		BOM:          clangformat.PresenceRemove,
+		FinalNewline: clangformat.PresenceAdd,
+	}
+	output := clangformat.ApplyEndings([]byte("\ufeffint  a;\r\nint  b;"), []byte("\ufeffint a;\r\nint b;"), policy)
+	require.Equal(t, "int a;\nint b;\n", string(output))
+
+	policy = &clangformat.EndingPolicy{LineEnding: clangformat.LineEndingCRLF, BOM: clangformat.PresenceAdd}
+	output = clangformat.ApplyEndings([]byte("int a;\n"), []byte("int a;\nint b;\n"), policy)
+	require.Equal(t, "\ufeffint a;\r\nint b;\r\n", string(output))
+}
+
+func TestEditorConfigProperties(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-editorconfig-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	must.Done(os.MkdirAll(filepath.Join(tempDIR, "src", "win"), 0755))
+	must.Done(os.WriteFile(filepath.Join(tempDIR, ".editorconfig"), []byte(`root = true
+
+[*]
+end_of_line = lf
+insert_final_newline = true
+
+[*.{h,cc}]
+charset = utf-8
+
+[src/win/**.h]
+end_of_line = CRLF
+`), 0644))
+	// 更近的 .editorconfig 覆盖上级目录的设置
+	must.Done(os.WriteFile(filepath.Join(tempDIR, "src", ".editorconfig"), []byte("[legacy.h]\ncharset = utf-8-bom\n"), 0644))
+
+	properties := rese.V1(clangformat.EditorConfigProperties(filepath.Join(tempDIR, "src", "win", "demo.h")))
+	require.Equal(t, "crlf", properties["end_of_line"])
+	require.Equal(t, "utf-8", properties["charset"])
+	require.Equal(t, "true", properties["insert_final_newline"])
+
+	properties = rese.V1(clangformat.EditorConfigProperties(filepath.Join(tempDIR, "src", "legacy.h")))
+	require.Equal(t, "lf", properties["end_of_line"])
+	require.Equal(t, "utf-8-bom", properties["charset"])
+
+	properties = rese.V1(clangformat.EditorConfigProperties(filepath.Join(tempDIR, "demo.proto")))
+	require.Equal(t, "lf", properties["end_of_line"])
+	require.Empty(t, properties["charset"])
+}
+
+func TestWriteFileEndings(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-write-endings-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	must.Done(os.WriteFile(filepath.Join(tempDIR, ".editorconfig"), []byte("root = true\n\n[*.h]\nend_of_line = lf\n"), 0644))
+	header := filepath.Join(tempDIR, "demo.h")
+	source := filepath.Join(tempDIR, "demo.cc")
+	must.Done(os.WriteFile(header, []byte("int  a;\r\n"), 0644))
+	must.Done(os.WriteFile(source, []byte("int  b;\r\n"), 0644))
+
+	options := clangformat.NewOptions().WithEndingPolicy(&clangformat.EndingPolicy{EditorConfig: true})
+
+	// .h 文件按 .editorconfig 转为 LF，.cc 文件保持原有的 CRLF
+	must.Done(options.WriteFile(header, []byte("int a;\r\n")))
+	must.Done(options.WriteFile(source, []byte("int b;\n")))
+	require.Equal(t, "int a;\n", string(rese.V1(os.ReadFile(header))))
+	require.Equal(t, "int b;\r\n", string(rese.V1(os.ReadFile(source))))
+
+	// 只报告换行状态发生变化的文件
+	changes := options.TakeEndingChanges()
+	require.Len(t, changes, 1)
+	require.Equal(t, rese.V1(filepath.EvalSymlinks(header)), changes[0].Path)
+	require.Equal(t, clangformat.LineEndingCRLF, changes[0].Before.LineEnding)
+	require.Equal(t, clangformat.LineEndingLF, changes[0].After.LineEnding)
+	require.Empty(t, options.TakeEndingChanges())
+}
@@ -0,0 +1,161 @@
+package clangformat
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/yyle88/erero"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// Execution is the result of running a command through an Executor
+//
+// Execution 是通过 Executor 运行命令的结果
+type Execution struct {
+	Stdout   []byte // Standard output // 标准输出
+	Stderr   []byte // Standard error // 标准错误
+	ExitCode int    // Exit code, 0 on success // 退出码，成功时为 0
+}
+
+// Executor runs the clang-format binary for the formatting functions of this package
+// A command that runs and exits with a non-zero code is reported through ExitCode, error means it could not run at all
+// The config carries the working DIR and environment, executors not running local processes may ignore it
+//
+// Executor 为本包中的格式化函数运行 clang-format 程序
+// 命令运行后以非零退出码结束时通过 ExitCode 报告，error 表示命令根本无法运行
+// config 携带工作目录和环境变量，不运行本地进程的执行器可以忽略它
+type Executor interface {
+	Execute(config *osexec.ExecConfig, name string, args []string, stdin []byte) (*Execution, error)
+}
+
+// NewOsexecExecutor creates the Executor running local processes with the DIR and envs of the osexec config
+// Stdout and stderr are captured apart, so warnings on stderr never mix into the formatted content
+//
+// NewOsexecExecutor 创建使用 osexec config 的目录和环境变量运行本地进程的 Executor
+// 标准输出和标准错误分开捕获，标准错误中的警告不会混入格式化内容
+func NewOsexecExecutor() Executor {
+	return &osexecExecutor{}
+}
+
+type osexecExecutor struct{}
+
+func (e *osexecExecutor) Execute(config *osexec.ExecConfig, name string, args []string, stdin []byte) (*Execution, error) {
+	if config == nil {
+		config = osexec.NewExecConfig()
+	}
+	command := exec.Command(name, args...)
+	command.Dir = config.Path
+	if len(config.Envs) > 0 {
+		command.Env = append(os.Environ(), config.Envs...)
+	}
+	if stdin != nil {
+		command.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if config.IsShowCommand() {
+		zaplog.LOG.Debug("exec", zap.String("path", config.Path), zap.String("name", name), zap.Strings("args", args))
+	}
+	if err := command.Run(); err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			return &Execution{Stdout: stdout.Bytes(), Stderr: stderr.Bytes(), ExitCode: exitError.ExitCode()}, nil
+		}
+		return nil, erero.Wro(err)
+	}
+	return &Execution{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}, nil
+}
+
+// run executes clang-format through the Executor of the options, feeding stdin when it is not nil
+// A non-zero exit code becomes an error carrying the stderr message
+// Only stdout is returned, stderr warnings of a successful run are logged and never reach the formatted content
+//
+// run 通过 options 的 Executor 执行 clang-format，stdin 不为 nil 时将其作为标准输入
+// 非零退出码会转为携带标准错误信息的错误
+// 只返回标准输出，成功运行时标准错误中的警告写入日志，不会进入格式化内容
+func (o *Options) run(config *osexec.ExecConfig, args []string, stdin []byte) (output []byte, err error) {
+	execution, err := o.executor.Execute(config, "clang-format", args, stdin)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if execution.ExitCode != 0 {
+		return nil, erero.Errorf("clang-format exit code %d: %s", execution.ExitCode, strings.TrimSpace(string(execution.Stderr)))
+	}
+	if warning := strings.TrimSpace(string(execution.Stderr)); warning != "" {
+		zaplog.LOG.Warn("clang-format", zap.String("stderr", warning))
+	}
+	return execution.Stdout, nil
+}
+
+// Call records one command run by a FakeExecutor
+//
+// Call 记录 FakeExecutor 运行的一条命令
+type Call struct {
+	Path  string   // Working DIR taken from the config // 取自 config 的工作目录
+	Name  string   // Command name, such as clang-format // 命令名称，例如 clang-format
+	Args  []string // Command args // 命令参数
+	Stdin []byte   // Standard input, nil when none // 标准输入，没有时为 nil
+}
+
+// FakeExecutor is a scriptable Executor recording its calls, no process is started
+// The script decides the Execution of each call, the default script echoes stdin back, leaving content as it is
+// Safe for concurrent use
+//
+// FakeExecutor 是可编写脚本并记录调用的 Executor，不会启动任何进程
+// 脚本决定每次调用的 Execution，默认脚本原样返回标准输入，使内容保持不变
+// 支持并发使用
+type FakeExecutor struct {
+	mutex  sync.Mutex
+	script func(call *Call) (*Execution, error)
+	calls  []*Call
+}
+
+// NewFakeExecutor creates a FakeExecutor echoing stdin back
+//
+// NewFakeExecutor 创建原样返回标准输入的 FakeExecutor
+func NewFakeExecutor() *FakeExecutor {
+	return &FakeExecutor{
+		script: func(call *Call) (*Execution, error) {
+			return &Execution{Stdout: call.Stdin}, nil
+		},
+	}
+}
+
+// WithScript sets the script deciding the Execution of each call and returns the updated FakeExecutor
+//
+// WithScript 设置决定每次调用 Execution 的脚本并返回更新后的 FakeExecutor
+func (f *FakeExecutor) WithScript(script func(call *Call) (*Execution, error)) *FakeExecutor {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.script = script
+	return f
+}
+
+func (f *FakeExecutor) Execute(config *osexec.ExecConfig, name string, args []string, stdin []byte) (*Execution, error) {
+	call := &Call{Name: name, Args: slices.Clone(args), Stdin: bytes.Clone(stdin)}
+	if config != nil {
+		call.Path = config.Path
+	}
+	f.mutex.Lock()
+	f.calls = append(f.calls, call)
+	script := f.script
+	f.mutex.Unlock()
+	return script(call)
+}
+
+// Calls returns the calls recorded so far, in order
+//
+// Calls 按顺序返回目前记录的调用
+func (f *FakeExecutor) Calls() []*Call {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return slices.Clone(f.calls)
+}
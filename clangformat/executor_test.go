@@ -0,0 +1,116 @@
+package clangformat_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/rese"
+)
+
+// upperScript is a FakeExecutor script uppercasing the content, as stdin or as replacement documents of the file args
+// Content containing "broken" fails like clang-format does on invalid input
+//
+// upperScript 是将内容转为大写的 FakeExecutor 脚本，内容来自标准输入或文件参数的替换文档
+// 包含 "broken" 的内容会像 clang-format 处理无效输入时一样失败
+func upperScript(call *clangformat.Call) (*clangformat.Execution, error) {
+	if !slices.Contains(call.Args, "--output-replacements-xml") {
+		if bytes.Contains(call.Stdin, []byte("broken")) {
+			return &clangformat.Execution{Stderr: []byte("error: broken input\n"), ExitCode: 1}, nil
+		}
+		return &clangformat.Execution{Stdout: bytes.ToUpper(call.Stdin)}, nil
+	}
+	var output bytes.Buffer
+	for _, path := range call.Args[slices.Index(call.Args, "--")+1:] {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		output.WriteString("<?xml version='1.0'?>\n<replacements xml:space='preserve' incomplete_format='false'>\n")
+		_, _ = fmt.Fprintf(&output, "<replacement offset='0' length='%d'>", len(content))
+		must.Done(xml.EscapeText(&output, bytes.ToUpper(content)))
+		output.WriteString("</replacement>\n</replacements>\n")
+	}
+	return &clangformat.Execution{Stdout: output.Bytes()}, nil
+}
+
+func TestFakeExecutor(t *testing.T) {
+	fake := clangformat.NewFakeExecutor().WithScript(upperScript)
+	options := clangformat.NewOptions().WithExecutor(fake)
+
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-executor-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+	config := osexec.NewExecConfig().WithPath(tempDIR)
+
+	// 内存格式化通过标准输入传递内容
+	output := rese.V1(options.DryRunSource(config, []byte("int x;\n"), "demo.cc", clangformat.NewStyle()))
+	require.Equal(t, "INT X;\n", string(output))
+	calls := fake.Calls()
+	require.Len(t, calls, 1)
+	require.Equal(t, tempDIR, calls[0].Path)
+	require.Equal(t, "clang-format", calls[0].Name)
+	require.Equal(t, []string{"--assume-filename", "demo.cc", "-style"}, calls[0].Args[:3])
+	require.Equal(t, "int x;\n", string(calls[0].Stdin))
+
+	// 项目格式化在一次运行中以替换文档格式化所有文件
+	for _, name := range []string{"a.cc", "b.cc"} {
+		must.Done(os.WriteFile(filepath.Join(tempDIR, name), []byte("int "+name[:1]+";\n"), 0644))
+	}
+	must.Done(options.FormatProject(config, tempDIR, ".cc", clangformat.NewStyle()))
+	require.Equal(t, "INT A;\n", string(rese.V1(os.ReadFile(filepath.Join(tempDIR, "a.cc")))))
+	require.Equal(t, "INT B;\n", string(rese.V1(os.ReadFile(filepath.Join(tempDIR, "b.cc")))))
+	require.Len(t, fake.Calls(), 2)
+
+	// 非零退出码转为携带标准错误信息的错误，文件保持不变
+	path := filepath.Join(tempDIR, "broken.cc")
+	must.Done(os.WriteFile(path, []byte("broken\n"), 0644))
+	_, err := options.FormatAs(config, path, ".cc", clangformat.NewStyle())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "exit code 1: error: broken input")
+	require.Equal(t, "broken\n", string(rese.V1(os.ReadFile(path))))
+
+	// 默认脚本原样返回标准输入
+	require.Equal(t, "int x;\n", string(rese.V1(clangformat.NewFakeExecutor().Execute(config, "clang-format", nil, []byte("int x;\n"))).Stdout))
+}
+
+func TestOsexecExecutor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("runs sh commands")
+	}
+	executor := clangformat.NewOsexecExecutor()
+
+	// 标准输入被传给进程，成功时输出作为 Stdout 报告
+	execution := rese.P1(executor.Execute(osexec.NewExecConfig(), "cat", nil, []byte("int x;\n")))
+	require.Equal(t, "int x;\n", string(execution.Stdout))
+	require.Equal(t, 0, execution.ExitCode)
+
+	// 同时写两个流的进程，标准错误不会混入标准输出
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-osexec-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+	config := osexec.NewExecConfig().WithPath(tempDIR).WithEnvs([]string{"DEMO_VALUE=demo"})
+	execution = rese.P1(executor.Execute(config, "sh", []string{"-c", "echo warning >&2; cat; echo $DEMO_VALUE; pwd -P"}, []byte("int x;\n")))
+	require.Equal(t, 0, execution.ExitCode)
+	require.Equal(t, "warning\n", string(execution.Stderr))
+	workDIR := rese.V1(filepath.EvalSymlinks(tempDIR))
+	require.Equal(t, "int x;\ndemo\n"+workDIR+"\n", string(execution.Stdout))
+
+	// 非零退出码不是错误，两个流分别报告
+	execution = rese.P1(executor.Execute(nil, "sh", []string{"-c", "echo partial; echo oops >&2; exit 3"}, nil))
+	require.Equal(t, 3, execution.ExitCode)
+	require.Equal(t, "partial\n", string(execution.Stdout))
+	require.Equal(t, "oops\n", string(execution.Stderr))
+
+	// 无法运行的命令返回错误
+	_, err := executor.Execute(nil, "clang-format-batch-missing-binary", nil, nil)
+	require.Error(t, err)
+}
@@ -10,7 +10,10 @@
 package clangformat
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/go-xlan/clang-format/internal/utils"
 	"github.com/yyle88/erero"
@@ -61,31 +64,150 @@ func NewStyle() *Style {
 // 返回格式化内容作为输出字节供检查
 // 适用于在应用更改之前验证格式化效果
 func DryRun(config *osexec.ExecConfig, protoPath string, style *Style) (output []byte, err error) {
-	return run(config, []string{protoPath, "-style", neatjsons.Sjson(style)})
+	return NewOptions().DryRun(config, protoPath, style)
 }
 
-// Format executes clang-format with in-place modification flag (-i)
-// Applies formatting changes to the target file
+// DryRun previews the formatting like the package DryRun, with the settings of the options
+// ObjC .h and extensionless headers are passed in the language detected from their content
+//
+// DryRun 像包级 DryRun 一样预览格式化结果，使用 options 的设置
+// ObjC 的 .h 和无扩展名头文件按照根据内容检测到的语言传入
+func (o *Options) DryRun(config *osexec.ExecConfig, protoPath string, style *Style) (output []byte, err error) {
+	source, err := os.ReadFile(protoPath)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return o.DryRunSource(config, source, languageFilename(protoPath, source), style)
+}
+
+// Format formats the target file and writes the result back through WriteFile
+// clang-format writes to stdout, the library replaces the file atomically and only when the content changes
 // Use clang-format --help to see all available options and flags
 //
-// Format 使用就地修改标志 (-i) 执行 clang-format
-// 直接对目标文件应用格式化更改
+// Format 格式化目标文件并通过 WriteFile 写回结果
+// clang-format 输出到标准输出，由本库在内容变化时原子地替换文件
 // 使用 clang-format --help 查看所有可用选项和标志
 func Format(config *osexec.ExecConfig, protoPath string, style *Style) (output []byte, err error) {
-	return run(config, []string{"-i", protoPath, "-style", neatjsons.Sjson(style)})
+	return NewOptions().Format(config, protoPath, style)
+}
+
+// Format formats the file like the package Format, with the settings of the options
+// ObjC .h and extensionless headers are passed in the language detected from their content
+//
+// Format 像包级 Format 一样格式化文件，使用 options 的设置
+// ObjC 的 .h 和无扩展名头文件按照根据内容检测到的语言传入
+func (o *Options) Format(config *osexec.ExecConfig, protoPath string, style *Style) (output []byte, err error) {
+	return o.formatSource(config, protoPath, "", style, false)
+}
+
+// DryRunSource formats the source content in memory through stdin
+// The assumeFilename tells clang-format the language and where to search .clang-format files
+// Returns the formatted content without touching any file
+//
+// DryRunSource 通过标准输入在内存中格式化源码内容
+// assumeFilename 告诉 clang-format 使用的语言以及查找 .clang-format 文件的位置
+// 返回格式化内容，不会修改任何文件
+func DryRunSource(config *osexec.ExecConfig, source []byte, assumeFilename string, style *Style) (output []byte, err error) {
+	return NewOptions().DryRunSource(config, source, assumeFilename, style)
+}
+
+// DryRunSource formats the content like the package DryRunSource, with the settings of the options
+// DryRunSource 像包级 DryRunSource 一样格式化内容，使用 options 的设置
+func (o *Options) DryRunSource(config *osexec.ExecConfig, source []byte, assumeFilename string, style *Style) (output []byte, err error) {
+	return o.run(config, []string{"--assume-filename", assumeFilename, "-style", neatjsons.Sjson(style)}, source)
+}
+
+// DryRunLines formats only the lines first to last (1-based, inclusive) of the source content in memory
+// Lines outside the range are returned as they are, used by editors formatting a selection or the line being typed
+//
+// DryRunLines 在内存中只格式化源码内容的第 first 到 last 行（从 1 开始，包含两端）
+// 范围以外的行原样返回，用于编辑器格式化选中内容或正在输入的行
+func DryRunLines(config *osexec.ExecConfig, source []byte, assumeFilename string, style *Style, first int, last int) (output []byte, err error) {
+	return NewOptions().DryRunLines(config, source, assumeFilename, style, first, last)
+}
+
+// DryRunLines formats the line range like the package DryRunLines, with the settings of the options
+// DryRunLines 像包级 DryRunLines 一样格式化行范围，使用 options 的设置
+func (o *Options) DryRunLines(config *osexec.ExecConfig, source []byte, assumeFilename string, style *Style, first int, last int) (output []byte, err error) {
+	return o.run(config, []string{"--assume-filename", assumeFilename, "--lines", fmt.Sprintf("%d:%d", first, last), "-style", neatjsons.Sjson(style)}, source)
+}
+
+// DryRunAs formats the file content as if the file had the given extension
+// Used on files whose extension does not tell the real language, such as extensionless headers
+// The original file is not modified
+//
+// DryRunAs 将文件内容按照给定扩展名的语言进行格式化
+// 用于扩展名无法表明真实语言的文件，例如无扩展名的头文件
+// 不会修改原始文件
+func DryRunAs(config *osexec.ExecConfig, path string, extension string, style *Style) (output []byte, err error) {
+	return NewOptions().DryRunAs(config, path, extension, style)
+}
+
+// DryRunAs previews the file like the package DryRunAs, with the settings of the options
+// DryRunAs 像包级 DryRunAs 一样预览文件，使用 options 的设置
+func (o *Options) DryRunAs(config *osexec.ExecConfig, path string, extension string, style *Style) (output []byte, err error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return o.DryRunSource(config, source, path+extension, style)
 }
 
-// run executes the clang-format command with specified arguments
-// Requires clang-format to be installed and accessible in PATH
-// Installation: brew install clang-format (macOS) or equivalent package manager
-// Verification: clang-format --version
+// FormatAs formats the file as if it had the given extension and writes the result back
+// Writes only when the content changes, through WriteFile
 //
-// run 使用指定参数执行 clang-format 命令
-// 需要安装 clang-format 并在 PATH 中可访问
-// 安装: brew install clang-format (macOS) 或等效的包管理器
-// 验证: clang-format --version
-func run(config *osexec.ExecConfig, args []string) (output []byte, err error) {
-	return config.Exec("clang-format", args...)
+// FormatAs 将文件按照给定扩展名的语言格式化并写回结果
+// 仅在内容变化时通过 WriteFile 写入
+func FormatAs(config *osexec.ExecConfig, path string, extension string, style *Style) (output []byte, err error) {
+	return NewOptions().FormatAs(config, path, extension, style)
+}
+
+// FormatAs formats the file like the package FormatAs, with the settings of the options
+// FormatAs 像包级 FormatAs 一样格式化文件，使用 options 的设置
+func (o *Options) FormatAs(config *osexec.ExecConfig, path string, extension string, style *Style) (output []byte, err error) {
+	return o.formatSource(config, path, path+extension, style, false)
+}
+
+// formatSource formats the file content through stdin and writes the result back when it changes
+// An empty assumeFilename is detected from the path and content through languageFilename
+// With verify set, the result is checked with Verify first and the file is left untouched on mismatch
+// Content recorded in the Cache of the options is skipped, and the written content is recorded into it
+//
+// formatSource 通过标准输入格式化文件内容，内容变化时写回结果
+// assumeFilename 为空时通过 languageFilename 根据路径和内容检测
+// verify 为 true 时先使用 Verify 检查结果，不一致时文件保持不变
+// 已记录在 options 的 Cache 中的内容会被跳过，写入后的内容会记录到其中
+func (o *Options) formatSource(config *osexec.ExecConfig, path string, assumeFilename string, style *Style, verify bool) (output []byte, err error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if assumeFilename == "" {
+		assumeFilename = languageFilename(path, source)
+	}
+	policy, err := o.endingPolicyFor(path)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if o.cache.lookup(path, assumeFilename, source, style, policy) {
+		return nil, nil
+	}
+	output, err = o.DryRunSource(config, source, assumeFilename, style)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if verify {
+		if err := Verify(path, source, output); err != nil {
+			return nil, err
+		}
+	}
+	// WriteFile applies the ending policy and skips the write when the content stays the same
+	// WriteFile 应用换行策略，内容不变时跳过写入
+	if err := o.WriteFile(path, output); err != nil {
+		return nil, erero.Wro(err)
+	}
+	o.cache.store(path, assumeFilename, style, policy)
+	return nil, nil
 }
 
 // FormatProject executes clang-format on files with specified extension in a project directory
@@ -98,20 +220,92 @@ func run(config *osexec.ExecConfig, args []string) (output []byte, err error) {
 // 接受单个扩展名参数，一次处理一种文件类型
 // 如果在项目导航过程中任何格式化操作失败则返回错误
 func FormatProject(config *osexec.ExecConfig, projectPath string, extension string, style *Style) error {
+	return NewOptions().FormatProject(config, projectPath, extension, style)
+}
+
+// FormatProject formats the project like the package FormatProject, with the settings of the options
+// FormatProject 像包级 FormatProject 一样格式化项目，使用 options 的设置
+func (o *Options) FormatProject(config *osexec.ExecConfig, projectPath string, extension string, style *Style) error {
+	return o.formatProject(config, projectPath, extension, style, false)
+}
+
+// formatProject walks the project and formats each file, with the guard when verify is set
+// Files clang-format recognizes by name are formatted in batches through formatFiles, the others one by one through stdin
+//
+// formatProject 遍历项目并格式化每个文件，verify 为 true 时启用保护
+// clang-format 能根据文件名识别语言的文件通过 formatFiles 分批格式化，其余文件逐个通过标准输入格式化
+func (o *Options) formatProject(config *osexec.ExecConfig, projectPath string, extension string, style *Style, verify bool) error {
+	var paths []string
 	if err := utils.WalkFilesWithExt(projectPath, extension, func(path string, info os.FileInfo) error {
 		zaplog.LOG.Debug("clang-format", zap.String("path", path))
 		osmustexist.MustFile(path)
 
-		output, err := Format(config, path, style)
+		assumeFilename, err := detectAssumeFilename(path, extension)
 		if err != nil {
 			return erero.Wro(err)
 		}
-		if len(output) > 0 {
-			zaplog.LOG.Debug("clang-format", zap.String("path", path), zap.ByteString("output", output))
+		switch assumeFilename {
+		case "":
+			return nil
+		case path:
+			paths = append(paths, path)
+			return nil
+		default:
+			if _, err := o.formatSource(config, path, assumeFilename, style, verify); err != nil {
+				return erero.Wro(err)
+			}
+			return nil
 		}
-		return nil
 	}); err != nil {
 		return erero.Wro(err)
 	}
+	if err := o.formatFiles(config, paths, style, verify); err != nil {
+		return erero.Wro(err)
+	}
 	return nil
 }
+
+// detectAssumeFilename returns the file name telling clang-format the language of the file
+// .h and extensionless files get the language detected from content, the path itself is returned for the other files
+// Returns empty when an extensionless file is in no known language
+//
+// detectAssumeFilename 返回告诉 clang-format 文件语言的文件名
+// .h 和无扩展名文件根据内容检测语言，其他文件返回路径本身
+// 无扩展名文件不属于任何已知语言时返回空
+func detectAssumeFilename(path string, extension string) (string, error) {
+	if extension != ".h" && extension != "" {
+		return path, nil
+	}
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	if extension == "" && DetectLanguage(source) == "" {
+		zaplog.LOG.Debug("clang-format", zap.String("path", path), zap.String("skip", "unknown language"))
+		return "", nil
+	}
+	return languageFilename(path, source), nil
+}
+
+// languageFilename returns the file name telling clang-format the language of the content at the path
+// ObjC .h and extensionless files get .m appended, extensionless C/C++ files get .h, the path itself is returned for the others
+// Shared by every entry point, so a header is formatted in the same language whichever way it comes in
+//
+// languageFilename 返回告诉 clang-format 该路径内容语言的文件名
+// ObjC 的 .h 和无扩展名文件追加 .m，无扩展名的 C/C++ 文件追加 .h，其他文件返回路径本身
+// 由所有入口共用，使头文件无论从哪个入口进入都按相同的语言格式化
+func languageFilename(path string, source []byte) string {
+	extension := strings.ToLower(filepath.Ext(path))
+	if extension != ".h" && extension != "" {
+		return path
+	}
+	switch DetectLanguage(source) {
+	case "ObjC":
+		return path + ".m"
+	case "Cpp":
+		if extension == "" {
+			return path + ".h"
+		}
+	}
+	return path
+}
@@ -185,3 +185,45 @@ return x+y;
 	// 验证格式化发生了变化
 	require.NotEqual(t, strings.TrimSpace(originalContent), strings.TrimSpace(string(output)))
 }
+
+func TestClangFormatDryRunAs(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-as-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	// 创建一个无扩展名的 C++ 头文件，类似标准库头文件
+	headerFile := filepath.Join(tempDIR, "vector")
+	const originalContent = `// -*- C++ -*-
+#pragma once
+namespace demo{
+template<class T> class vector{
+public:
+int size()const{return 0;}
+};
+}`
+
+	must.Done(os.WriteFile(headerFile, []byte(originalContent), 0644))
+	require.Equal(t, "Cpp", clangformat.DetectLanguage([]byte(originalContent)))
+
+	// 按照 .h 语言预览格式化结果
+	execConfig := osexec.NewExecConfig().WithDebug()
+	output, err := clangformat.DryRunAs(execConfig, headerFile, ".h", clangformat.NewStyle())
+	require.NoError(t, err)
+	t.Log(string(output))
+
+	const expectedResult = `// -*- C++ -*-
+#pragma once
+namespace demo {
+template <class T>
+class vector {
+ public:
+  int size() const { return 0; }
+};
+}  // namespace demo
+`
+	require.Equal(t, strings.TrimSpace(expectedResult), strings.TrimSpace(string(output)))
+
+	// 直接格式化文件，文件内容应与预览结果一致
+	rese.V1(clangformat.FormatAs(execConfig, headerFile, ".h", clangformat.NewStyle()))
+	require.Equal(t, string(output), string(rese.V1(os.ReadFile(headerFile))))
+}
@@ -0,0 +1,350 @@
+package clangformat
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yyle88/erero"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// runIDLayout formats the start time of a run into its ID, IDs sort in start order
+// runIDLayout 将运行的开始时间格式化为其 ID，ID 按开始顺序排序
+const runIDLayout = "20060102-150405.000"
+
+// journalName is the file listing the backups of a run, one JSON entry per line
+// journalName 是列出一次运行备份的文件，每行一个 JSON 条目
+const journalName = "journal.jsonl"
+
+// DefaultBackupDIR returns the DIR where backup journals are kept when none is given
+// Located in the user cache DIR so backups survive git clean and cover untracked files
+//
+// DefaultBackupDIR 返回未指定时保存备份日志的目录
+// 位于用户缓存目录中，使备份不受 git clean 影响并覆盖未跟踪的文件
+func DefaultBackupDIR() (string, error) {
+	cacheDIR, err := os.UserCacheDir()
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	return filepath.Join(cacheDIR, "clang-format-batch", "backups"), nil
+}
+
+// Journal records the original content of each file written by WriteFile under a run ID
+// Backups are written before the file is replaced, so a crashed run can still be undone
+//
+// Journal 以运行 ID 记录 WriteFile 写入的每个文件的原始内容
+// 备份在文件被替换之前写入，因此崩溃的运行同样可以撤销
+type Journal struct {
+	RunID   string // ID of the run // 运行的 ID
+	dir     string
+	mutex   sync.Mutex
+	entries []*BackupEntry
+}
+
+// BackupEntry is the original state of one file in a run
+//
+// BackupEntry 是一次运行中某个文件的原始状态
+type BackupEntry struct {
+	Path    string      `json:"path"`    // Absolute path of the file // 文件的绝对路径
+	Backup  string      `json:"backup"`  // Backup file name inside the run DIR // 运行目录中的备份文件名
+	Mode    os.FileMode `json:"mode"`    // Original permissions // 原始权限
+	ModTime time.Time   `json:"modTime"` // Original mtime // 原始修改时间
+	Written string      `json:"written"` // SHA-256 of the content the run left behind // 运行最终写入内容的 SHA-256
+}
+
+// Run describes a recorded run in the backup DIR
+//
+// Run 描述备份目录中记录的一次运行
+type Run struct {
+	ID      string         // Run ID // 运行 ID
+	Started time.Time      // Start time parsed from the ID // 从 ID 解析的开始时间
+	Entries []*BackupEntry // Backed up files in write order // 按写入顺序排列的已备份文件
+}
+
+// OpenJournal starts a new run in the backup DIR, set it on the Options with WithJournal to record the written files into it
+//
+// OpenJournal 在备份目录中开始一次新的运行，通过 WithJournal 设置到 Options 上以将写入的文件记录其中
+func OpenJournal(backupDIR string) (*Journal, error) {
+	if err := os.MkdirAll(backupDIR, 0700); err != nil {
+		return nil, erero.Wro(err)
+	}
+	runID := time.Now().Format(runIDLayout)
+	dir := filepath.Join(backupDIR, runID)
+	for idx := 2; ; idx++ {
+		err := os.Mkdir(dir, 0700)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return nil, erero.Wro(err)
+		}
+		runID = fmt.Sprintf("%s-%d", time.Now().Format(runIDLayout), idx)
+		dir = filepath.Join(backupDIR, runID)
+	}
+	return &Journal{RunID: runID, dir: dir}, nil
+}
+
+// Close ends the run, a run that backed up no file is removed
+// Returns the number of backed up files
+//
+// Close 结束本次运行，没有备份任何文件的运行会被删除
+// 返回已备份的文件数量
+func (j *Journal) Close() (int, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if len(j.entries) == 0 {
+		if err := os.RemoveAll(j.dir); err != nil {
+			return 0, erero.Wro(err)
+		}
+	}
+	return len(j.entries), nil
+}
+
+// record backs up the file before its first write in the run, a nil Journal records nothing
+// Each write appends the entry again with the hash of the written content, so Undo can tell later edits apart
+//
+// record 在文件于本次运行中首次写入前备份它，nil 的 Journal 不做记录
+// 每次写入都会带着写入内容的哈希再次追加该条目，使 Undo 能够识别之后的修改
+func (j *Journal) record(path string, data []byte, written []byte, info os.FileInfo) error {
+	if j == nil {
+		return nil
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	idx := slices.IndexFunc(j.entries, func(entry *BackupEntry) bool { return entry.Path == path })
+	if idx < 0 {
+		entry := &BackupEntry{
+			Path:    path,
+			Backup:  fmt.Sprintf("%06d%s.bak", len(j.entries)+1, filepath.Ext(path)),
+			Mode:    info.Mode().Perm(),
+			ModTime: info.ModTime(),
+		}
+		if err := os.WriteFile(filepath.Join(j.dir, entry.Backup), data, 0600); err != nil {
+			return erero.Wro(err)
+		}
+		j.entries = append(j.entries, entry)
+		idx = len(j.entries) - 1
+	}
+	entry := j.entries[idx]
+	entry.Written = contentHash(written)
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	file, err := os.OpenFile(filepath.Join(j.dir, journalName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		_ = file.Close()
+		return erero.Wro(err)
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return erero.Wro(err)
+	}
+	if err := file.Close(); err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
+
+// contentHash returns the hex SHA-256 of the content
+// contentHash 返回内容的十六进制 SHA-256
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// ListRuns returns the runs recorded in the backup DIR, newest first
+// Returns nil when the DIR does not exist
+//
+// ListRuns 返回备份目录中记录的运行，最新的在前
+// 目录不存在时返回 nil
+func ListRuns(backupDIR string) ([]*Run, error) {
+	items, err := os.ReadDir(backupDIR)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, erero.Wro(err)
+	}
+	var runs []*Run
+	for _, item := range items {
+		if !item.IsDir() {
+			continue
+		}
+		started, err := time.ParseInLocation(runIDLayout, item.Name()[:min(len(item.Name()), len(runIDLayout))], time.Local)
+		if err != nil {
+			continue // not a run DIR // 不是运行目录
+		}
+		entries, err := readJournal(filepath.Join(backupDIR, item.Name()))
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		runs = append(runs, &Run{ID: item.Name(), Started: started, Entries: entries})
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].ID > runs[j].ID })
+	return runs, nil
+}
+
+// readJournal reads the entries of a run DIR, a missing journal means an empty run
+// A file written several times has several lines, the last one wins
+// A truncated last line, left by a crash during the write, is skipped
+//
+// readJournal 读取运行目录中的条目，缺少日志文件表示空的运行
+// 多次写入的文件有多行记录，以最后一行为准
+// 写入时崩溃留下的不完整最后一行会被跳过
+func readJournal(dir string) ([]*BackupEntry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, journalName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, erero.Wro(err)
+	}
+	var entries []*BackupEntry
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		entry := &BackupEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			zaplog.LOG.Warn("clang-format", zap.String("journal", dir), zap.Error(err))
+			continue
+		}
+		if idx := slices.IndexFunc(entries, func(item *BackupEntry) bool { return item.Path == entry.Path }); idx >= 0 {
+			entries[idx] = entry
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Undo restores the files backed up by the run and removes the run from the backup DIR
+// An empty runID selects the newest run that backed up files, restored files get back their content, permissions and mtime
+// Files deleted since the run are recreated
+// Files edited since the run are not overwritten: nothing is restored and an error lists them, unless force is set
+//
+// Undo 恢复该运行备份的文件，并从备份目录中删除该运行
+// runID 为空时选择备份了文件的最新运行，恢复的文件取回其内容、权限和修改时间
+// 运行之后被删除的文件会被重新创建
+// 运行之后被编辑过的文件不会被覆盖：不恢复任何文件并返回列出这些文件的错误，除非设置了 force
+func Undo(backupDIR string, runID string, force bool) (*Run, error) {
+	runs, err := ListRuns(backupDIR)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	var run *Run
+	if runID == "" {
+		// runs that crashed before backing up a file have nothing to restore
+		// 在备份文件之前崩溃的运行没有可恢复的内容
+		idx := slices.IndexFunc(runs, func(run *Run) bool { return len(run.Entries) > 0 })
+		if idx < 0 {
+			return nil, erero.Errorf("no backup runs in %s", backupDIR)
+		}
+		run = runs[idx]
+	} else {
+		idx := slices.IndexFunc(runs, func(run *Run) bool { return run.ID == runID })
+		if idx < 0 {
+			return nil, erero.Errorf("backup run %s not found in %s", runID, backupDIR)
+		}
+		run = runs[idx]
+	}
+	dir := filepath.Join(backupDIR, run.ID)
+	backups := make([][]byte, len(run.Entries))
+	var edited []string
+	for idx, entry := range run.Entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Backup))
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		backups[idx] = data
+		current, err := os.ReadFile(entry.Path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, erero.Wro(err)
+		}
+		// the original content means the run crashed before replacing the file
+		// 原始内容表示运行在替换文件之前崩溃
+		if hash := contentHash(current); hash != entry.Written && !bytes.Equal(current, data) {
+			edited = append(edited, entry.Path)
+		}
+	}
+	if len(edited) > 0 && !force {
+		return nil, erero.Errorf("files changed since run %s, not restoring: %s", run.ID, strings.Join(edited, ", "))
+	}
+	for idx := len(run.Entries) - 1; idx >= 0; idx-- {
+		entry := run.Entries[idx]
+		if err := restoreFile(entry, backups[idx]); err != nil {
+			return nil, erero.WithMessage(err, entry.Path)
+		}
+		zaplog.LOG.Debug("clang-format", zap.String("undo", entry.Path), zap.String("run", run.ID))
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, erero.Wro(err)
+	}
+	return run, nil
+}
+
+// restoreFile writes the backup over the file, recreating it when it is gone
+// restoreFile 将备份写回文件，文件已不存在时重新创建
+func restoreFile(entry *BackupEntry, data []byte) error {
+	info, err := os.Stat(entry.Path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return erero.Wro(err)
+		}
+		if err := os.MkdirAll(filepath.Dir(entry.Path), 0755); err != nil {
+			return erero.Wro(err)
+		}
+		if err := os.WriteFile(entry.Path, data, entry.Mode); err != nil {
+			return erero.Wro(err)
+		}
+	} else if err := writeFile(entry.Path, data, info, MtimeUpdate); err != nil {
+		return erero.Wro(err)
+	}
+	if err := os.Chmod(entry.Path, entry.Mode); err != nil {
+		return erero.Wro(err)
+	}
+	if err := os.Chtimes(entry.Path, time.Now(), entry.ModTime); err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
+
+// PruneRuns removes runs older than maxAge and runs beyond the newest maxCount
+// Zero maxAge or maxCount disables that limit, returns the removed run IDs
+//
+// PruneRuns 删除早于 maxAge 的运行以及最新 maxCount 个之外的运行
+// maxAge 或 maxCount 为零时不启用对应限制，返回被删除的运行 ID
+func PruneRuns(backupDIR string, maxAge time.Duration, maxCount int) ([]string, error) {
+	runs, err := ListRuns(backupDIR)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	var removed []string
+	for idx, run := range runs {
+		if (maxAge > 0 && time.Since(run.Started) > maxAge) || (maxCount > 0 && idx >= maxCount) {
+			if err := os.RemoveAll(filepath.Join(backupDIR, run.ID)); err != nil {
+				return nil, erero.Wro(err)
+			}
+			removed = append(removed, run.ID)
+		}
+	}
+	return removed, nil
+}
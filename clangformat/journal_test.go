@@ -0,0 +1,163 @@
+package clangformat_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+func TestJournalUndo(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-journal-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	backupDIR := filepath.Join(tempDIR, "backups")
+	path := filepath.Join(tempDIR, "demo.cc")
+	must.Done(os.WriteFile(path, []byte("int  x;\n"), 0640))
+	must.Done(os.Chmod(path, 0640))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	must.Done(os.Chtimes(path, mtime, mtime))
+
+	// 同一次运行中多次写入同一文件只备份最初的内容
+	journal := rese.P1(clangformat.OpenJournal(backupDIR))
+	options := clangformat.NewOptions().WithJournal(journal)
+	must.Done(options.WriteFile(path, []byte("int x;\n")))
+	must.Done(options.WriteFile(path, []byte("int x; \n")))
+	require.Equal(t, 1, rese.C1(journal.Close()))
+
+	runs := rese.V1(clangformat.ListRuns(backupDIR))
+	require.Len(t, runs, 1)
+	require.Equal(t, journal.RunID, runs[0].ID)
+	require.Len(t, runs[0].Entries, 1)
+	require.Equal(t, rese.V1(filepath.EvalSymlinks(path)), runs[0].Entries[0].Path)
+
+	// 撤销最新的运行，恢复内容、权限和修改时间，并删除该运行
+	run := rese.P1(clangformat.Undo(backupDIR, "", false))
+	require.Equal(t, journal.RunID, run.ID)
+	require.Equal(t, "int  x;\n", string(rese.V1(os.ReadFile(path))))
+	info := rese.V1(os.Stat(path))
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	require.True(t, mtime.Equal(info.ModTime()))
+	require.Empty(t, rese.V1(clangformat.ListRuns(backupDIR)))
+
+	_, err := clangformat.Undo(backupDIR, "", false)
+	require.Error(t, err)
+}
+
+func TestJournalUndoDeletedFile(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-journal-deleted-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	backupDIR := filepath.Join(tempDIR, "backups")
+	path := filepath.Join(tempDIR, "demo.cc")
+	must.Done(os.WriteFile(path, []byte("int  x;\n"), 0644))
+
+	journal := rese.P1(clangformat.OpenJournal(backupDIR))
+	options := clangformat.NewOptions().WithJournal(journal)
+	must.Done(options.WriteFile(path, []byte("int x;\n")))
+	rese.C1(journal.Close())
+
+	// 运行之后被删除的文件在撤销时重新创建
+	must.Done(os.Remove(path))
+	rese.P1(clangformat.Undo(backupDIR, journal.RunID, false))
+	require.Equal(t, "int  x;\n", string(rese.V1(os.ReadFile(path))))
+}
+
+func TestJournalUndoSkipsEmptyRun(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-journal-skip-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	backupDIR := filepath.Join(tempDIR, "backups")
+	path := filepath.Join(tempDIR, "demo.cc")
+	must.Done(os.WriteFile(path, []byte("int  x;\n"), 0644))
+
+	journal := rese.P1(clangformat.OpenJournal(backupDIR))
+	options := clangformat.NewOptions().WithJournal(journal)
+	must.Done(options.WriteFile(path, []byte("int x;\n")))
+	rese.C1(journal.Close())
+
+	// 崩溃的运行在备份文件之前留下的空运行目录，比有内容的运行更新
+	must.Done(os.Mkdir(filepath.Join(backupDIR, "20990101-000000.000"), 0700))
+
+	// 未指定运行 ID 时跳过空运行，撤销备份了文件的最新运行
+	run := rese.P1(clangformat.Undo(backupDIR, "", false))
+	require.Equal(t, journal.RunID, run.ID)
+	require.Equal(t, "int  x;\n", string(rese.V1(os.ReadFile(path))))
+}
+
+func TestJournalUndoEditedFile(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-journal-edited-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	backupDIR := filepath.Join(tempDIR, "backups")
+	path := filepath.Join(tempDIR, "demo.cc")
+	must.Done(os.WriteFile(path, []byte("int  x;\n"), 0644))
+	other := filepath.Join(tempDIR, "other.cc")
+	must.Done(os.WriteFile(other, []byte("int  y;\n"), 0644))
+
+	journal := rese.P1(clangformat.OpenJournal(backupDIR))
+	options := clangformat.NewOptions().WithJournal(journal)
+	must.Done(options.WriteFile(path, []byte("int x;\n")))
+	must.Done(options.WriteFile(other, []byte("int y;\n")))
+	rese.C1(journal.Close())
+
+	// 运行之后被编辑过的文件不会被覆盖，其他文件同样不恢复，运行保留
+	must.Done(os.WriteFile(path, []byte("int x = 1;\n"), 0644))
+	_, err := clangformat.Undo(backupDIR, "", false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), rese.V1(filepath.EvalSymlinks(path)))
+	require.Equal(t, "int x = 1;\n", string(rese.V1(os.ReadFile(path))))
+	require.Equal(t, "int y;\n", string(rese.V1(os.ReadFile(other))))
+	require.Len(t, rese.V1(clangformat.ListRuns(backupDIR)), 1)
+
+	// 强制撤销时丢弃编辑并恢复所有文件
+	rese.P1(clangformat.Undo(backupDIR, "", true))
+	require.Equal(t, "int  x;\n", string(rese.V1(os.ReadFile(path))))
+	require.Equal(t, "int  y;\n", string(rese.V1(os.ReadFile(other))))
+}
+
+func TestJournalEmptyRun(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-journal-empty-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	// 没有写入任何文件的运行在关闭时被删除
+	journal := rese.P1(clangformat.OpenJournal(tempDIR))
+	count, err := journal.Close()
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+	require.Empty(t, rese.V1(os.ReadDir(tempDIR)))
+}
+
+func TestPruneRuns(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-prune-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	for _, runID := range []string{"20200101-000000.000", "20240101-000000.000", "20990101-000000.000", "20990102-000000.000"} {
+		must.Done(os.Mkdir(filepath.Join(tempDIR, runID), 0700))
+	}
+	must.Done(os.Mkdir(filepath.Join(tempDIR, "not-a-run"), 0700))
+
+	// 按数量保留最新的三个运行
+	removed := rese.V1(clangformat.PruneRuns(tempDIR, 0, 3))
+	require.Equal(t, []string{"20200101-000000.000"}, removed)
+
+	// 按时间删除一年以前的运行，不是运行目录的条目保持不变
+	removed = rese.V1(clangformat.PruneRuns(tempDIR, 365*24*time.Hour, 0))
+	require.Equal(t, []string{"20240101-000000.000"}, removed)
+	require.DirExists(t, filepath.Join(tempDIR, "not-a-run"))
+
+	runs := rese.V1(clangformat.ListRuns(tempDIR))
+	require.Len(t, runs, 2)
+	require.Equal(t, "20990102-000000.000", runs[0].ID)
+}
@@ -0,0 +1,98 @@
+package clangformat
+
+// Options carries the settings and state of one formatting run: the Executor, the ending and mtime policies,
+// and the Cache, Journal and Transaction the written files go through
+// The package-level functions run with NewOptions(), build an Options value to format with other settings
+// Set it up before formatting starts, an Options value is safe to share between goroutines once set up
+//
+// Options 携带一次格式化运行的设置和状态：Executor、换行和修改时间策略，
+// 以及写入文件所经过的 Cache、Journal 和 Transaction
+// 包级函数使用 NewOptions() 运行，使用其他设置格式化时构建一个 Options 值
+// 需在格式化开始前完成设置，设置完成后的 Options 值可以在 goroutine 之间共享
+type Options struct {
+	executor     Executor
+	endingPolicy *EndingPolicy
+	mtimePolicy  MtimePolicy
+	cache        *Cache
+	journal      *Journal
+	transaction  *Transaction
+	endings      *endingReports
+}
+
+// NewOptions creates the Options running clang-format as a local process with the default policies
+// No Cache, Journal or Transaction is attached
+//
+// NewOptions 创建以本地进程运行 clang-format 并使用默认策略的 Options
+// 不附带 Cache、Journal 或 Transaction
+func NewOptions() *Options {
+	return &Options{
+		executor:     NewOsexecExecutor(),
+		endingPolicy: NewEndingPolicy(),
+		mtimePolicy:  MtimeUpdate,
+		endings:      &endingReports{},
+	}
+}
+
+// WithExecutor sets the Executor running clang-format and returns the updated Options
+// Tests set a FakeExecutor to format deterministically without the clang-format binary
+//
+// WithExecutor 设置运行 clang-format 的 Executor 并返回更新后的 Options
+// 测试中设置 FakeExecutor，无需 clang-format 程序即可得到确定的格式化结果
+func (o *Options) WithExecutor(executor Executor) *Options {
+	o.executor = executor
+	return o
+}
+
+// WithEndingPolicy sets the EndingPolicy of written files and returns the updated Options
+//
+// WithEndingPolicy 设置写入文件的 EndingPolicy 并返回更新后的 Options
+func (o *Options) WithEndingPolicy(policy *EndingPolicy) *Options {
+	o.endingPolicy = policy
+	return o
+}
+
+// WithMtimePolicy sets the MtimePolicy of written files and returns the updated Options
+//
+// WithMtimePolicy 设置写入文件的 MtimePolicy 并返回更新后的 Options
+func (o *Options) WithMtimePolicy(policy MtimePolicy) *Options {
+	o.mtimePolicy = policy
+	return o
+}
+
+// WithCache sets the Cache consulted before running clang-format and returns the updated Options
+//
+// WithCache 设置运行 clang-format 之前查询的 Cache 并返回更新后的 Options
+func (o *Options) WithCache(cache *Cache) *Options {
+	o.cache = cache
+	return o
+}
+
+// WithJournal sets the Journal backing up the written files and returns the updated Options
+//
+// WithJournal 设置备份写入文件的 Journal 并返回更新后的 Options
+func (o *Options) WithJournal(journal *Journal) *Options {
+	o.journal = journal
+	return o
+}
+
+// WithTransaction sets the Transaction recording the written files and returns the updated Options
+//
+// WithTransaction 设置记录写入文件的 Transaction 并返回更新后的 Options
+func (o *Options) WithTransaction(transaction *Transaction) *Options {
+	o.transaction = transaction
+	return o
+}
+
+// EndingPolicy returns the EndingPolicy of written files
+//
+// EndingPolicy 返回写入文件的 EndingPolicy
+func (o *Options) EndingPolicy() *EndingPolicy {
+	return o.endingPolicy
+}
+
+// TakeEndingChanges returns the EndingChange reports collected since the last call and clears them
+//
+// TakeEndingChanges 返回自上次调用以来收集的 EndingChange 报告并清空
+func (o *Options) TakeEndingChanges() []*EndingChange {
+	return o.endings.take()
+}
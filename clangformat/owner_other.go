@@ -0,0 +1,19 @@
+//go:build !unix
+
+package clangformat
+
+import "os"
+
+// owner is the ownership and link count of a file
+// owner 是文件的所有者和链接数
+type owner struct {
+	uid   int
+	gid   int
+	links uint64
+}
+
+// fileOwner reports no owner on systems without unix ownership, files keep the owner of the writer
+// fileOwner 在没有 unix 所有权的系统上不返回所有者，文件归属写入者
+func fileOwner(info os.FileInfo) (*owner, bool) {
+	return nil, false
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package clangformat
+
+import (
+	"os"
+	"syscall"
+)
+
+// owner is the ownership and link count of a file
+// owner 是文件的所有者和链接数
+type owner struct {
+	uid   int
+	gid   int
+	links uint64
+}
+
+// fileOwner returns the owner of the file described by info
+// fileOwner 返回 info 描述的文件的所有者
+func fileOwner(info os.FileInfo) (*owner, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil, false
+	}
+	return &owner{uid: int(stat.Uid), gid: int(stat.Gid), links: uint64(stat.Nlink)}, true
+}
@@ -0,0 +1,261 @@
+package clangformat
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/yyle88/erero"
+	"github.com/yyle88/osexec"
+)
+
+// Formatter defines the formatting operations bound to a language
+// Implementations receive the exec config and style resolved by the caller
+// The default implementation delegates to DryRun, Format and FormatProject in this package
+//
+// Formatter 定义绑定到语言的格式化操作
+// 实现接收调用方解析好的执行配置和样式
+// 默认实现委托给本包中的 DryRun、Format 和 FormatProject
+type Formatter interface {
+	DryRun(config *osexec.ExecConfig, path string, style *Style) (output []byte, err error)
+	Format(config *osexec.ExecConfig, path string, style *Style) (output []byte, err error)
+	FormatProject(config *osexec.ExecConfig, projectPath string, extension string, style *Style) error
+}
+
+// ProjectFilter is implemented by Formatters whose FormatProject skips part of the project, such as excluded DIRs
+// Callers formatting single files of a project, such as the watch mode, check it to visit the same files
+//
+// ProjectFilter 由 FormatProject 会跳过项目中部分内容（例如被排除的目录）的 Formatter 实现
+// 逐个格式化项目文件的调用方（例如监听模式）通过它访问相同的文件
+type ProjectFilter interface {
+	InProject(projectPath string, path string) (bool, error)
+}
+
+// SourceFormatter is implemented by Formatters able to format in-memory content, such as unsaved editor buffers
+// The path tells the language and where to search project config, the file itself is not read
+//
+// SourceFormatter 由能够格式化内存内容（例如编辑器中未保存的缓冲区）的 Formatter 实现
+// path 表明语言以及查找项目配置的位置，不会读取该文件本身
+type SourceFormatter interface {
+	DryRunSource(config *osexec.ExecConfig, source []byte, path string, style *Style) (output []byte, err error)
+}
+
+// LinesFormatter is implemented by Formatters able to format only a line range of in-memory content
+// first and last are 1-based and inclusive, lines outside the range are left as they are
+//
+// LinesFormatter 由能够只格式化内存内容中某个行范围的 Formatter 实现
+// first 和 last 从 1 开始且包含两端，范围以外的行保持不变
+type LinesFormatter interface {
+	DryRunLines(config *osexec.ExecConfig, source []byte, path string, style *Style, first int, last int) (output []byte, err error)
+}
+
+// NewFormatter creates the default Formatter backed by the clang-format CLI
+//
+// NewFormatter 创建基于 clang-format CLI 的默认 Formatter
+func NewFormatter() Formatter {
+	return NewOptions().NewFormatter()
+}
+
+// NewFormatter creates the default Formatter formatting with the settings of the options
+// NewFormatter 创建使用 options 的设置进行格式化的默认 Formatter
+func (o *Options) NewFormatter() Formatter {
+	return &formatter{options: o}
+}
+
+type formatter struct {
+	options *Options
+}
+
+func (f *formatter) DryRun(config *osexec.ExecConfig, path string, style *Style) ([]byte, error) {
+	return f.options.DryRun(config, path, style)
+}
+
+func (f *formatter) Format(config *osexec.ExecConfig, path string, style *Style) ([]byte, error) {
+	return f.options.Format(config, path, style)
+}
+
+func (f *formatter) DryRunSource(config *osexec.ExecConfig, source []byte, path string, style *Style) ([]byte, error) {
+	return f.options.DryRunSource(config, source, languageFilename(path, source), style)
+}
+
+func (f *formatter) DryRunLines(config *osexec.ExecConfig, source []byte, path string, style *Style, first int, last int) ([]byte, error) {
+	return f.options.DryRunLines(config, source, languageFilename(path, source), style, first, last)
+}
+
+func (f *formatter) FormatProject(config *osexec.ExecConfig, projectPath string, extension string, style *Style) error {
+	return f.options.FormatProject(config, projectPath, extension, style)
+}
+
+// Language describes a clang-format language with its file extensions, default style and formatter
+// Name follows the clang-format Language names, such as Cpp, ObjC, Java and Proto
+//
+// Language 描述 clang-format 语言及其文件扩展名、默认样式和格式化器
+// Name 沿用 clang-format 的语言名称，例如 Cpp、ObjC、Java 和 Proto
+type Language struct {
+	Name       string        // Language name // 语言名称
+	Extensions []string      // File extensions with leading dot // 带前导点的文件扩展名
+	NewStyle   func() *Style // Default style factory // 默认样式工厂
+	Formatter  Formatter     // Formatting operations // 格式化操作
+	options    *Options
+}
+
+// DryRunSource formats in-memory content through the Formatter when it implements SourceFormatter
+// Other Formatters fall back to clang-format through stdin with the Options of the Registry,
+// the path tells the language and where to search project config
+//
+// DryRunSource 在 Formatter 实现了 SourceFormatter 时通过它格式化内存内容
+// 其他 Formatter 回退到使用 Registry 的 Options 通过标准输入调用 clang-format，
+// path 表明语言以及查找项目配置的位置
+func (l *Language) DryRunSource(config *osexec.ExecConfig, source []byte, path string, style *Style) (output []byte, err error) {
+	if formatter, ok := l.Formatter.(SourceFormatter); ok {
+		return formatter.DryRunSource(config, source, path, style)
+	}
+	if l.options == nil {
+		return DryRunSource(config, source, path, style)
+	}
+	return l.options.DryRunSource(config, source, path, style)
+}
+
+// Registry maps file extensions to languages
+// Registering a language overrides previous mappings of its extensions
+// Not safe for concurrent modification, set it up before formatting starts
+//
+// Registry 将文件扩展名映射到语言
+// 注册语言会覆盖其扩展名之前的映射
+// 不支持并发修改，需在格式化开始前完成设置
+type Registry struct {
+	options    *Options
+	languages  map[string]*Language
+	extensions map[string]*Language
+}
+
+// NewRegistry creates a Registry with the languages clang-format supports out of the box
+// Includes C/C++ (with CUDA and include fragments), Objective-C, Java, JavaScript/TypeScript, C#, Proto and TextProto
+//
+// NewRegistry 创建包含 clang-format 内置支持语言的 Registry
+// 包括 C/C++（含 CUDA 和包含片段）、Objective-C、Java、JavaScript/TypeScript、C#、Proto 和 TextProto
+func NewRegistry() *Registry {
+	return NewOptions().NewRegistry()
+}
+
+// NewRegistry creates the Registry of NewRegistry whose default formatters use the settings of the options
+// NewRegistry 创建与 NewRegistry 相同的 Registry，其默认格式化器使用 options 的设置
+func (o *Options) NewRegistry() *Registry {
+	registry := o.NewEmptyRegistry()
+	for _, language := range []*Language{
+		{Name: "Cpp", Extensions: []string{".c", ".cc", ".cpp", ".cxx", ".c++", ".h", ".hh", ".hpp", ".hxx", ".h++", ".inc", ".ipp", ".tpp", ".cu", ".cuh"}},
+		{Name: "ObjC", Extensions: []string{".m", ".mm"}},
+		{Name: "Java", Extensions: []string{".java"}},
+		{Name: "JavaScript", Extensions: []string{".js", ".mjs", ".cjs", ".ts"}},
+		{Name: "CSharp", Extensions: []string{".cs"}},
+		{Name: "Proto", Extensions: []string{".proto", ".protodevel"}},
+		{Name: "TextProto", Extensions: []string{".textproto", ".textpb", ".txtpb", ".pbtxt", ".prototxt", ".asciipb"}},
+	} {
+		registry.Register(language)
+	}
+	return registry
+}
+
+// NewEmptyRegistry creates a Registry without any language
+//
+// NewEmptyRegistry 创建不含任何语言的 Registry
+func NewEmptyRegistry() *Registry {
+	return NewOptions().NewEmptyRegistry()
+}
+
+// NewEmptyRegistry creates a Registry without any language, whose default formatters use the settings of the options
+// NewEmptyRegistry 创建不含任何语言的 Registry，其默认格式化器使用 options 的设置
+func (o *Options) NewEmptyRegistry() *Registry {
+	return &Registry{
+		options:    o,
+		languages:  map[string]*Language{},
+		extensions: map[string]*Language{},
+	}
+}
+
+// Register adds the language and maps each of its extensions to it
+// Missing style factory and formatter fall back to the package defaults, the formatter using the Options of the Registry
+// Replaces a language registered with the same name, and its extension mappings
+//
+// Register 添加语言并将其每个扩展名映射到该语言
+// 缺少的样式工厂和格式化器会回退到包默认值，格式化器使用 Registry 的 Options
+// 替换同名的已注册语言及其扩展名映射
+func (r *Registry) Register(language *Language) *Registry {
+	if language.NewStyle == nil {
+		language.NewStyle = NewStyle
+	}
+	if language.Formatter == nil {
+		language.Formatter = r.options.NewFormatter()
+	}
+	language.options = r.options
+	if previous, ok := r.languages[language.Name]; ok {
+		for extension, mapped := range r.extensions {
+			if mapped == previous {
+				delete(r.extensions, extension)
+			}
+		}
+	}
+	r.languages[language.Name] = language
+	for _, extension := range language.Extensions {
+		r.extensions[normalizeExtension(extension)] = language
+	}
+	return r
+}
+
+// Alias maps an extra extension to a registered language
+// Returns error when the language name is not registered
+//
+// Alias 将额外的扩展名映射到已注册的语言
+// 语言名称未注册时返回错误
+func (r *Registry) Alias(extension string, name string) error {
+	language, ok := r.languages[name]
+	if !ok {
+		return erero.Errorf("language %s not registered", name)
+	}
+	extension = normalizeExtension(extension)
+	if !slices.Contains(language.Extensions, extension) {
+		language.Extensions = append(language.Extensions, extension)
+	}
+	r.extensions[extension] = language
+	return nil
+}
+
+// Lookup returns the language mapped to the extension
+// Extensions match regardless of case, the same rule the project walks follow
+//
+// Lookup 返回映射到该扩展名的语言
+// 扩展名匹配时忽略大小写，与项目遍历遵循相同的规则
+func (r *Registry) Lookup(extension string) (*Language, bool) {
+	language, ok := r.extensions[normalizeExtension(extension)]
+	return language, ok
+}
+
+// LookupName returns the language registered with the name
+//
+// LookupName 返回以该名称注册的语言
+func (r *Registry) LookupName(name string) (*Language, bool) {
+	language, ok := r.languages[name]
+	return language, ok
+}
+
+// Extensions returns all mapped extensions in sorted order
+//
+// Extensions 返回所有已映射的扩展名，按排序顺序
+func (r *Registry) Extensions() []string {
+	extensions := make([]string, 0, len(r.extensions))
+	for extension := range r.extensions {
+		extensions = append(extensions, extension)
+	}
+	sort.Strings(extensions)
+	return extensions
+}
+
+// normalizeExtension lowercases the extension and ensures the leading dot
+// normalizeExtension 将扩展名转为小写并确保带前导点
+func normalizeExtension(extension string) string {
+	extension = strings.ToLower(strings.TrimSpace(extension))
+	if extension != "" && !strings.HasPrefix(extension, ".") {
+		extension = "." + extension
+	}
+	return extension
+}
@@ -0,0 +1,68 @@
+package clangformat_test
+
+import (
+	"testing"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRegistry(t *testing.T) {
+	registry := clangformat.NewRegistry()
+
+	for extension, name := range map[string]string{
+		".cpp":       "Cpp",
+		".H":         "Cpp",
+		"cu":         "Cpp",
+		".inc":       "Cpp",
+		".mm":        "ObjC",
+		".java":      "Java",
+		".ts":        "JavaScript",
+		".cs":        "CSharp",
+		".proto":     "Proto",
+		".textproto": "TextProto",
+	} {
+		language, ok := registry.Lookup(extension)
+		require.True(t, ok, extension)
+		require.Equal(t, name, language.Name)
+		require.NotNil(t, language.NewStyle())
+		require.NotNil(t, language.Formatter)
+	}
+
+	_, ok := registry.Lookup(".go")
+	require.False(t, ok)
+}
+
+func TestRegistry_Register(t *testing.T) {
+	registry := clangformat.NewRegistry()
+	registry.Register(&clangformat.Language{
+		Name:       "Cpp",
+		Extensions: []string{".cpp", ".ino"},
+		NewStyle: func() *clangformat.Style {
+			return &clangformat.Style{BasedOnStyle: "LLVM", IndentWidth: 4}
+		},
+	})
+
+	language, ok := registry.Lookup(".ino")
+	require.True(t, ok)
+	require.Equal(t, "LLVM", language.NewStyle().BasedOnStyle)
+	require.NotNil(t, language.Formatter)
+
+	// extensions of the replaced language are no longer mapped
+	_, ok = registry.Lookup(".h")
+	require.False(t, ok)
+}
+
+func TestRegistry_Alias(t *testing.T) {
+	registry := clangformat.NewEmptyRegistry()
+	require.Empty(t, registry.Extensions())
+
+	registry.Register(&clangformat.Language{Name: "Java", Extensions: []string{".java"}})
+	require.NoError(t, registry.Alias("pde", "Java"))
+	require.Error(t, registry.Alias(".ino", "Cpp"))
+
+	language, ok := registry.Lookup(".pde")
+	require.True(t, ok)
+	require.Equal(t, "Java", language.Name)
+	require.Equal(t, []string{".java", ".pde"}, registry.Extensions())
+}
@@ -0,0 +1,443 @@
+package clangformat
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/yyle88/erero"
+	"github.com/yyle88/osexec"
+)
+
+// Divergence is the error returned when formatting changes C/C++ content beyond whitespace
+// Reports the first differing token on both sides with their line numbers
+//
+// Divergence 是格式化改变了 C/C++ 内容（不仅是空白）时返回的错误
+// 报告两侧第一个不同的词法单元及其行号
+type Divergence struct {
+	Path          string // File path // 文件路径
+	OriginalLine  int    // Line in the original content, 0 when the content ended // 原始内容中的行号，内容结束时为 0
+	FormattedLine int    // Line in the formatted content, 0 when the content ended // 格式化内容中的行号，内容结束时为 0
+	Original      string // Original token // 原始词法单元
+	Formatted     string // Formatted token // 格式化后的词法单元
+}
+
+func (d *Divergence) Error() string {
+	return fmt.Sprintf("%s: formatting changed tokens: original line %d %q, formatted line %d %q", d.Path, d.OriginalLine, d.Original, d.FormattedLine, d.Formatted)
+}
+
+// Verify checks that the formatted C/C++ content has the same tokens as the original, ignoring whitespace
+// Comments, literals, preprocessor lines and identifiers must match, with these allowances:
+// #include and #import lines may be reordered inside their block, comments may be reflowed, and namespace end comments may be fixed
+// Returns *Divergence on the first mismatch
+//
+// Verify 检查格式化后的 C/C++ 内容与原始内容的词法单元是否相同，忽略空白
+// 注释、字面量、预处理行和标识符必须一致，但允许以下变化：
+// #include 和 #import 行可以在所在代码块内重新排序，注释可以重新换行，命名空间结尾注释可以被修正
+// 第一处不一致时返回 *Divergence
+func Verify(path string, original []byte, formatted []byte) error {
+	if divergence := compareTokens(groupIncludes(lexC(string(original))), groupIncludes(lexC(string(formatted)))); divergence != nil {
+		divergence.Path = path
+		return divergence
+	}
+	return nil
+}
+
+// DryRunVerified formats the file like DryRun and checks the result with Verify
+// Returns *Divergence when the formatting changes more than whitespace and include order
+//
+// DryRunVerified 像 DryRun 一样格式化文件，并使用 Verify 检查结果
+// 格式化改变了空白和 include 顺序以外的内容时返回 *Divergence
+func DryRunVerified(config *osexec.ExecConfig, path string, style *Style) (output []byte, err error) {
+	return NewOptions().DryRunVerified(config, path, style)
+}
+
+// DryRunVerified previews the file like the package DryRunVerified, with the settings of the options
+// DryRunVerified 像包级 DryRunVerified 一样预览文件，使用 options 的设置
+func (o *Options) DryRunVerified(config *osexec.ExecConfig, path string, style *Style) (output []byte, err error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	output, err = o.DryRunSource(config, source, languageFilename(path, source), style)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if err := Verify(path, source, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// FormatVerified formats the file like Format, writing the result only when Verify passes
+// The file is left untouched and *Divergence is returned when the guard trips
+//
+// FormatVerified 像 Format 一样格式化文件，仅在 Verify 通过时写入结果
+// 保护触发时文件保持不变，并返回 *Divergence
+func FormatVerified(config *osexec.ExecConfig, path string, style *Style) (output []byte, err error) {
+	return NewOptions().FormatVerified(config, path, style)
+}
+
+// FormatVerified formats the file like the package FormatVerified, with the settings of the options
+// FormatVerified 像包级 FormatVerified 一样格式化文件，使用 options 的设置
+func (o *Options) FormatVerified(config *osexec.ExecConfig, path string, style *Style) (output []byte, err error) {
+	return o.formatSource(config, path, "", style, true)
+}
+
+// FormatProjectVerified formats the project like FormatProject, checking each file with Verify
+// Stops at the first file whose formatting trips the guard, files already formatted keep their changes
+//
+// FormatProjectVerified 像 FormatProject 一样格式化项目，并使用 Verify 检查每个文件
+// 在第一个触发保护的文件处停止，已格式化的文件保留其更改
+func FormatProjectVerified(config *osexec.ExecConfig, projectPath string, extension string, style *Style) error {
+	return NewOptions().FormatProjectVerified(config, projectPath, extension, style)
+}
+
+// FormatProjectVerified formats the project like the package FormatProjectVerified, with the settings of the options
+// FormatProjectVerified 像包级 FormatProjectVerified 一样格式化项目，使用 options 的设置
+func (o *Options) FormatProjectVerified(config *osexec.ExecConfig, projectPath string, extension string, style *Style) error {
+	return o.formatProject(config, projectPath, extension, style, true)
+}
+
+// NewVerifiedFormatter creates a Formatter that checks every result with Verify before writing
+//
+// NewVerifiedFormatter 创建在写入前使用 Verify 检查每个结果的 Formatter
+func NewVerifiedFormatter() Formatter {
+	return NewOptions().NewVerifiedFormatter()
+}
+
+// NewVerifiedFormatter creates the verifying Formatter formatting with the settings of the options
+// NewVerifiedFormatter 创建使用 options 的设置进行格式化的校验 Formatter
+func (o *Options) NewVerifiedFormatter() Formatter {
+	return &verifiedFormatter{options: o}
+}
+
+type verifiedFormatter struct {
+	options *Options
+}
+
+func (f *verifiedFormatter) DryRun(config *osexec.ExecConfig, path string, style *Style) ([]byte, error) {
+	return f.options.DryRunVerified(config, path, style)
+}
+
+func (f *verifiedFormatter) Format(config *osexec.ExecConfig, path string, style *Style) ([]byte, error) {
+	return f.options.FormatVerified(config, path, style)
+}
+
+func (f *verifiedFormatter) DryRunSource(config *osexec.ExecConfig, source []byte, path string, style *Style) ([]byte, error) {
+	output, err := f.options.DryRunSource(config, source, languageFilename(path, source), style)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if err := Verify(path, source, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func (f *verifiedFormatter) DryRunLines(config *osexec.ExecConfig, source []byte, path string, style *Style, first int, last int) ([]byte, error) {
+	output, err := f.options.DryRunLines(config, source, languageFilename(path, source), style, first, last)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if err := Verify(path, source, output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func (f *verifiedFormatter) FormatProject(config *osexec.ExecConfig, projectPath string, extension string, style *Style) error {
+	return f.options.FormatProjectVerified(config, projectPath, extension, style)
+}
+
+// cKind is the category of a C token
+// cKind 是 C 词法单元的类别
+type cKind int
+
+const (
+	cIdent        cKind = iota // Identifiers and keywords // 标识符和关键字
+	cNumber                    // Preprocessing numbers // 预处理数字
+	cString                    // String and character literals // 字符串和字符字面量
+	cSymbol                    // Punctuation, one character each // 标点符号，每个字符一个
+	cComment                   // Line and block comments // 行注释和块注释
+	cDirectiveEnd              // End of a preprocessor line // 预处理行的结尾
+)
+
+// cToken is a C token with its start line
+// cToken 是带有起始行号的 C 词法单元
+type cToken struct {
+	kind cKind
+	text string
+	line int
+}
+
+// lexC splits C/C++/ObjC source into tokens
+// Never fails: unterminated literals end at the line end and unknown bytes become symbols
+// Backslash-newline is treated as whitespace, and each preprocessor line ends with a cDirectiveEnd token
+//
+// lexC 将 C/C++/ObjC 源码拆分为词法单元
+// 不会失败：未结束的字面量在行尾结束，未知字节作为符号
+// 反斜杠换行视为空白，每个预处理行以 cDirectiveEnd 词法单元结尾
+func lexC(text string) []*cToken {
+	text = strings.TrimPrefix(text, "\ufeff")
+	var tokens []*cToken
+	line := 1
+	lineHead := true   // only whitespace so far on this line // 本行到目前为止只有空白
+	directive := false // inside a preprocessor line // 位于预处理行内
+	for pos := 0; pos < len(text); {
+		char := text[pos]
+		start := pos
+		switch {
+		case char == '\n':
+			if directive {
+				tokens = append(tokens, &cToken{kind: cDirectiveEnd, text: "\n", line: line})
+				directive = false
+			}
+			pos++
+			line++
+			lineHead = true
+			continue
+		case char == '\\' && (strings.HasPrefix(text[pos:], "\\\n") || strings.HasPrefix(text[pos:], "\\\r\n")):
+			pos += strings.IndexByte(text[pos:], '\n') + 1
+			line++
+			continue
+		case char == ' ' || char == '\t' || char == '\r' || char == '\f' || char == '\v':
+			pos++
+			continue
+		case strings.HasPrefix(text[pos:], "//"):
+			startLine := line
+			for pos < len(text) && text[pos] != '\n' {
+				if strings.HasPrefix(text[pos:], "\\\n") {
+					pos++
+					line++
+				}
+				pos++
+			}
+			tokens = append(tokens, &cToken{kind: cComment, text: text[start:pos], line: startLine})
+			continue
+		case strings.HasPrefix(text[pos:], "/*"):
+			end := strings.Index(text[pos+2:], "*/")
+			if end < 0 {
+				pos = len(text)
+			} else {
+				pos += end + 4
+			}
+			tokens = append(tokens, &cToken{kind: cComment, text: text[start:pos], line: line})
+			line += strings.Count(text[start:pos], "\n")
+			continue
+		}
+		if char == '#' && lineHead {
+			directive = true
+		}
+		lineHead = false
+		switch {
+		case char == '"' || char == '\'':
+			pos = skipQuoted(text, pos)
+			tokens = append(tokens, &cToken{kind: cString, text: text[start:pos], line: line})
+		case isIdentStart(char):
+			for pos < len(text) && isIdentPart(text[pos]) {
+				pos++
+			}
+			if strings.HasSuffix(text[start:pos], "R") && pos < len(text) && text[pos] == '"' && slices.Contains([]string{"R", "LR", "uR", "UR", "u8R"}, text[start:pos]) {
+				end := skipRaw(text, pos)
+				tokens = append(tokens, &cToken{kind: cString, text: text[start:end], line: line})
+				line += strings.Count(text[start:end], "\n")
+				pos = end
+				continue
+			}
+			// a function-like macro name is glued to its (, keep the ( in the token so a space shows up
+			// 函数式宏的名称紧贴其 (，将 ( 保留在词法单元中以便发现插入的空格
+			if directive && pos < len(text) && text[pos] == '(' && len(tokens) >= 2 && tokens[len(tokens)-1].text == "define" && tokens[len(tokens)-2].text == "#" {
+				pos++
+			}
+			tokens = append(tokens, &cToken{kind: cIdent, text: text[start:pos], line: line})
+		case isDigit(char) || (char == '.' && pos+1 < len(text) && isDigit(text[pos+1])):
+			for pos < len(text) {
+				if isIdentPart(text[pos]) || text[pos] == '.' {
+					pos++
+				} else if (text[pos] == '+' || text[pos] == '-') && strings.IndexByte("eEpP", text[pos-1]) >= 0 {
+					pos++
+				} else if text[pos] == '\'' && pos+1 < len(text) && isIdentPart(text[pos+1]) {
+					pos++
+				} else {
+					break
+				}
+			}
+			tokens = append(tokens, &cToken{kind: cNumber, text: text[start:pos], line: line})
+		default:
+			pos++
+			tokens = append(tokens, &cToken{kind: cSymbol, text: text[start:pos], line: line})
+		}
+	}
+	if directive {
+		tokens = append(tokens, &cToken{kind: cDirectiveEnd, text: "\n", line: line})
+	}
+	return tokens
+}
+
+// skipQuoted returns the offset after the string or character literal starting at pos
+// skipQuoted 返回从 pos 开始的字符串或字符字面量之后的偏移量
+func skipQuoted(text string, pos int) int {
+	quote := text[pos]
+	for pos++; pos < len(text) && text[pos] != quote && text[pos] != '\n'; pos++ {
+		if text[pos] == '\\' && pos+1 < len(text) {
+			pos++
+		}
+	}
+	if pos < len(text) && text[pos] == quote {
+		pos++
+	}
+	return pos
+}
+
+// skipRaw returns the offset after the raw string literal whose quote is at pos
+// skipRaw 返回引号位于 pos 的原始字符串字面量之后的偏移量
+func skipRaw(text string, pos int) int {
+	open := strings.IndexByte(text[pos:], '(')
+	if open < 0 {
+		return len(text)
+	}
+	closing := ")" + text[pos+1:pos+open] + "\""
+	end := strings.Index(text[pos+open:], closing)
+	if end < 0 {
+		return len(text)
+	}
+	return pos + open + end + len(closing)
+}
+
+// groupIncludes replaces each run of #include, #include_next and #import lines with one token
+// The token holds the sorted lines, so reordering and regrouping inside the run still compare equal
+//
+// groupIncludes 将每段连续的 #include、#include_next 和 #import 行替换为一个词法单元
+// 该词法单元包含排序后的各行，使段内的重新排序和重新分组仍然比较相等
+func groupIncludes(tokens []*cToken) []*cToken {
+	var results []*cToken
+	var group *cToken
+	var lines []string
+	for idx := 0; idx < len(tokens); idx++ {
+		token := tokens[idx]
+		if token.kind == cSymbol && token.text == "#" && idx+1 < len(tokens) && slices.Contains([]string{"include", "include_next", "import"}, tokens[idx+1].text) {
+			var parts []string
+			for ; idx < len(tokens) && tokens[idx].kind != cDirectiveEnd; idx++ {
+				parts = append(parts, normalizeToken(tokens[idx]))
+			}
+			if group == nil {
+				group = &cToken{kind: cSymbol, line: token.line}
+				results = append(results, group)
+			}
+			lines = append(lines, strings.Join(parts, " "))
+			slices.Sort(lines)
+			group.text = strings.Join(lines, "\n")
+			continue
+		}
+		group, lines = nil, nil
+		results = append(results, token)
+	}
+	return results
+}
+
+// namespaceCommentPattern matches the namespace end comments clang-format adds and fixes
+// namespaceCommentPattern 匹配 clang-format 添加和修正的命名空间结尾注释
+var namespaceCommentPattern = regexp.MustCompile(`^(?:end (?:of )?)?(?:anonymous |unnamed )?namespace(?: \S+)?\.?$`)
+
+// compareTokens returns the first divergence between the two token streams
+// Consecutive comments are compared as one text so reflowed comments still match
+//
+// compareTokens 返回两个词法单元流的第一处差异
+// 连续的注释作为一段文本比较，使重新换行的注释仍然匹配
+func compareTokens(original []*cToken, formatted []*cToken) *Divergence {
+	original = mergeComments(original)
+	formatted = mergeComments(formatted)
+	for idx := 0; idx < max(len(original), len(formatted)); idx++ {
+		var a, b *cToken
+		if idx < len(original) {
+			a = original[idx]
+		}
+		if idx < len(formatted) {
+			b = formatted[idx]
+		}
+		if a != nil && b != nil && a.kind == b.kind && a.text == b.text {
+			continue
+		}
+		return newDivergence(a, b)
+	}
+	return nil
+}
+
+// mergeComments joins runs of comments into single tokens with the comment words
+// Namespace end comments directly after } are dropped
+//
+// mergeComments 将连续的注释合并为只包含注释词语的单个词法单元
+// 紧跟在 } 之后的命名空间结尾注释会被丢弃
+func mergeComments(tokens []*cToken) []*cToken {
+	var results []*cToken
+	for idx := 0; idx < len(tokens); idx++ {
+		token := tokens[idx]
+		if token.kind != cComment {
+			results = append(results, token)
+			continue
+		}
+		if len(results) > 0 && results[len(results)-1].text == "}" && namespaceCommentPattern.MatchString(normalizeToken(token)) {
+			continue
+		}
+		var words []string
+		for ; idx < len(tokens) && tokens[idx].kind == cComment; idx++ {
+			if text := normalizeToken(tokens[idx]); text != "" {
+				words = append(words, text)
+			}
+		}
+		idx--
+		results = append(results, &cToken{kind: cComment, text: strings.Join(words, " "), line: token.line})
+	}
+	return results
+}
+
+// normalizeToken returns the token text used in comparison
+// Comments lose their markers, the leading * of block comment lines and extra whitespace
+//
+// normalizeToken 返回用于比较的词法单元文本
+// 注释去掉标记符号、块注释行首的 * 以及多余空白
+func normalizeToken(token *cToken) string {
+	if token.kind != cComment {
+		return token.text
+	}
+	text := token.text
+	if strings.HasPrefix(text, "//") {
+		text = strings.TrimPrefix(text, "//")
+	} else {
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+		lines := strings.Split(text, "\n")
+		for idx, line := range lines {
+			lines[idx] = strings.TrimLeft(strings.TrimSpace(line), "*")
+		}
+		text = strings.Join(lines, " ")
+	}
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// newDivergence creates the Divergence between two tokens, either may be nil at the end of the content
+// newDivergence 创建两个词法单元之间的 Divergence，内容结束时任一方可能为 nil
+func newDivergence(a *cToken, b *cToken) *Divergence {
+	divergence := &Divergence{}
+	if a != nil {
+		divergence.OriginalLine, divergence.Original = a.line, a.text
+	}
+	if b != nil {
+		divergence.FormattedLine, divergence.Formatted = b.line, b.text
+	}
+	return divergence
+}
+
+func isIdentStart(char byte) bool {
+	return char == '_' || char == '$' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || char >= 0x80
+}
+
+func isIdentPart(char byte) bool {
+	return isIdentStart(char) || isDigit(char)
+}
+
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
@@ -0,0 +1,109 @@
+package clangformat_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	for original, formatted := range map[string]string{
+		"int main(){return 0;}\n":                                "int main() { return 0; }\n",
+		"#include <b.h>\n#include \"a.h\"\nint x;\n":             "#include \"a.h\"\n#include <b.h>\nint x;\n",
+		"#define MAX(a,b) ((a)>(b)?(a):(b))\n":                   "#define MAX(a, b) ((a) > (b) ? (a) : (b))\n",
+		"#define LONG 1 + \\\n  2\n":                             "#define LONG 1 + 2\n",
+		"// one two\n// three\nint x;\n":                         "// one two three\nint x;\n",
+		"/* one\n * two */\nint x;\n":                            "/* one two */\nint x;\n",
+		"namespace foo {\nint x;\n}\n":                           "namespace foo {\nint x;\n}  // namespace foo\n",
+		"std::vector<std::vector<int> > v;\n":                    "std::vector<std::vector<int>> v;\n",
+		"auto s = R\"x(a  \"b\"\n  c)x\";\n":                     "auto s =\n    R\"x(a  \"b\"\n  c)x\";\n",
+		"int n = 1'000'000;\nfloat f = 1.5e+3f;\n":               "int n = 1'000'000;\nfloat f = 1.5e+3f;\n",
+		"@interface Foo : NSObject\n- (void)bar;\n@end\n":        "@interface Foo : NSObject\n- (void)bar;\n@end\n",
+		"\xef\xbb\xbfint x;\n":                                   "int x;\n",
+		"#  ifdef X\nint y;\n#  endif\n":                         "#ifdef X\nint y;\n#endif\n",
+		"char c = '\\'';  const char *s = \"a\\\"b\";\n":         "char c = '\\'';\nconst char *s = \"a\\\"b\";\n",
+		"void f() { if (x) return; }\n":                          "void f() {\n  if (x) return;\n}\n",
+		"#include <a.h>  // keep\n#include <b.h>\n":              "#include <b.h>\n#include <a.h>  // keep\n",
+		"int a;  /* trailing */\n// next\n":                      "int a; /* trailing */\n// next\n",
+		"#pragma once\n":                                         "#pragma once\n",
+		"int x; // c\n":                                          "int x;  // c\n",
+		"struct A { int a; int b; };\n":                          "struct A {\n  int a;\n  int b;\n};\n",
+		"#if defined(A) && \\\n    defined(B)\nint z;\n#endif\n": "#if defined(A) && defined(B)\nint z;\n#endif\n",
+		"namespace {\nint x;\n}  // namespace\n":                 "namespace {\nint x;\n}  // namespace\n",
+		"namespace a {\nint x;\n}  // end namespace a\n":         "namespace a {\nint x;\n}  // namespace a\n",
+		"const char *s = \"a\" \"b\";\n":                         "const char *s =\n    \"a\"\n    \"b\";\n",
+		"int x = a - -b;\n":                                      "int x = a - -b;\n",
+		"x = y->z;\n":                                            "x = y -> z;\n",
+		"template <typename T> class X {};\n":                    "template <typename T>\nclass X {};\n",
+		"/** doc\n * more\n */\nvoid f();\n":                     "/** doc more */\nvoid f();\n",
+		"unterminated \"string\nint x;\n":                        "unterminated \"string\nint x;\n",
+		"/* unterminated":                                        "/* unterminated",
+		"#define A \\\r\n  1\r\n":                                "#define A 1\n",
+		"int x;\n#include <c.h>\n":                               "int x;\n#include <c.h>\n",
+		"#include <b.h>\n\n#include <a.h>\n":                     "#include <a.h>\n#include <b.h>\n",
+		"#import <Foundation/Foundation.h>\n#import \"B.h\"\n":   "#import \"B.h\"\n#import <Foundation/Foundation.h>\n",
+		"#include_next <stdio.h>\n":                              "#include_next <stdio.h>\n",
+		"int main() {\n  return 0;\n}\n\n\n\nint y;\n":           "int main() {\n  return 0;\n}\n\nint y;\n",
+		"typedef struct { int a; } S;\n":                         "typedef struct {\n  int a;\n} S;\n",
+		"enum { A, B, };\n":                                      "enum {\n  A,\n  B,\n};\n",
+		"int f(int a,\n      int b);\n":                          "int f(int a, int b);\n",
+		"x = 0x1p-3;\n":                                          "x = 0x1p-3;\n",
+		"// a\n\n\n// b\nint x;\n":                               "// a\n\n// b\nint x;\n",
+		"int x; /* a\n   b */\n":                                 "int x; /* a\n         b */\n",
+		"u8\"x\";\nL'c';\n":                                      "u8\"x\";\nL'c';\n",
+		"auto s = LR\"(a)\";\n":                                  "auto s = LR\"(a)\";\n",
+		"#define S(x) #x\n":                                      "#define S(x) #x\n",
+		"#define C(a, b) a##b\n":                                 "#define C(a, b) a## b\n",
+		"int a[] = {1,2,3};\n":                                   "int a[] = {1, 2, 3};\n",
+		"x = a?b:c;\n":                                           "x = a ? b : c;\n",
+		"using namespace std;\n":                                 "using namespace std;\n",
+		"#endif  // FOO_H\n":                                     "#endif // FOO_H\n",
+		"}  // namespace foo\n":                                  "}  // namespace foo\n",
+		"class A {\npublic:\nint x;\n};\n":                       "class A {\n public:\n  int x;\n};\n",
+		"void f(){}\n":                                           "void f() {}\n",
+		"int*p;\n":                                               "int *p;\n",
+		"a<<=1;\n":                                               "a <<= 1;\n",
+		"$x;\n":                                                  "$x;\n",
+		"\n":                                                     "",
+		"":                                                       "",
+	} {
+		require.NoError(t, clangformat.Verify("a.cc", []byte(original), []byte(formatted)), original)
+	}
+}
+
+func TestVerifyDivergence(t *testing.T) {
+	for original, formatted := range map[string]string{
+		"int x = 1;\n":                               "int x = 2;\n",
+		"const char *s = \"a  b\";\n":                "const char *s = \"a b\";\n",
+		"#include <a.h>\n":                           "#include <b.h>\n",
+		"#include <a.h>\n#include <a.h>\n":           "#include <a.h>\n",
+		"#include <b.h>\n// c\n#include <a.h>\n":     "#include <a.h>\n#include <b.h>\n// c\n",
+		"// one two\nint x;\n":                       "// one\nint x;\n",
+		"#define A 1\nint x;\n":                      "#define A\n1 int x;\n",
+		"int a;\n":                                   "int a;\nint b;\n",
+		"int a;\nint b;\n":                           "int a;\n",
+		"void f() { g(); }\n":                        "void f() { g; }\n",
+		"if (x) y();\n":                              "if (x) { y(); }\n",
+		"namespace a {\nint x;\n}  // namespace a\n": "namespace a {\nint x;\n}\nint y;\n",
+		"auto s = R\"(a  b)\";\n":                    "auto s = R\"(a b)\";\n",
+		"int x;  // namespace a\n":                   "int x;\n",
+		"#include <a.h>\nint x;\n#include <b.h>\n":   "#include <a.h>\n#include <b.h>\nint x;\n",
+		"#if A\n#endif\n":                            "#if A #endif\n",
+		"int n = 1'000;\n":                           "int n = 1000;\n",
+		"#define A(x) x\n":                           "#define A (x) x\n",
+	} {
+		err := clangformat.Verify("a.cc", []byte(original), []byte(formatted))
+		require.Error(t, err, original)
+	}
+
+	err := clangformat.Verify("a.cc", []byte("int main() {\n  return 0;\n}\n"), []byte("int main() {\n  return 1;\n}\n"))
+	var divergence *clangformat.Divergence
+	require.True(t, errors.As(err, &divergence))
+	require.Equal(t, "a.cc", divergence.Path)
+	require.Equal(t, 2, divergence.OriginalLine)
+	require.Equal(t, 2, divergence.FormattedLine)
+	require.Equal(t, "0", divergence.Original)
+	require.Equal(t, "1", divergence.Formatted)
+}
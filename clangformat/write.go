@@ -0,0 +1,293 @@
+package clangformat
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/yyle88/erero"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// MtimePolicy decides the modification time of files rewritten by WriteFile
+//
+// MtimePolicy 决定 WriteFile 改写后文件的修改时间
+type MtimePolicy string
+
+const (
+	MtimeUpdate   MtimePolicy = "update"   // Set the mtime to the write time // 修改时间设为写入时间
+	MtimePreserve MtimePolicy = "preserve" // Keep the mtime the file had before the write // 保持写入前的修改时间
+)
+
+// WriteFile replaces the content of an existing file atomically
+// The data goes to a temp file in the same DIR, which is synced and renamed over the target,
+// so a crash leaves either the old or the new content, never a truncated file
+// Line endings, BOM and final newline follow NewEndingPolicy, files whose content ends up the same are not written
+// Permissions and ownership are kept, the mtime is set to the write time, symlinks are written through
+// Files with several hard links, or whose owner can not be restored, are rewritten in place instead
+//
+// WriteFile 原子地替换已存在文件的内容
+// 数据先写入同目录下的临时文件，同步后重命名覆盖目标文件，
+// 因此崩溃时文件要么是旧内容要么是新内容，不会出现截断的文件
+// 换行符、BOM 和末尾换行遵循 NewEndingPolicy，最终内容相同的文件不会写入
+// 保持权限和所有者，修改时间设为写入时间，符号链接会写入其指向的文件
+// 有多个硬链接或无法恢复所有者的文件改为就地写入
+func WriteFile(path string, data []byte) error {
+	return NewOptions().WriteFile(path, data)
+}
+
+// WriteFile writes the file like the package WriteFile, following the ending and mtime policies of the options
+// With a Transaction or a Journal set on the options the original content is recorded first so it can be rolled back or undone
+//
+// WriteFile 像包级 WriteFile 一样写入文件，遵循 options 的换行和修改时间策略
+// options 设置了 Transaction 或 Journal 时会先记录原始内容，以便回滚或撤销
+func (o *Options) WriteFile(path string, data []byte) error {
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	policy, err := o.endingPolicyFor(path)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	data = ApplyEndings(original, data, policy)
+	if bytes.Equal(original, data) {
+		return nil
+	}
+	o.endings.report(path, original, data)
+	if err := o.journal.record(path, original, data, info); err != nil {
+		return erero.Wro(err)
+	}
+	if err := o.transaction.track(path, original, info); err != nil {
+		return erero.Wro(err)
+	}
+	return writeFile(path, data, info, o.mtimePolicy)
+}
+
+// writeFile writes the data over the file described by info, following the mtime policy
+// writeFile 按照修改时间策略将数据写入 info 描述的文件
+func writeFile(path string, data []byte, info os.FileInfo, mtime MtimePolicy) error {
+	owner, ok := fileOwner(info)
+	if ok && owner.links > 1 {
+		return writeInPlace(path, data, info, mtime)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return erero.Wro(err)
+	}
+	tempPath := temp.Name()
+	// the temp file is gone after the rename, removing it again is a no-op
+	// 重命名后临时文件已不存在，再次删除不产生任何影响
+	defer func() { _ = os.Remove(tempPath) }()
+
+	if _, err := temp.Write(data); err != nil {
+		_ = temp.Close()
+		return erero.Wro(err)
+	}
+	if err := temp.Sync(); err != nil {
+		_ = temp.Close()
+		return erero.Wro(err)
+	}
+	if err := temp.Close(); err != nil {
+		return erero.Wro(err)
+	}
+	if err := os.Chmod(tempPath, info.Mode().Perm()); err != nil {
+		return erero.Wro(err)
+	}
+	if ok {
+		if err := os.Lchown(tempPath, owner.uid, owner.gid); err != nil {
+			zaplog.LOG.Debug("clang-format", zap.String("path", path), zap.String("fallback", "in-place write, owner can not be kept"))
+			return writeInPlace(path, data, info, mtime)
+		}
+	}
+	if mtime == MtimePreserve {
+		if err := os.Chtimes(tempPath, time.Now(), info.ModTime()); err != nil {
+			return erero.Wro(err)
+		}
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return erero.Wro(err)
+	}
+	return syncDIR(filepath.Dir(path))
+}
+
+// writeInPlace truncates and rewrites the file, keeping its inode, links and owner
+// writeInPlace 截断并重写文件，保持其 inode、链接和所有者
+func writeInPlace(path string, data []byte, info os.FileInfo, mtime MtimePolicy) error {
+	if err := os.WriteFile(path, data, info.Mode().Perm()); err != nil {
+		return erero.Wro(err)
+	}
+	if mtime == MtimePreserve {
+		if err := os.Chtimes(path, time.Now(), info.ModTime()); err != nil {
+			return erero.Wro(err)
+		}
+	}
+	return nil
+}
+
+// syncDIR flushes the DIR entry of a rename, DIRs that can not be synced are skipped
+// syncDIR 刷新重命名产生的目录项，无法同步的目录会被跳过
+func syncDIR(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	defer func() { _ = file.Close() }()
+	_ = file.Sync()
+	return nil
+}
+
+// Transaction records the original content of each file written through the Options it is set on
+// Rollback restores every recorded file, giving all-or-nothing semantics to bulk formatting
+//
+// Transaction 记录通过其所在 Options 写入的每个文件的原始内容
+// Rollback 恢复全部已记录的文件，为批量格式化提供全有或全无的语义
+type Transaction struct {
+	mutex     sync.Mutex
+	snapshots []*snapshot
+}
+
+// snapshot is the state of a file before its first write inside the Transaction
+// snapshot 是文件在 Transaction 中首次写入前的状态
+type snapshot struct {
+	path string
+	data []byte
+	info os.FileInfo
+}
+
+// NewTransaction creates an empty Transaction, set it on the Options with WithTransaction to record the written files
+//
+// NewTransaction 创建空的 Transaction，通过 WithTransaction 设置到 Options 上以记录写入的文件
+func NewTransaction() *Transaction {
+	return &Transaction{}
+}
+
+// Commit keeps the written files and forgets their original contents, a later Rollback restores nothing
+//
+// Commit 保留已写入的文件并丢弃其原始内容，之后的 Rollback 不会恢复任何文件
+func (t *Transaction) Commit() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.snapshots = nil
+}
+
+// Rollback restores the recorded files in reverse write order
+// Each file gets back its content, permissions and mtime, restore errors are joined
+//
+// Rollback 按写入的相反顺序恢复已记录的文件
+// 每个文件恢复其内容、权限和修改时间，恢复中的错误会被合并返回
+func (t *Transaction) Rollback() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var failed []string
+	for idx := len(t.snapshots) - 1; idx >= 0; idx-- {
+		snapshot := t.snapshots[idx]
+		zaplog.LOG.Debug("clang-format", zap.String("rollback", snapshot.path))
+		if err := writeFile(snapshot.path, snapshot.data, snapshot.info, MtimePreserve); err != nil {
+			zaplog.LOG.Error("clang-format", zap.String("rollback", snapshot.path), zap.Error(err))
+			failed = append(failed, snapshot.path)
+		}
+	}
+	t.snapshots = nil
+	if len(failed) > 0 {
+		return erero.Errorf("rollback failed on %d files: %v", len(failed), failed)
+	}
+	return nil
+}
+
+// Paths returns the files written inside the Transaction in write order
+//
+// Paths 按写入顺序返回 Transaction 中写入的文件
+func (t *Transaction) Paths() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var paths []string
+	for _, snapshot := range t.snapshots {
+		paths = append(paths, snapshot.path)
+	}
+	return paths
+}
+
+// track records the file before its first write, a nil Transaction records nothing
+// track 在文件首次写入前记录其状态，nil 的 Transaction 不做记录
+func (t *Transaction) track(path string, data []byte, info os.FileInfo) error {
+	if t == nil {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if slices.ContainsFunc(t.snapshots, func(snapshot *snapshot) bool { return snapshot.path == path }) {
+		return nil
+	}
+	t.snapshots = append(t.snapshots, &snapshot{path: path, data: data, info: info})
+	return nil
+}
+
+// Transact runs the function inside a Transaction, rolling back every written file when it fails
+// The function formats through the Options it receives, the files written through them are recorded
+// Panics are rolled back too and then re-raised, so must-style callers keep their behavior
+//
+// Transact 在 Transaction 中运行函数，失败时回滚所有已写入的文件
+// 函数通过其接收的 Options 进行格式化，经由它写入的文件会被记录
+// 发生 panic 时同样回滚后再重新抛出，使 must 风格的调用方行为不变
+func Transact(run func(options *Options) error) error {
+	return NewOptions().Transact(run)
+}
+
+// Transact runs the function like the package Transact, passing a copy of the options with a new Transaction
+// Transact 像包级 Transact 一样运行函数，传入带有新 Transaction 的 options 副本
+func (o *Options) Transact(run func(options *Options) error) error {
+	transaction := NewTransaction()
+	options := *o
+	options.transaction = transaction
+	defer func() {
+		if reason := recover(); reason != nil {
+			if err := transaction.Rollback(); err != nil {
+				zaplog.LOG.Error("clang-format", zap.Error(err))
+			}
+			panic(reason)
+		}
+	}()
+	if err := run(&options); err != nil {
+		if rollbackErr := transaction.Rollback(); rollbackErr != nil {
+			return erero.WithMessage(err, rollbackErr.Error())
+		}
+		return erero.Wro(err)
+	}
+	transaction.Commit()
+	return nil
+}
+
+// FormatProjectTransactional formats the project like FormatProject with all-or-nothing semantics
+// When any file fails, every file already rewritten gets its original content back
+//
+// FormatProjectTransactional 以全有或全无的语义像 FormatProject 一样格式化项目
+// 任何文件失败时，所有已改写的文件都会恢复原始内容
+func FormatProjectTransactional(config *osexec.ExecConfig, projectPath string, extension string, style *Style) error {
+	return NewOptions().FormatProjectTransactional(config, projectPath, extension, style)
+}
+
+// FormatProjectTransactional formats the project like the package FormatProjectTransactional, with the settings of the options
+// FormatProjectTransactional 像包级 FormatProjectTransactional 一样格式化项目，使用 options 的设置
+func (o *Options) FormatProjectTransactional(config *osexec.ExecConfig, projectPath string, extension string, style *Style) error {
+	return o.Transact(func(options *Options) error {
+		return options.FormatProject(config, projectPath, extension, style)
+	})
+}
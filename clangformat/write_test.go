@@ -0,0 +1,168 @@
+package clangformat_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/rese"
+)
+
+func TestWriteFile(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-write-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	path := filepath.Join(tempDIR, "demo.cc")
+	must.Done(os.WriteFile(path, []byte("int  x;\n"), 0640))
+	must.Done(os.Chmod(path, 0640))
+
+	require.NoError(t, clangformat.WriteFile(path, []byte("int x;\n")))
+	require.Equal(t, "int x;\n", string(rese.V1(os.ReadFile(path))))
+	// 权限保持不变，且不会遗留临时文件
+	require.Equal(t, os.FileMode(0640), rese.V1(os.Stat(path)).Mode().Perm())
+	require.Len(t, rese.V1(os.ReadDir(tempDIR)), 1)
+}
+
+func TestFormatIgnoresStderr(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("runs sh scripts")
+	}
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-stderr-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	// 在标准错误输出警告的 clang-format 脚本
+	binDIR := filepath.Join(tempDIR, "bin")
+	must.Done(os.Mkdir(binDIR, 0755))
+	must.Done(os.WriteFile(filepath.Join(binDIR, "clang-format"), []byte("#!/bin/sh\necho 'warning: unknown key' >&2\ntr -s ' '\n"), 0755))
+	t.Setenv("PATH", binDIR+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// 就地格式化只写入标准输出，警告不会进入文件
+	path := filepath.Join(tempDIR, "demo.cc")
+	must.Done(os.WriteFile(path, []byte("int  x;\n"), 0644))
+	rese.V1(clangformat.Format(osexec.NewExecConfig(), path, clangformat.NewStyle()))
+	require.Equal(t, "int x;\n", string(rese.V1(os.ReadFile(path))))
+}
+
+func TestWriteFileSymlink(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-write-link-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	target := filepath.Join(tempDIR, "target.cc")
+	link := filepath.Join(tempDIR, "link.cc")
+	must.Done(os.WriteFile(target, []byte("int  x;\n"), 0644))
+	must.Done(os.Symlink(target, link))
+
+	// 写入符号链接时写入其指向的文件，链接本身保持不变
+	require.NoError(t, clangformat.WriteFile(link, []byte("int x;\n")))
+	require.Equal(t, "int x;\n", string(rese.V1(os.ReadFile(target))))
+	require.Equal(t, target, rese.V1(os.Readlink(link)))
+}
+
+func TestWriteFileHardLink(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-write-hard-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	path := filepath.Join(tempDIR, "demo.cc")
+	other := filepath.Join(tempDIR, "other.cc")
+	must.Done(os.WriteFile(path, []byte("int  x;\n"), 0644))
+	must.Done(os.Link(path, other))
+
+	// 有多个硬链接的文件就地写入，所有链接看到相同的新内容
+	require.NoError(t, clangformat.WriteFile(path, []byte("int x;\n")))
+	require.Equal(t, "int x;\n", string(rese.V1(os.ReadFile(other))))
+}
+
+func TestWriteFileMtimePreserve(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-write-mtime-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	path := filepath.Join(tempDIR, "demo.cc")
+	must.Done(os.WriteFile(path, []byte("int  x;\n"), 0644))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	must.Done(os.Chtimes(path, mtime, mtime))
+
+	options := clangformat.NewOptions().WithMtimePolicy(clangformat.MtimePreserve)
+	require.NoError(t, options.WriteFile(path, []byte("int x;\n")))
+	require.True(t, mtime.Equal(rese.V1(os.Stat(path)).ModTime()))
+}
+
+func TestTransact(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-transact-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	first := filepath.Join(tempDIR, "a.cc")
+	second := filepath.Join(tempDIR, "b.cc")
+	must.Done(os.WriteFile(first, []byte("int  a;\n"), 0644))
+	must.Done(os.WriteFile(second, []byte("int  b;\n"), 0600))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	must.Done(os.Chtimes(first, mtime, mtime))
+
+	// 任何一步失败时，所有已写入的文件恢复原始内容、权限和修改时间
+	err := clangformat.Transact(func(options *clangformat.Options) error {
+		must.Done(options.WriteFile(first, []byte("int a;\n")))
+		must.Done(options.WriteFile(first, []byte("int a; \n")))
+		must.Done(options.WriteFile(second, []byte("int b;\n")))
+		return erero.New("formatting failed")
+	})
+	require.Error(t, err)
+	require.Equal(t, "int  a;\n", string(rese.V1(os.ReadFile(first))))
+	require.Equal(t, "int  b;\n", string(rese.V1(os.ReadFile(second))))
+	require.True(t, mtime.Equal(rese.V1(os.Stat(first)).ModTime()))
+	require.Equal(t, os.FileMode(0600), rese.V1(os.Stat(second)).Mode().Perm())
+
+	// panic 同样回滚并重新抛出
+	require.Panics(t, func() {
+		_ = clangformat.Transact(func(options *clangformat.Options) error {
+			must.Done(options.WriteFile(first, []byte("int a;\n")))
+			panic("formatting failed")
+		})
+	})
+	require.Equal(t, "int  a;\n", string(rese.V1(os.ReadFile(first))))
+
+	// 成功时保留写入的内容
+	require.NoError(t, clangformat.Transact(func(options *clangformat.Options) error {
+		return options.WriteFile(first, []byte("int a;\n"))
+	}))
+	require.Equal(t, "int a;\n", string(rese.V1(os.ReadFile(first))))
+}
+
+func TestTransactionOptions(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-transaction-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	first := filepath.Join(tempDIR, "a.cc")
+	second := filepath.Join(tempDIR, "b.cc")
+	must.Done(os.WriteFile(first, []byte("int  a;\n"), 0644))
+	must.Done(os.WriteFile(second, []byte("int  b;\n"), 0644))
+
+	// 每个 Options 只记录经由它写入的文件，两个事务可以同时进行
+	transaction := clangformat.NewTransaction()
+	other := clangformat.NewTransaction()
+	must.Done(clangformat.NewOptions().WithTransaction(transaction).WriteFile(first, []byte("int a;\n")))
+	must.Done(clangformat.NewOptions().WithTransaction(other).WriteFile(second, []byte("int b;\n")))
+	require.Equal(t, []string{rese.V1(filepath.EvalSymlinks(first))}, transaction.Paths())
+
+	// 回滚只恢复本事务记录的文件
+	must.Done(transaction.Rollback())
+	require.Equal(t, "int  a;\n", string(rese.V1(os.ReadFile(first))))
+	require.Equal(t, "int b;\n", string(rese.V1(os.ReadFile(second))))
+
+	// 提交之后回滚不再恢复任何文件
+	other.Commit()
+	must.Done(other.Rollback())
+	require.Equal(t, "int b;\n", string(rese.V1(os.ReadFile(second))))
+}
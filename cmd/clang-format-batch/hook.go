@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/gitformat"
+	"github.com/spf13/cobra"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/rese"
+)
+
+// newHookCommand creates the hook subcommand managing the git pre-commit hook
+// install writes a pre-commit script calling hook run with the given settings, uninstall removes it
+//
+// newHookCommand 创建管理 git pre-commit 钩子的 hook 子命令
+// install 写入以给定设置调用 hook run 的 pre-commit 脚本，uninstall 将其删除
+func newHookCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "hook",
+		Short: "Install, uninstall or run the git pre-commit hook formatting staged files",
+	}
+	command.AddCommand(newHookInstallCommand())
+	command.AddCommand(newHookUninstallCommand())
+	command.AddCommand(newHookRunCommand())
+	return command
+}
+
+// hookFlags are the hook run settings, install passes them on to the hook script
+// hookFlags 是 hook run 的设置，install 将其传给钩子脚本
+type hookFlags struct {
+	extensions string
+	check      bool
+	restage    bool
+	languages  registryFlags
+}
+
+// bind adds the settings as flags of the command
+// bind 将这些设置添加为命令的标志
+func (f *hookFlags) bind(command *cobra.Command) {
+	command.Flags().StringVarP(&f.extensions, "extensions", "e", "", "comma-separated file extensions of the staged files to format (e.g., .proto,.c,.cpp,.h)")
+	command.Flags().BoolVar(&f.check, "check", false, "only report staged files that are not formatted, exit 1 when found")
+	command.Flags().BoolVar(&f.restage, "restage", false, "write the formatted contents into the index so the commit goes on with them")
+	f.languages.bind(command)
+}
+
+// args returns the settings as hook run arguments
+// args 以 hook run 参数的形式返回这些设置
+func (f *hookFlags) args() []string {
+	args := append([]string{"--extensions", f.extensions}, f.languages.args()...)
+	if f.check {
+		args = append(args, "--check")
+	}
+	if f.restage {
+		args = append(args, "--restage")
+	}
+	return args
+}
+
+// newHookInstallCommand creates hook install, the hook script repeats the settings given to it
+// newHookInstallCommand 创建 hook install，钩子脚本沿用传给它的设置
+func newHookInstallCommand() *cobra.Command {
+	var flags hookFlags
+	var executableFlag string
+	var forceFlag bool
+
+	command := &cobra.Command{
+		Use:   "install",
+		Short: "Install a pre-commit hook formatting the staged files with the given settings",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(parseExtensions(flags.extensions)) == 0 {
+				cmd.PrintErrln("ERROR: no valid extensions provided. Use --extensions to set file extensions.")
+				return
+			}
+			config := osexec.NewExecConfig().WithPath(rese.C1(os.Getwd()))
+			config = config.WithPath(rese.C1(gitformat.RepoRoot(config)))
+			hookPath := rese.C1(gitformat.Install(config, append([]string{executableFlag, "hook", "run"}, flags.args()...), forceFlag))
+			cmd.Println("installed " + hookPath)
+		},
+	}
+	flags.bind(command)
+	command.Flags().StringVar(&executableFlag, "executable", "clang-format-batch", "command the hook runs, use an absolute path when it is not on PATH")
+	command.Flags().BoolVar(&forceFlag, "force", false, "replace a pre-commit hook not installed by clang-format-batch")
+	return command
+}
+
+// newHookUninstallCommand creates hook uninstall, hooks written by others are kept unless forced
+// newHookUninstallCommand 创建 hook uninstall，他人编写的钩子在未强制时保留
+func newHookUninstallCommand() *cobra.Command {
+	var forceFlag bool
+
+	command := &cobra.Command{
+		Use:   "uninstall",
+		Short: "Remove the pre-commit hook installed by hook install",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			config := osexec.NewExecConfig().WithPath(rese.C1(os.Getwd()))
+			config = config.WithPath(rese.C1(gitformat.RepoRoot(config)))
+			hookPath := rese.C1(gitformat.Uninstall(config, forceFlag))
+			cmd.Println("uninstalled " + hookPath)
+		},
+	}
+	command.Flags().BoolVar(&forceFlag, "force", false, "remove the pre-commit hook even when it was not installed by clang-format-batch")
+	return command
+}
+
+// newHookRunCommand creates hook run, the command the installed pre-commit hook executes
+// newHookRunCommand 创建 hook run，即已安装的 pre-commit 钩子执行的命令
+func newHookRunCommand() *cobra.Command {
+	var flags hookFlags
+
+	command := &cobra.Command{
+		Use:   "run",
+		Short: "Format or check the staged files, as the pre-commit hook does",
+		Long:  "run formats the staged version of each staged file, partially staged files keep their unstaged worktree changes, exits 1 when the commit should stop",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			extensions := parseExtensions(flags.extensions)
+			if len(extensions) == 0 {
+				cmd.PrintErrln("ERROR: no valid extensions provided. Use --extensions to set file extensions.")
+				os.Exit(1)
+			}
+			config := osexec.NewExecConfig().WithPath(rese.C1(os.Getwd()))
+			config = config.WithPath(rese.C1(gitformat.RepoRoot(config)))
+
+			options := clangformat.NewOptions()
+			registry, err := flags.languages.build(config.Path, options)
+			if err != nil {
+				cmd.PrintErrln("ERROR: " + err.Error())
+				os.Exit(1)
+			}
+			hook := gitformat.NewHook(config, registry).WithOptions(options).WithExtensions(extensions).WithCheck(flags.check).WithRestage(flags.restage)
+
+			var stop bool
+			for _, result := range rese.V1(hook.Run()) {
+				switch {
+				case flags.check:
+					cmd.PrintErrln("not formatted: " + result.Path)
+					stop = true
+				case result.Restaged:
+					cmd.PrintErrln("formatted and restaged: " + result.Path)
+				case result.Partial:
+					cmd.PrintErrln("not formatted, partially staged so left for you to fix: " + result.Path)
+					stop = true
+				default:
+					cmd.PrintErrln("formatted, review and stage again: " + result.Path)
+					stop = true
+				}
+			}
+			if stop {
+				cmd.PrintErrln("commit stopped by clang-format-batch hook, skip it with git commit --no-verify")
+				os.Exit(1)
+			}
+		},
+	}
+	flags.bind(command)
+	return command
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-xlan/clang-format/protoformat"
+	"github.com/spf13/cobra"
+	"github.com/yyle88/osexistpath/osmustexist"
+	"github.com/yyle88/rese"
+)
+
+// newLintCommand creates the lint subcommand checking .proto naming conventions
+// Relative paths resolve against the current DIR and are walked the same way as formatting
+//
+// newLintCommand 创建检查 .proto 命名约定的 lint 子命令
+// 相对路径基于当前目录解析，并以与格式化相同的方式遍历
+func newLintCommand() *cobra.Command {
+	var rootFlag string
+	var rulesFlag []string
+	var zeroSuffixFlag string
+
+	command := &cobra.Command{
+		Use:   "lint [paths...]",
+		Short: "Check naming conventions of .proto files",
+		Long:  "lint reports .proto naming convention violations by file and line, and exits 1 when any are found",
+		Args:  cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			projectPath := rootFlag
+			if projectPath == "" {
+				projectPath = rese.C1(os.Getwd())
+			}
+			projectPath = rese.C1(filepath.Abs(projectPath))
+			osmustexist.MustRoot(projectPath)
+			targets, err := resolvePaths(projectPath, args)
+			if err != nil {
+				return err
+			}
+
+			config := protoformat.NewLintConfig()
+			if len(rulesFlag) > 0 {
+				config.Rules = rese.V1(protoformat.ParseLintRules(rulesFlag))
+			}
+			config.ZeroValueSuffix = zeroSuffixFlag
+
+			var violations []*protoformat.Violation
+			for _, path := range targets {
+				if osmustexist.IsFile(path) {
+					violations = append(violations, rese.V1(protoformat.LintFile(path, config))...)
+				} else {
+					osmustexist.MustRoot(path)
+					violations = append(violations, rese.V1(protoformat.LintProject(path, config))...)
+				}
+			}
+			for _, violation := range violations {
+				cmd.PrintErrln(violation.String())
+			}
+			if len(violations) > 0 {
+				return fmt.Errorf("found %d naming violations", len(violations))
+			}
+			return nil
+		},
+	}
+	command.Flags().StringVar(&rootFlag, "root", "", "project root DIR, linted when no paths are given (default: current DIR)")
+	command.Flags().StringSliceVar(&rulesFlag, "rules", nil, "comma-separated rules to check (default: all), e.g. MESSAGE_PASCAL_CASE,FIELD_LOWER_SNAKE_CASE")
+	command.Flags().StringVar(&zeroSuffixFlag, "zero-value-suffix", "_UNSPECIFIED", "suffix required on enum zero values")
+	return command
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/lspformat"
+	"github.com/spf13/cobra"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/rese"
+	"github.com/yyle88/zaplog"
+)
+
+// newLSPCommand creates the lsp subcommand serving document formatting to editors over stdio
+// Stdout carries the protocol, so logs are sent to stderr
+//
+// newLSPCommand 创建通过标准输入输出为编辑器提供文档格式化的 lsp 子命令
+// 标准输出承载协议内容，因此日志输出到标准错误
+func newLSPCommand() *cobra.Command {
+	var languageFlags registryFlags
+
+	command := &cobra.Command{
+		Use:   "lsp",
+		Short: "Run a Language Server Protocol server formatting documents over stdio",
+		Long:  "lsp answers textDocument/formatting, rangeFormatting and onTypeFormatting with the project styles, so every editor gets the same formatting",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logConfig := zaplog.NewConfig()
+			logConfig.OutputPaths = []string{"stderr"}
+			zaplog.SetLog(rese.P1(zaplog.NewZapLog(logConfig)))
+
+			projectPath := rese.C1(os.Getwd())
+			options := clangformat.NewOptions()
+			registry, err := languageFlags.build(projectPath, options)
+			if err != nil {
+				cmd.PrintErrln("ERROR: " + err.Error())
+				os.Exit(1)
+			}
+
+			server := lspformat.NewServer(osexec.NewExecConfig().WithPath(projectPath), registry).WithOptions(options)
+			if err := server.Serve(os.Stdin, os.Stdout); err != nil {
+				cmd.PrintErrln("ERROR: " + err.Error())
+				os.Exit(1)
+			}
+		},
+	}
+	languageFlags.bind(command)
+	return command
+}
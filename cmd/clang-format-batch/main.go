@@ -1,84 +1,441 @@
 // clang-format-batch: Protocol Buffers and C/C++ batch file formatter
 // Provides batch formatting workflow for multiple file types in projects
 // Supports project-wide batch formatting with customizable extension lists
+// Accepts DIRs and single files as arguments, relative ones resolved against the current DIR
 //
 // clang-format-batch: Protocol Buffers 和 C/C++ 批量文件格式化工具
 // 为项目中的多种文件类型提供批量格式化工作流程
 // 支持项目范围的批量格式化，可自定义扩展名列表
+// 接受目录和单个文件作为参数，相对路径基于当前目录解析
 package main
 
 import (
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/go-xlan/clang-format/cgoformat"
 	"github.com/go-xlan/clang-format/clangformat"
-	"github.com/go-xlan/clang-format/protoformat"
+	"github.com/go-xlan/clang-format/goembedformat"
+	"github.com/go-xlan/clang-format/internal/utils"
+	"github.com/go-xlan/clang-format/mdformat"
 	"github.com/spf13/cobra"
-	"github.com/yyle88/must"
 	"github.com/yyle88/osexec"
+	"github.com/yyle88/osexistpath/osmustexist"
 	"github.com/yyle88/rese"
 )
 
 func main() {
-	// Get current working DIR as default project root
-	// 获取当前工作 DIR 作为默认项目根目录
-	projectPath := rese.C1(os.Getwd())
+	// Execute the CLI application
+	// 执行 CLI 应用程序
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
 
+// newRootCommand creates the root command formatting the paths, with the subcommands attached
+// newRootCommand 创建格式化路径的根命令，并附加各个子命令
+func newRootCommand() *cobra.Command {
 	// Command line flags
 	// 命令行标志
 	var extensionsFlag string
+	var rootFlag string
+	var filesFromFlag string
+	var extensionlessFlag []string
+	var cgoFlag bool
+	var goEmbedFlag bool
+	var markdownFlag bool
+	var markdownCheckFlag bool
+	var languageFlags registryFlags
+	var transactionalFlag bool
+	var keepMtimeFlag bool
+	var backupFlag bool
+	var backupDIRFlag string
+	var backupKeepFlag int
+	var backupMaxAgeFlag time.Duration
+	var cacheFlag bool
+	var cacheDIRFlag string
+	var lineEndingFlag string
+	var bomFlag string
+	var finalNewlineFlag string
+	var editorConfigFlag bool
 
 	// Create and configure root command
 	// 创建并配置根命令
 	rootCmd := &cobra.Command{
-		Use:   "clang-format-batch",
+		Use:   "clang-format-batch [paths...]",
 		Short: "Batch file formatter using clang-format",
 		Long:  "clang-format-batch formats multiple file types with specified extensions using clang-format",
-		Run: func(cmd *cobra.Command, args []string) {
+		Args:  cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// Failures found by the run are returned after the deferred steps finish, the usage is not printed for them
+			// 运行中发现的问题在延迟步骤完成后返回，不为其打印用法
+			cmd.SilenceUsage = true
+
 			// Parse extensions from flag
 			// 从标志解析扩展名
-			var extensions []string
-			for _, extension := range strings.Split(extensionsFlag, ",") {
-				extension = strings.TrimSpace(extension)
-				if extension == "" {
-					continue
+			extensions := parseExtensions(extensionsFlag)
+			if len(extensions) == 0 && !cgoFlag && !goEmbedFlag && !markdownFlag && !markdownCheckFlag {
+				cmd.PrintErrln("ERROR: no valid extensions provided. Use --extensions to set file extensions.")
+				return nil
+			}
+
+			// Use --root as project root, default to current working DIR
+			// 使用 --root 作为项目根目录，默认使用当前工作目录
+			projectPath := rootFlag
+			if projectPath == "" {
+				projectPath = rese.C1(os.Getwd())
+			}
+			projectPath = rese.C1(filepath.Abs(projectPath))
+			osmustexist.MustRoot(projectPath)
+
+			// Append paths listed in --files-from, keeping only existing files with matching extensions
+			// 追加 --files-from 中列出的路径，只保留存在且扩展名匹配的文件
+			paths := args
+			if filesFromFlag != "" {
+				for _, path := range utils.SplitFileList(readFileList(filesFromFlag)) {
+					if !utils.MatchExt(path, extensions) && !isExtraFile(path, cgoFlag || goEmbedFlag, markdownFlag || markdownCheckFlag) {
+						continue
+					}
+					// lists such as git diff --name-only also name deleted files
+					// git diff --name-only 等列表也会列出已删除的文件
+					if _, err := os.Stat(path); os.IsNotExist(err) {
+						cmd.PrintErrln("Warning: listed file '" + path + "' does not exist, skipping")
+						continue
+					}
+					paths = append(paths, path)
 				}
-				if !strings.HasPrefix(extension, ".") {
-					extension = "." + extension
+				if len(paths) == 0 {
+					return nil
 				}
-				extensions = append(extensions, extension)
 			}
-			if len(extensions) == 0 {
-				cmd.PrintErrln("ERROR: no valid extensions provided. Use --extensions to set file extensions.")
-				return
+
+			// Relative paths resolve against the current DIR, the project root is formatted when no paths are given
+			// 相对路径基于当前目录解析，未给出路径时格式化项目根目录
+			targets, err := resolvePaths(projectPath, paths)
+			if err != nil {
+				return err
 			}
 
 			// Create execution config
 			// 创建执行配置
 			execConfig := osexec.NewExecConfig().WithPath(projectPath)
 
-			// Format files for each extension
-			// 为每个扩展名格式化文件
-			for _, extension := range extensions {
-				switch extension {
-				case ".proto":
-					must.Done(protoformat.FormatProject(execConfig, projectPath, protoformat.NewStyle()))
-				case ".c", ".cpp", ".cxx", ".cc", ".h", ".hpp", ".hxx":
-					must.Done(clangformat.FormatProject(execConfig, projectPath, extension, clangformat.NewStyle()))
-				default:
-					cmd.PrintErrln("Warning: unsupported extension '" + extension + "', skipping")
+			// Line endings, BOM and final newline are restored unless a policy or .editorconfig asks otherwise
+			// 除非策略或 .editorconfig 另有要求，否则恢复换行符、BOM 和末尾换行
+			options := clangformat.NewOptions().WithEndingPolicy(&clangformat.EndingPolicy{
+				LineEnding:   rese.V1(clangformat.ParseLineEnding(lineEndingFlag)),
+				BOM:          rese.V1(clangformat.ParsePresence(bomFlag)),
+				FinalNewline: rese.V1(clangformat.ParsePresence(finalNewlineFlag)),
+				EditorConfig: editorConfigFlag,
+			})
+			defer func() {
+				for _, change := range options.TakeEndingChanges() {
+					cmd.PrintErrln("endings changed: " + change.String())
+				}
+			}()
+
+			// Files are replaced atomically, --transactional rolls every written file back when a step fails or panics
+			// 文件以原子方式替换，--transactional 在任何步骤失败或 panic 时回滚所有已写入的文件
+			if keepMtimeFlag {
+				options.WithMtimePolicy(clangformat.MtimePreserve)
+			}
+			if cacheFlag {
+				cacheDIR := cacheDIRFlag
+				if cacheDIR == "" {
+					cacheDIR = rese.C1(clangformat.DefaultCacheDIR())
+				}
+				cache := rese.P1(clangformat.OpenCache(cacheDIR, rese.C1(options.ClangFormatVersion(execConfig))))
+				options.WithCache(cache)
+				defer func() {
+					hits, misses := cache.Close()
+					cmd.PrintErrf("Cache: %d files skipped, %d files formatted\n", hits, misses)
+				}()
+			}
+			if backupFlag {
+				backupDIR := backupDIRFlag
+				if backupDIR == "" {
+					backupDIR = rese.C1(clangformat.DefaultBackupDIR())
+				}
+				journal := rese.P1(clangformat.OpenJournal(backupDIR))
+				options.WithJournal(journal)
+				defer func() {
+					if count := rese.V1(journal.Close()); count > 0 {
+						cmd.PrintErrf("Backed up %d files as run %s, restore with: clang-format-batch undo %s\n", count, journal.RunID, journal.RunID)
+					}
+					rese.V1(clangformat.PruneRuns(backupDIR, backupMaxAgeFlag, backupKeepFlag))
+				}()
+			}
+			if transactionalFlag {
+				transaction := clangformat.NewTransaction()
+				options.WithTransaction(transaction)
+				defer func() {
+					reason := recover()
+					if reason == nil && err == nil {
+						transaction.Commit()
+						return
+					}
+					paths := transaction.Paths()
+					if rollbackErr := transaction.Rollback(); rollbackErr != nil {
+						cmd.PrintErrln("ERROR: " + rollbackErr.Error())
+					} else {
+						cmd.PrintErrf("Rolled back %d files\n", len(paths))
+					}
+					if reason != nil {
+						panic(reason)
+					}
+				}()
+			}
+
+			// Build the language registry, custom mappings are applied on top of defaults
+			// 构建语言注册表，自定义映射叠加在默认值之上
+			registry, err := languageFlags.build(projectPath, options)
+			if err != nil {
+				cmd.PrintErrln("ERROR: " + err.Error())
+				return nil
+			}
+
+			// failure is returned at the end, once every step has run
+			// failure 在所有步骤运行完毕后于末尾返回
+			var failure error
+
+			// Format each path, overlapping paths are merged first
+			// 格式化每个路径，重叠的路径会先合并
+			for _, path := range targets {
+				if osmustexist.IsFile(path) {
+					if isExtraFile(path, cgoFlag || goEmbedFlag, markdownFlag || markdownCheckFlag) {
+						continue // handled in the cgo, go-embed and markdown steps below // 在下面的 cgo、go-embed 和 markdown 步骤中处理
+					}
+					if err := formatFile(cmd, execConfig, registry, path, extensions); err != nil {
+						return err
+					}
+				} else {
+					osmustexist.MustRoot(path)
+					if err := formatRoot(cmd, execConfig, registry, path, extensions); err != nil {
+						return err
+					}
+				}
+			}
+
+			// Format C code in cgo preambles of .go files
+			// 格式化 .go 文件中 cgo 前导注释里的 C 代码
+			if cgoFlag {
+				cgoFormatter := cgoformat.NewFormatter().WithOptions(options)
+				for _, path := range targets {
+					if osmustexist.IsFile(path) {
+						if utils.MatchExt(path, []string{".go"}) {
+							if _, err := cgoFormatter.Format(execConfig, path, cgoformat.NewStyle()); err != nil {
+								return err
+							}
+						}
+					} else if err := cgoFormatter.FormatProject(execConfig, path, cgoformat.NewStyle()); err != nil {
+						return err
+					}
+				}
+			}
+
+			// Format tagged raw string literals and go:embed files of .go files
+			// 格式化 .go 文件中带标记的原始字符串字面量和 go:embed 文件
+			if goEmbedFlag {
+				goEmbedFormatter := goembedformat.NewFormatter().WithOptions(options)
+				for _, path := range targets {
+					if osmustexist.IsFile(path) {
+						if utils.MatchExt(path, []string{".go"}) {
+							if _, err := goEmbedFormatter.Format(execConfig, path, goembedformat.NewStyle()); err != nil {
+								return err
+							}
+							if err := goembedformat.FormatEmbeds(execConfig, registry, path); err != nil {
+								return err
+							}
+						}
+					} else if err := goEmbedFormatter.FormatProject(execConfig, registry, path, goembedformat.NewStyle()); err != nil {
+						return err
+					}
+				}
+			}
+
+			// Format or check fenced code blocks in .md files
+			// 格式化或检查 .md 文件中的围栏代码块
+			if markdownFlag || markdownCheckFlag {
+				markdownFormatter := mdformat.NewFormatter().WithOptions(options)
+				var issues []*mdformat.Issue
+				for _, path := range targets {
+					var found []*mdformat.Issue
+					switch {
+					case osmustexist.IsFile(path) && !utils.MatchExt(path, []string{".md"}):
+						continue
+					case osmustexist.IsFile(path) && markdownCheckFlag:
+						found, err = markdownFormatter.Check(execConfig, path, mdformat.NewStyle())
+					case osmustexist.IsFile(path):
+						_, err = markdownFormatter.Format(execConfig, path, mdformat.NewStyle())
+					case markdownCheckFlag:
+						found, err = markdownFormatter.CheckProject(execConfig, path, mdformat.NewStyle())
+					default:
+						err = markdownFormatter.FormatProject(execConfig, path, mdformat.NewStyle())
+					}
+					if err != nil {
+						return err
+					}
+					issues = append(issues, found...)
+				}
+				for _, issue := range issues {
+					cmd.PrintErrf("%s:%d: unformatted %s code block\n", issue.Path, issue.Line, issue.Language)
+				}
+				if len(issues) > 0 {
+					failure = fmt.Errorf("found %d unformatted code blocks", len(issues))
+				}
+			}
+
+			// Format extensionless headers under the configured DIRs, language detected from content
+			// 格式化配置目录下的无扩展名头文件，根据内容检测语言
+			if len(extensionlessFlag) > 0 {
+				language, ok := registry.LookupName("Cpp")
+				if !ok {
+					cmd.PrintErrln("ERROR: language Cpp not registered, can not format extensionless files")
+					return failure
+				}
+				for _, path := range utils.MergePaths(projectPath, extensionlessFlag) {
+					osmustexist.MustRoot(path)
+					if err := options.FormatProject(execConfig, path, "", language.NewStyle()); err != nil {
+						return err
+					}
 				}
 			}
+			return failure
 		},
 	}
 
 	// Add flags
 	// 添加标志
 	rootCmd.Flags().StringVarP(&extensionsFlag, "extensions", "e", "", "comma-separated file extensions (e.g., .proto,.c,.cpp,.h)")
+	rootCmd.Flags().StringVar(&rootFlag, "root", "", "project root DIR where clang-format runs, formatted when no paths are given (default: current DIR)")
+	languageFlags.bind(rootCmd)
+	rootCmd.Flags().StringSliceVar(&extensionlessFlag, "extensionless-dirs", nil, "also format extensionless C/C++/ObjC headers under these DIRs, language detected from content")
+	rootCmd.Flags().BoolVar(&cgoFlag, "cgo", false, "also format C code in cgo preambles of .go files")
+	rootCmd.Flags().BoolVar(&goEmbedFlag, "go-embed", false, "also format raw string literals tagged //clang-format:lang=<language> and go:embed files of .go files")
+	rootCmd.Flags().BoolVar(&markdownFlag, "markdown", false, "also format fenced C/C++/proto code blocks in .md files")
+	rootCmd.Flags().BoolVar(&markdownCheckFlag, "markdown-check", false, "report unformatted fenced code blocks in .md files by line, exit 1 when found")
+	rootCmd.Flags().BoolVar(&transactionalFlag, "transactional", false, "all-or-nothing run: restore every rewritten file when any file fails to format")
+	rootCmd.Flags().BoolVar(&keepMtimeFlag, "keep-mtime", false, "keep the modification time of rewritten files instead of setting it to the write time")
+	rootCmd.Flags().BoolVar(&backupFlag, "backup", false, "record the original contents of every rewritten file under a run ID, restore them with the undo command")
+	rootCmd.Flags().StringVar(&backupDIRFlag, "backup-dir", "", "DIR holding the backup journals (default: user cache DIR)")
+	rootCmd.Flags().IntVar(&backupKeepFlag, "backup-keep", 20, "number of newest backup runs to keep, 0 keeps all")
+	rootCmd.Flags().DurationVar(&backupMaxAgeFlag, "backup-max-age", 30*24*time.Hour, "remove backup runs older than this, 0 keeps them regardless of age")
+	rootCmd.Flags().BoolVar(&cacheFlag, "cache", false, "skip files whose content is cached as formatted with the same style and clang-format version")
+	rootCmd.Flags().StringVar(&cacheDIRFlag, "cache-dir", "", "DIR holding the format cache (default: user cache DIR)")
+	rootCmd.Flags().StringVar(&lineEndingFlag, "line-ending", "preserve", "line endings of rewritten files: preserve, lf or crlf")
+	rootCmd.Flags().StringVar(&bomFlag, "bom", "preserve", "UTF-8 BOM of rewritten files: preserve, add or remove")
+	rootCmd.Flags().StringVar(&finalNewlineFlag, "final-newline", "preserve", "final newline of rewritten files: preserve, add or remove")
+	rootCmd.Flags().BoolVar(&editorConfigFlag, "editorconfig", false, "take end_of_line, charset and insert_final_newline from the project .editorconfig files, overriding the flags above")
+	rootCmd.Flags().StringVar(&filesFromFlag, "files-from", "", "read newline or NUL separated file paths from the file, use - to read from stdin")
 
-	// Execute the CLI application
-	// 执行 CLI 应用程序
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+	rootCmd.AddCommand(newLintCommand())
+	rootCmd.AddCommand(newUndoCommand())
+	rootCmd.AddCommand(newWatchCommand())
+	rootCmd.AddCommand(newHookCommand())
+	rootCmd.AddCommand(newLSPCommand())
+	rootCmd.AddCommand(newServeCommand())
+	return rootCmd
+}
+
+// parseExtensions splits the comma-separated extensions flag into lowercased extensions without duplicates
+// parseExtensions 将逗号分隔的扩展名标志拆分为小写且不重复的扩展名
+func parseExtensions(extensionsFlag string) []string {
+	var extensions []string
+	for _, extension := range strings.Split(extensionsFlag, ",") {
+		extension = strings.TrimSpace(extension)
+		if extension == "" {
+			continue
+		}
+		if !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+		// extensions match regardless of case, so .CPP and .cpp name the same files
+		// 扩展名匹配时忽略大小写，因此 .CPP 与 .cpp 指向相同的文件
+		extension = strings.ToLower(extension)
+		if !slices.Contains(extensions, extension) {
+			extensions = append(extensions, extension)
+		}
+	}
+	return extensions
+}
+
+// resolvePaths resolves the path args against the current DIR and merges overlapping ones
+// The project root is returned when no args are given, an arg that does not exist is an error
+//
+// resolvePaths 基于当前目录解析路径参数并合并重叠的路径
+// 未给出参数时返回项目根目录，不存在的参数视为错误
+func resolvePaths(projectPath string, args []string) ([]string, error) {
+	if len(args) == 0 {
+		return []string{projectPath}, nil
+	}
+	currentDIR, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		path := arg
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(currentDIR, path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("path %s does not exist", arg)
+			}
+			return nil, err
+		}
+	}
+	return utils.MergePaths(currentDIR, args), nil
+}
+
+// readFileList reads the file list content from the path, or from stdin when path is "-"
+// readFileList 从路径读取文件列表内容，当路径为 "-" 时从标准输入读取
+func readFileList(path string) []byte {
+	if path == "-" {
+		return rese.V1(io.ReadAll(os.Stdin))
+	}
+	return rese.V1(os.ReadFile(path))
+}
+
+// isExtraFile reports whether the file is handled by the cgo, go-embed or markdown steps
+// isExtraFile 判断该文件是否由 cgo、go-embed 或 markdown 步骤处理
+func isExtraFile(path string, golang bool, markdown bool) bool {
+	return (golang && utils.MatchExt(path, []string{".go"})) || (markdown && utils.MatchExt(path, []string{".md"}))
+}
+
+// formatRoot formats files with each extension inside the DIR, stopping at the first failure
+// formatRoot 格式化目录中每种扩展名的文件，遇到第一个失败时停止
+func formatRoot(cmd *cobra.Command, execConfig *osexec.ExecConfig, registry *clangformat.Registry, root string, extensions []string) error {
+	for _, extension := range extensions {
+		language, ok := registry.Lookup(extension)
+		if !ok {
+			cmd.PrintErrln("Warning: unsupported extension '" + extension + "', skipping")
+			continue
+		}
+		if err := language.Formatter.FormatProject(execConfig, root, extension, language.NewStyle()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatFile formats a single file when its extension is in the list
+// formatFile 当文件扩展名在列表中时格式化该单个文件
+func formatFile(cmd *cobra.Command, execConfig *osexec.ExecConfig, registry *clangformat.Registry, path string, extensions []string) error {
+	extension := filepath.Ext(path)
+	if !utils.MatchExt(path, extensions) {
+		cmd.PrintErrln("Warning: extension of '" + path + "' not in --extensions, skipping")
+		return nil
+	}
+	language, ok := registry.Lookup(extension)
+	if !ok {
+		cmd.PrintErrln("Warning: unsupported extension '" + extension + "', skipping")
+		return nil
 	}
+	_, err := language.Formatter.Format(execConfig, path, language.NewStyle())
+	return err
 }
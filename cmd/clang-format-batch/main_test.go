@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+// fakeFailing is a clang-format stand-in squeezing repeated spaces of stdin, failing on content naming broken
+//
+// fakeFailing 是替代 clang-format 的脚本，压缩标准输入中重复的空格，内容包含 broken 时失败
+const fakeFailing = `#!/bin/sh
+input=$(cat)
+case "$input" in
+*broken*) echo "broken input" >&2; exit 1 ;;
+esac
+printf '%s\n' "$input" | tr -s ' '
+`
+
+func TestTransactionalRollsBackOnError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake clang-format is a shell script")
+	}
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "clang-format-batch-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	binDIR := filepath.Join(tempDIR, "bin")
+	must.Done(os.Mkdir(binDIR, 0755))
+	must.Done(os.WriteFile(filepath.Join(binDIR, "clang-format"), []byte(fakeFailing), 0755))
+	t.Setenv("PATH", binDIR+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	projectDIR := filepath.Join(tempDIR, "project")
+	must.Done(os.Mkdir(projectDIR, 0755))
+	goodPath := filepath.Join(projectDIR, "a.cc")
+	badPath := filepath.Join(projectDIR, "b.cc")
+	must.Done(os.WriteFile(goodPath, []byte("int  a;\n"), 0644))
+	must.Done(os.WriteFile(badPath, []byte("int  broken;\n"), 0644))
+
+	run := func(args ...string) error {
+		command := newRootCommand()
+		command.SetArgs(append([]string{"-e", ".cc", "--root", projectDIR}, args...))
+		command.SetOut(io.Discard)
+		command.SetErr(io.Discard)
+		return command.Execute()
+	}
+
+	// 第二个文件返回错误而非 panic，已格式化的第一个文件被回滚
+	require.Error(t, run("--transactional", goodPath, badPath))
+	require.Equal(t, "int  a;\n", string(rese.V1(os.ReadFile(goodPath))))
+	require.Equal(t, "int  broken;\n", string(rese.V1(os.ReadFile(badPath))))
+
+	// 不使用 --transactional 时第一个文件保持已格式化的内容
+	require.Error(t, run(goodPath, badPath))
+	require.Equal(t, "int a;\n", string(rese.V1(os.ReadFile(goodPath))))
+
+	// 全部成功时提交，文件保持格式化后的内容
+	must.Done(os.WriteFile(goodPath, []byte("int  a;\n"), 0644))
+	must.Done(run("--transactional", goodPath))
+	require.Equal(t, "int a;\n", string(rese.V1(os.ReadFile(goodPath))))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/protoformat"
+	"github.com/spf13/cobra"
+	"github.com/yyle88/erero"
+)
+
+// registryFlags are the settings of the language registry, shared by the formatting run and each subcommand
+// Every command building a registry binds them, so all of them format the same files the same way
+//
+// registryFlags 是语言注册表的设置，由格式化运行和各个子命令共用
+// 每个构建注册表的命令都绑定这些设置，使它们以相同方式格式化相同的文件
+type registryFlags struct {
+	languageMap     []string
+	protoBackend    string
+	verify          bool
+	sortImports     bool
+	importGroups    []string
+	protoLayout     bool
+	textProtoHeader bool
+	protoPath       []string
+}
+
+// bind adds the settings as flags of the command
+// bind 将这些设置添加为命令的标志
+func (f *registryFlags) bind(command *cobra.Command) {
+	command.Flags().StringSliceVar(&f.languageMap, "map", nil, "map extra extensions to registered languages (e.g., .ino=Cpp,.pde=Java)")
+	command.Flags().StringVar(&f.protoBackend, "proto-backend", string(protoformat.BackendClangFormat), "engine formatting .proto files: clang-format or native (pure Go, no clang-format needed)")
+	command.Flags().BoolVar(&f.verify, "verify", false, "refuse to write .proto and C/C++ files whose tokens change after formatting, beyond include order, reporting the first divergence")
+	command.Flags().BoolVar(&f.sortImports, "sort-imports", false, "sort, group and deduplicate import statements of .proto files before formatting")
+	command.Flags().StringSliceVar(&f.importGroups, "import-groups", []string{"well-known", "plain", "public", "weak"}, "import group order used with --sort-imports, groups left out fold into plain")
+	command.Flags().BoolVar(&f.protoLayout, "proto-layout", false, "align .proto field numbers, options and comments, normalize option spacing and separate top-level declarations")
+	command.Flags().BoolVar(&f.textProtoHeader, "textproto-header", false, "validate # proto-file: / # proto-message: headers of text format files before formatting")
+	command.Flags().StringSliceVar(&f.protoPath, "proto-path", nil, "import roots where --textproto-header looks up proto-file and its message (default: project root)")
+}
+
+// args returns the settings as command arguments, hook install passes them on to the hook script
+// args 以命令参数的形式返回这些设置，hook install 将其传给钩子脚本
+func (f *registryFlags) args() []string {
+	args := []string{"--proto-backend", f.protoBackend}
+	if len(f.languageMap) > 0 {
+		args = append(args, "--map", strings.Join(f.languageMap, ","))
+	}
+	if f.verify {
+		args = append(args, "--verify")
+	}
+	if f.sortImports {
+		args = append(args, "--sort-imports", "--import-groups", strings.Join(f.importGroups, ","))
+	}
+	if f.protoLayout {
+		args = append(args, "--proto-layout")
+	}
+	if f.textProtoHeader {
+		args = append(args, "--textproto-header")
+	}
+	if len(f.protoPath) > 0 {
+		args = append(args, "--proto-path", strings.Join(f.protoPath, ","))
+	}
+	return args
+}
+
+// build creates the language registry formatting through the options, custom mappings are applied on top of defaults
+// Relative --proto-path roots resolve against the project path
+//
+// build 创建通过 options 格式化的语言注册表，自定义映射叠加在默认值之上
+// 相对的 --proto-path 根目录基于项目路径解析
+func (f *registryFlags) build(projectPath string, options *clangformat.Options) (*clangformat.Registry, error) {
+	protoBackend, err := protoformat.ParseBackend(f.protoBackend)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	protoFormatter := protoformat.NewFormatter().WithOptions(options).WithBackend(protoBackend).WithVerify(f.verify)
+	if f.sortImports {
+		policy := protoformat.NewImportPolicy()
+		if policy.Groups, err = protoformat.ParseImportGroups(f.importGroups); err != nil {
+			return nil, erero.Wro(err)
+		}
+		protoFormatter.WithImportPolicy(policy)
+	}
+	if f.protoLayout {
+		protoFormatter.WithLayout(protoformat.NewLayoutStyle())
+	}
+	textProtoFormatter := protoformat.NewTextProtoFormatter().WithOptions(options)
+	if f.textProtoHeader {
+		protoPaths := []string{projectPath}
+		if len(f.protoPath) > 0 {
+			protoPaths = nil
+			for _, path := range f.protoPath {
+				if !filepath.IsAbs(path) {
+					path = filepath.Join(projectPath, path)
+				}
+				protoPaths = append(protoPaths, path)
+			}
+		}
+		textProtoFormatter.WithHeaderCheck(&protoformat.HeaderCheck{ProtoPaths: protoPaths})
+	}
+	registry := options.NewRegistry().Register(protoFormatter.NewLanguage()).Register(textProtoFormatter.NewLanguage())
+	if f.verify {
+		for _, name := range []string{"Cpp", "ObjC"} {
+			if language, ok := registry.LookupName(name); ok {
+				registry.Register(&clangformat.Language{Name: language.Name, Extensions: language.Extensions, NewStyle: language.NewStyle, Formatter: options.NewVerifiedFormatter()})
+			}
+		}
+	}
+	for _, mapping := range f.languageMap {
+		extension, name, ok := strings.Cut(mapping, "=")
+		if !ok {
+			return nil, erero.Errorf("invalid --map '%s', expected format .ext=Language", mapping)
+		}
+		if err := registry.Alias(extension, strings.TrimSpace(name)); err != nil {
+			return nil, erero.Wro(err)
+		}
+	}
+	return registry, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/httpformat"
+	"github.com/spf13/cobra"
+	"github.com/yyle88/must"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/rese"
+)
+
+// newServeCommand creates the serve subcommand exposing the HTTP/JSON formatting API
+// The service runs until interrupted, in-flight requests finish before it stops
+//
+// newServeCommand 创建提供 HTTP/JSON 格式化接口的 serve 子命令
+// 服务持续运行直到中断，停止前会完成处理中的请求
+func newServeCommand() *cobra.Command {
+	var listenFlag string
+	var maxBytesFlag int64
+	var concurrencyFlag int
+	var languageFlags registryFlags
+
+	command := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve format, diff, check and style endpoints over HTTP/JSON on a local port or unix socket",
+		Long:  "serve answers POST /format, /diff, /check and /style with the registered styles, each request may override style fields",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			projectPath := rese.C1(os.Getwd())
+			options := clangformat.NewOptions()
+			registry, err := languageFlags.build(projectPath, options)
+			if err != nil {
+				cmd.PrintErrln("ERROR: " + err.Error())
+				return
+			}
+
+			service := httpformat.NewServer(osexec.NewExecConfig().WithPath(projectPath), registry).
+				WithOptions(options).
+				WithMaxBytes(maxBytesFlag).
+				WithConcurrency(concurrencyFlag)
+			server := &http.Server{Handler: service.Handler(), ReadHeaderTimeout: 10 * time.Second}
+			listener := rese.V1(httpformat.Listen(listenFlag))
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			// Serve returns as soon as Shutdown starts, done is closed once the in-flight requests have finished
+			// Shutdown 开始时 Serve 立即返回，处理中的请求完成后 done 才会关闭
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				<-ctx.Done()
+				if err := server.Shutdown(context.Background()); err != nil {
+					cmd.PrintErrln("ERROR: " + err.Error())
+				}
+			}()
+			cmd.PrintErrln("Serving on " + listenFlag + ", press Ctrl+C to stop")
+			if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+				must.Done(err)
+			}
+			<-done
+		},
+	}
+	command.Flags().StringVar(&listenFlag, "listen", "127.0.0.1:7878", "TCP address to listen on, or unix:/path/to.sock for a unix socket")
+	command.Flags().Int64Var(&maxBytesFlag, "max-bytes", 1<<20, "largest request body accepted, larger requests get 413")
+	command.Flags().IntVar(&concurrencyFlag, "concurrency", runtime.NumCPU(), "formatting runs at a time, further requests wait for a free slot")
+	languageFlags.bind(command)
+	return command
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/spf13/cobra"
+	"github.com/yyle88/rese"
+)
+
+// newUndoCommand creates the undo subcommand restoring the files backed up by a --backup run
+// Without run ID the newest run is restored, --list shows the recorded runs instead
+// Files edited since the run are only overwritten with --force
+//
+// newUndoCommand 创建 undo 子命令，恢复 --backup 运行所备份的文件
+// 未指定运行 ID 时恢复最新的运行，--list 则改为列出已记录的运行
+// 运行之后被编辑过的文件只有在 --force 时才会被覆盖
+func newUndoCommand() *cobra.Command {
+	var backupDIRFlag string
+	var listFlag bool
+	var forceFlag bool
+
+	command := &cobra.Command{
+		Use:   "undo [run-id]",
+		Short: "Restore files changed by a formatting run recorded with --backup",
+		Long:  "undo restores the original contents, permissions and mtimes of the files changed by a --backup run, newest run by default",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backupDIR := backupDIRFlag
+			if backupDIR == "" {
+				backupDIR = rese.C1(clangformat.DefaultBackupDIR())
+			}
+
+			if listFlag {
+				for _, run := range rese.V1(clangformat.ListRuns(backupDIR)) {
+					cmd.Printf("%s  %s  %d files\n", run.ID, run.Started.Format(time.DateTime), len(run.Entries))
+				}
+				return nil
+			}
+
+			var runID string
+			if len(args) > 0 {
+				runID = args[0]
+			}
+			run, err := clangformat.Undo(backupDIR, runID, forceFlag)
+			if err != nil {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("undo: %s", err.Error())
+			}
+			for _, entry := range run.Entries {
+				cmd.Println("restored " + entry.Path)
+			}
+			cmd.Printf("Undid run %s, %d files restored\n", run.ID, len(run.Entries))
+			return nil
+		},
+	}
+	command.Flags().StringVar(&backupDIRFlag, "backup-dir", "", "DIR holding the backup journals (default: user cache DIR)")
+	command.Flags().BoolVar(&listFlag, "list", false, "list the recorded runs, newest first, without restoring")
+	command.Flags().BoolVar(&forceFlag, "force", false, "restore files edited since the run too, discarding those edits")
+	return command
+}
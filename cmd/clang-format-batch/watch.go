@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/internal/utils"
+	"github.com/go-xlan/clang-format/watchformat"
+	"github.com/spf13/cobra"
+	"github.com/yyle88/must"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/osexistpath/osmustexist"
+	"github.com/yyle88/rese"
+)
+
+// newWatchCommand creates the watch subcommand formatting files as they are saved
+// Paths resolve against --root, DIRs are watched with their sub DIRs until interrupted
+//
+// newWatchCommand 创建在文件保存时进行格式化的 watch 子命令
+// 路径基于 --root 解析，目录及其子目录被持续监听直到中断
+func newWatchCommand() *cobra.Command {
+	var extensionsFlag string
+	var rootFlag string
+	var languageFlags registryFlags
+	var debounceFlag time.Duration
+
+	command := &cobra.Command{
+		Use:   "watch [paths...]",
+		Short: "Format files with the given extensions as they are saved",
+		Long:  "watch listens to filesystem notifications under the paths and formats each changed file once its events settle, visiting the same files as a formatting run",
+		Args:  cobra.ArbitraryArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			extensions := parseExtensions(extensionsFlag)
+			if len(extensions) == 0 {
+				cmd.PrintErrln("ERROR: no valid extensions provided. Use --extensions to set file extensions.")
+				return
+			}
+
+			projectPath := rootFlag
+			if projectPath == "" {
+				projectPath = rese.C1(os.Getwd())
+			}
+			projectPath = rese.C1(filepath.Abs(projectPath))
+			osmustexist.MustRoot(projectPath)
+
+			registry, err := languageFlags.build(projectPath, clangformat.NewOptions())
+			if err != nil {
+				cmd.PrintErrln("ERROR: " + err.Error())
+				return
+			}
+
+			roots := utils.MergePaths(projectPath, args)
+			for _, root := range roots {
+				osmustexist.MustRoot(root)
+			}
+
+			watcher := watchformat.NewWatcher(osexec.NewExecConfig().WithPath(projectPath), registry).
+				WithExtensions(extensions).
+				WithDebounce(debounceFlag).
+				WithReport(func(report *watchformat.Report) {
+					switch {
+					case report.Err != nil:
+						cmd.PrintErrln("ERROR: " + report.Path + ": " + report.Err.Error())
+					case report.Changed:
+						cmd.Println("reformatted " + report.Path)
+					}
+				})
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			cmd.PrintErrln("Watching " + strings.Join(roots, ", ") + ", press Ctrl+C to stop")
+			must.Done(watcher.Run(ctx, roots...))
+		},
+	}
+	command.Flags().StringVarP(&extensionsFlag, "extensions", "e", "", "comma-separated file extensions (e.g., .proto,.c,.cpp,.h)")
+	command.Flags().StringVar(&rootFlag, "root", "", "project root DIR, relative path arguments resolve against it (default: current DIR)")
+	languageFlags.bind(command)
+	command.Flags().DurationVar(&debounceFlag, "debounce", 200*time.Millisecond, "how long events must settle before the changed files are formatted")
+	return command
+}
@@ -0,0 +1,252 @@
+// Package gitformat: Git pre-commit engine formatting the staged versions of files
+// Reads staged contents from the index, formats them through the registry and writes them back as new blobs
+// Partially staged files keep their unstaged worktree changes, only the index version is touched
+// Installs and removes a plain pre-commit hook script, no external hook framework needed
+//
+// gitformat: 格式化文件暂存版本的 Git pre-commit 引擎
+// 从索引读取暂存内容，通过注册表格式化后作为新的对象写回
+// 部分暂存的文件保留其未暂存的工作区修改，只处理索引中的版本
+// 安装和移除普通的 pre-commit 钩子脚本，无需外部钩子框架
+package gitformat
+
+import (
+	"bytes"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// StagedFile is a file with staged changes as recorded in the index
+//
+// StagedFile 是索引中记录的带有暂存修改的文件
+type StagedFile struct {
+	Path    string // Slash separated path relative to the repository root // 相对于仓库根目录、以斜杠分隔的路径
+	Mode    string // Index mode, such as 100644 // 索引中的模式，例如 100644
+	Blob    string // Object ID of the staged content // 暂存内容的对象 ID
+	Partial bool   // Whether the worktree has unstaged changes too // 工作区是否还有未暂存的修改
+}
+
+// RepoRoot returns the top-level DIR of the repository containing the config path
+//
+// RepoRoot 返回包含 config 路径的仓库的顶层目录
+func RepoRoot(config *osexec.ExecConfig) (string, error) {
+	output, err := config.Exec("git", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	return filepath.FromSlash(strings.TrimSpace(string(output))), nil
+}
+
+// StagedFiles returns the added, copied, modified and renamed files of the index with one of the extensions
+// The config path must be the repository root, see RepoRoot
+//
+// StagedFiles 返回索引中新增、复制、修改和重命名且带有这些扩展名之一的文件
+// config 路径必须是仓库根目录，参见 RepoRoot
+func StagedFiles(config *osexec.ExecConfig, extensions []string) ([]*StagedFile, error) {
+	output, err := config.Exec("git", "diff", "--cached", "--name-only", "-z", "--diff-filter=ACMR")
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	var paths []string
+	for _, name := range splitZ(output) {
+		if utils.MatchExt(name, extensions) {
+			paths = append(paths, name)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	output, err = config.Exec("git", "diff", "--name-only", "-z")
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	unstaged := splitZ(output)
+
+	output, err = config.Exec("git", append([]string{"ls-files", "--stage", "-z", "--"}, paths...)...)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	var files []*StagedFile
+	for _, line := range splitZ(output) {
+		// <mode> SP <object> SP <stage> TAB <path>
+		info, name, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(info)
+		if !ok || len(fields) != 3 || fields[2] != "0" {
+			continue // unmerged entries are left to the merge // 未合并的条目留给合并流程处理
+		}
+		files = append(files, &StagedFile{Path: name, Mode: fields[0], Blob: fields[1], Partial: slices.Contains(unstaged, name)})
+	}
+	return files, nil
+}
+
+// splitZ splits NUL terminated git output into its entries
+// splitZ 将以 NUL 结尾的 git 输出拆分为条目
+func splitZ(output []byte) []string {
+	var results []string
+	for _, item := range strings.Split(string(output), "\x00") {
+		if item != "" {
+			results = append(results, item)
+		}
+	}
+	return results
+}
+
+// Result reports a staged file whose content was not formatted
+//
+// Result 报告暂存内容未格式化的文件
+type Result struct {
+	Path     string // Slash separated path relative to the repository root // 相对于仓库根目录、以斜杠分隔的路径
+	Partial  bool   // Whether the file has unstaged changes, its worktree is left alone // 文件是否有未暂存的修改，其工作区保持不变
+	Restaged bool   // Whether the formatted content replaced the staged content // 格式化内容是否替换了暂存内容
+}
+
+// Hook formats or checks the staged files of a repository
+//
+// Hook 格式化或检查仓库中暂存的文件
+type Hook struct {
+	config     *osexec.ExecConfig
+	registry   *clangformat.Registry
+	extensions []string
+	check      bool
+	restage    bool
+	options    *clangformat.Options
+}
+
+// NewHook creates a Hook formatting the staged files of the registered extensions
+// The config path must be the repository root, see RepoRoot
+//
+// NewHook 创建格式化已注册扩展名暂存文件的 Hook
+// config 路径必须是仓库根目录，参见 RepoRoot
+func NewHook(config *osexec.ExecConfig, registry *clangformat.Registry) *Hook {
+	return &Hook{
+		config:     config,
+		registry:   registry,
+		extensions: registry.Extensions(),
+		options:    clangformat.NewOptions(),
+	}
+}
+
+// WithExtensions limits the staged files to the extensions and returns the updated Hook
+//
+// WithExtensions 将暂存文件限制为这些扩展名并返回更新后的 Hook
+func (h *Hook) WithExtensions(extensions []string) *Hook {
+	h.extensions = extensions
+	return h
+}
+
+// WithCheck makes Run only report unformatted staged files and returns the updated Hook
+//
+// WithCheck 使 Run 只报告未格式化的暂存文件并返回更新后的 Hook
+func (h *Hook) WithCheck(check bool) *Hook {
+	h.check = check
+	return h
+}
+
+// WithRestage makes Run write the formatted contents into the index and returns the updated Hook
+// Without it only the worktree of fully staged files is formatted, leaving the commit to be reviewed and staged again
+//
+// WithRestage 使 Run 将格式化内容写入索引并返回更新后的 Hook
+// 未启用时只格式化完全暂存文件的工作区，留待审阅后再次暂存
+func (h *Hook) WithRestage(restage bool) *Hook {
+	h.restage = restage
+	return h
+}
+
+// WithOptions sets the clangformat.Options whose ending policy and WriteFile apply to the formatted contents, and returns the updated Hook
+// Pass the Options the registry formatters were built with, so staged and worktree contents follow the same policy
+//
+// WithOptions 设置其换行策略和 WriteFile 作用于格式化内容的 clangformat.Options 并返回更新后的 Hook
+// 传入构建注册表格式化器时使用的 Options，使暂存内容和工作区内容遵循相同的策略
+func (h *Hook) WithOptions(options *clangformat.Options) *Hook {
+	h.options = options
+	return h
+}
+
+// Run formats the staged version of each staged file and returns the ones that were not formatted
+// Fully staged files get the formatted content in the worktree too, partially staged files keep their worktree
+//
+// Run 格式化每个暂存文件的暂存版本，并返回其中未格式化的文件
+// 完全暂存的文件在工作区中同样写入格式化内容，部分暂存的文件保持其工作区不变
+func (h *Hook) Run() ([]*Result, error) {
+	files, err := StagedFiles(h.config, h.extensions)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	var results []*Result
+	for _, file := range files {
+		language, ok := h.registry.Lookup(path.Ext(file.Path))
+		if !ok {
+			continue
+		}
+		if filter, ok := language.Formatter.(clangformat.ProjectFilter); ok {
+			// staged files excluded by the project config are skipped, as FormatProject skips them
+			// 被项目配置排除的暂存文件会被跳过，与 FormatProject 一致
+			inProject, err := filter.InProject(h.config.Path, filepath.Join(h.config.Path, filepath.FromSlash(file.Path)))
+			if err != nil {
+				return nil, erero.WithMessage(err, file.Path)
+			}
+			if !inProject {
+				continue
+			}
+		}
+		staged, err := h.config.Exec("git", "cat-file", "blob", file.Blob)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		// the repo-relative path runs from the repository root, so clang-format finds the .clang-format files of the repository
+		// 相对于仓库的路径从仓库根目录运行，使 clang-format 找到仓库中的 .clang-format 文件
+		formatted, err := language.DryRunSource(h.config, staged, filepath.FromSlash(file.Path), language.NewStyle())
+		if err != nil {
+			return nil, erero.WithMessage(err, file.Path)
+		}
+		// the staged content gets the same ending policy WriteFile gives the worktree
+		// 暂存内容使用与 WriteFile 写入工作区时相同的换行策略
+		formatted = clangformat.ApplyEndings(staged, formatted, h.options.EndingPolicy())
+		if bytes.Equal(staged, formatted) {
+			continue
+		}
+		result := &Result{Path: file.Path, Partial: file.Partial}
+		results = append(results, result)
+		if h.check {
+			continue
+		}
+		if h.restage {
+			if err := h.stage(file, formatted); err != nil {
+				return nil, erero.WithMessage(err, file.Path)
+			}
+			result.Restaged = true
+		}
+		if !file.Partial {
+			if err := h.options.WriteFile(filepath.Join(h.config.Path, filepath.FromSlash(file.Path)), formatted); err != nil {
+				return nil, erero.WithMessage(err, file.Path)
+			}
+		}
+		zaplog.LOG.Debug("git-format", zap.String("path", file.Path), zap.Bool("partial", file.Partial), zap.Bool("restaged", result.Restaged))
+	}
+	return results, nil
+}
+
+// stage writes the content as a blob and points the index entry of the file to it
+// stage 将内容写为对象，并使该文件的索引条目指向它
+func (h *Hook) stage(file *StagedFile, content []byte) error {
+	output, err := h.config.ExecWith("git", []string{"hash-object", "-w", "--stdin", "--no-filters"}, func(command *exec.Cmd) {
+		command.Stdin = bytes.NewReader(content)
+	})
+	if err != nil {
+		return erero.Wro(err)
+	}
+	blob := strings.TrimSpace(string(output))
+	if _, err := h.config.Exec("git", "update-index", "--cacheinfo", file.Mode+","+blob+","+file.Path); err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
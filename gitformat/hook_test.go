@@ -0,0 +1,147 @@
+package gitformat_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/gitformat"
+	"github.com/go-xlan/clang-format/protoformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/rese"
+)
+
+const (
+	unformatted = "message A{int32 a=1;}\n"
+	formatted   = "message A {\n  int32 a = 1;\n}\n"
+)
+
+// newRepo creates a git repository in a temp DIR and returns the exec config rooted at it
+// newRepo 在临时目录中创建 git 仓库，并返回以其为根目录的执行配置
+func newRepo(t *testing.T) *osexec.ExecConfig {
+	tempDIR := rese.V1(os.MkdirTemp("", "git-format-test-*"))
+	t.Cleanup(func() { must.Done(os.RemoveAll(tempDIR)) })
+
+	config := osexec.NewExecConfig().WithPath(tempDIR)
+	rese.V1(config.Exec("git", "init", "-q"))
+	rese.V1(config.Exec("git", "config", "user.email", "test@example.com"))
+	rese.V1(config.Exec("git", "config", "user.name", "test"))
+	rese.V1(config.Exec("git", "config", "core.autocrlf", "false"))
+	return config
+}
+
+// newNativeRegistry returns a registry formatting .proto files with the native backend, no clang-format needed
+// newNativeRegistry 返回使用原生后端格式化 .proto 文件的注册表，无需 clang-format
+func newNativeRegistry() *clangformat.Registry {
+	return clangformat.NewRegistry().Register(protoformat.NewFormatter().WithBackend(protoformat.BackendNative).NewLanguage())
+}
+
+func TestHookRestage(t *testing.T) {
+	config := newRepo(t)
+	full := filepath.Join(config.Path, "full.proto")
+	partial := filepath.Join(config.Path, "partial.proto")
+	must.Done(os.WriteFile(full, []byte(unformatted), 0644))
+	must.Done(os.WriteFile(partial, []byte(unformatted), 0644))
+	must.Done(os.WriteFile(filepath.Join(config.Path, "notes.txt"), []byte(unformatted), 0644))
+	rese.V1(config.Exec("git", "add", "."))
+	// 部分暂存的文件在工作区中还有未暂存的修改
+	must.Done(os.WriteFile(partial, []byte(unformatted+"message B{}\n"), 0644))
+
+	// 检查模式只报告未格式化的暂存文件
+	results := rese.V1(gitformat.NewHook(config, newNativeRegistry()).WithExtensions([]string{".proto"}).WithCheck(true).Run())
+	require.Len(t, results, 2)
+	require.Equal(t, unformatted, string(rese.V1(config.Exec("git", "show", ":full.proto"))))
+
+	// 重新暂存格式化后的内容，部分暂存文件的工作区保持不变
+	results = rese.V1(gitformat.NewHook(config, newNativeRegistry()).WithExtensions([]string{".proto"}).WithRestage(true).Run())
+	require.Len(t, results, 2)
+	require.Equal(t, "full.proto", results[0].Path)
+	require.True(t, results[0].Restaged)
+	require.False(t, results[0].Partial)
+	require.Equal(t, "partial.proto", results[1].Path)
+	require.True(t, results[1].Partial)
+
+	require.Equal(t, formatted, string(rese.V1(config.Exec("git", "show", ":full.proto"))))
+	require.Equal(t, formatted, string(rese.V1(config.Exec("git", "show", ":partial.proto"))))
+	require.Equal(t, formatted, string(rese.V1(os.ReadFile(full))))
+	require.Equal(t, unformatted+"message B{}\n", string(rese.V1(os.ReadFile(partial))))
+	require.Equal(t, unformatted, string(rese.V1(config.Exec("git", "show", ":notes.txt"))))
+
+	// 再次运行时暂存内容均已格式化
+	require.Empty(t, rese.V1(gitformat.NewHook(config, newNativeRegistry()).WithRestage(true).Run()))
+}
+
+func TestHookWithoutRestage(t *testing.T) {
+	config := newRepo(t)
+	path := filepath.Join(config.Path, "demo.proto")
+	must.Done(os.WriteFile(path, []byte(unformatted), 0644))
+	rese.V1(config.Exec("git", "add", "demo.proto"))
+
+	// 不重新暂存时只格式化工作区，留待审阅后再次暂存
+	results := rese.V1(gitformat.NewHook(config, newNativeRegistry()).Run())
+	require.Len(t, results, 1)
+	require.False(t, results[0].Restaged)
+	require.Equal(t, formatted, string(rese.V1(os.ReadFile(path))))
+	require.Equal(t, unformatted, string(rese.V1(config.Exec("git", "show", ":demo.proto"))))
+}
+
+func TestInstallUninstall(t *testing.T) {
+	config := newRepo(t)
+
+	hookPath := rese.C1(gitformat.Install(config, []string{"clang-format-batch", "hook", "run", "-e", ".proto,.cc", "--message", "it's"}, false))
+	require.Equal(t, filepath.Join(config.Path, ".git", "hooks", "pre-commit"), hookPath)
+	script := string(rese.V1(os.ReadFile(hookPath)))
+	require.True(t, strings.HasPrefix(script, "#!/bin/sh\n"))
+	require.Contains(t, script, `exec clang-format-batch hook run -e .proto,.cc --message 'it'\''s'`)
+	require.Equal(t, os.FileMode(0755), rese.V1(os.Stat(hookPath)).Mode().Perm())
+
+	// 自身安装的钩子可以被覆盖和删除
+	rese.C1(gitformat.Install(config, []string{"clang-format-batch", "hook", "run"}, false))
+	rese.C1(gitformat.Uninstall(config, false))
+	require.NoFileExists(t, hookPath)
+
+	// 他人编写的钩子在未强制时保持不变
+	must.Done(os.WriteFile(hookPath, []byte("#!/bin/sh\nmake lint\n"), 0755))
+	_, err := gitformat.Install(config, []string{"clang-format-batch", "hook", "run"}, false)
+	require.Error(t, err)
+	_, err = gitformat.Uninstall(config, false)
+	require.Error(t, err)
+	require.Equal(t, "#!/bin/sh\nmake lint\n", string(rese.V1(os.ReadFile(hookPath))))
+	rese.C1(gitformat.Install(config, []string{"clang-format-batch", "hook", "run"}, true))
+	require.Contains(t, string(rese.V1(os.ReadFile(hookPath))), "exec clang-format-batch hook run")
+}
+
+func TestHookSkipsExcluded(t *testing.T) {
+	config := newRepo(t)
+	// buf 模块排除 vendor 目录，与 FormatProject 保持一致
+	must.Done(os.WriteFile(filepath.Join(config.Path, "buf.yaml"), []byte("version: v1\nbuild:\n  excludes:\n    - vendor\n"), 0644))
+	must.Done(os.Mkdir(filepath.Join(config.Path, "vendor"), 0755))
+	excluded := filepath.Join(config.Path, "vendor", "demo.proto")
+	must.Done(os.WriteFile(excluded, []byte(unformatted), 0644))
+	rese.V1(config.Exec("git", "add", "."))
+
+	require.Empty(t, rese.V1(gitformat.NewHook(config, newNativeRegistry()).WithRestage(true).Run()))
+	require.Equal(t, unformatted, string(rese.V1(config.Exec("git", "show", ":vendor/demo.proto"))))
+	require.Equal(t, unformatted, string(rese.V1(os.ReadFile(excluded))))
+}
+
+func TestHookAssumesRepoPath(t *testing.T) {
+	config := newRepo(t)
+	must.Done(os.Mkdir(filepath.Join(config.Path, "src"), 0755))
+	must.Done(os.WriteFile(filepath.Join(config.Path, "src", "demo.cc"), []byte("int a;\n"), 0644))
+	rese.V1(config.Exec("git", "add", "."))
+
+	// 暂存内容通过标准输入格式化，以相对于仓库的路径查找 .clang-format 文件
+	fake := clangformat.NewFakeExecutor()
+	options := clangformat.NewOptions().WithExecutor(fake)
+	require.Empty(t, rese.V1(gitformat.NewHook(config, options.NewRegistry()).WithOptions(options).Run()))
+	calls := fake.Calls()
+	require.Len(t, calls, 1)
+	require.Equal(t, config.Path, calls[0].Path)
+	require.Equal(t, []string{"--assume-filename", filepath.Join("src", "demo.cc")}, calls[0].Args[:2])
+	require.Equal(t, "int a;\n", string(calls[0].Stdin))
+}
@@ -0,0 +1,107 @@
+package gitformat
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yyle88/erero"
+	"github.com/yyle88/osexec"
+)
+
+// hookMarker identifies pre-commit scripts written by Install, other scripts are never replaced or removed without force
+// hookMarker 标识由 Install 写入的 pre-commit 脚本，其他脚本在未强制时不会被替换或删除
+const hookMarker = "# installed by clang-format-batch hook install"
+
+// HookPath returns the path of the pre-commit hook of the repository, honoring core.hooksPath
+//
+// HookPath 返回仓库 pre-commit 钩子的路径，遵循 core.hooksPath 设置
+func HookPath(config *osexec.ExecConfig) (string, error) {
+	output, err := config.Exec("git", "rev-parse", "--git-path", "hooks/pre-commit")
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	hookPath := filepath.FromSlash(strings.TrimSpace(string(output)))
+	if !filepath.IsAbs(hookPath) {
+		hookPath = filepath.Join(config.Path, hookPath)
+	}
+	return hookPath, nil
+}
+
+// Install writes a pre-commit hook running the command with the args, such as clang-format-batch hook run -e .proto
+// An existing hook written by someone else is kept, unless force is set
+// Returns the hook path
+//
+// Install 写入运行该命令及参数的 pre-commit 钩子，例如 clang-format-batch hook run -e .proto
+// 已存在的他人编写的钩子会被保留，除非设置了 force
+// 返回钩子路径
+func Install(config *osexec.ExecConfig, command []string, force bool) (string, error) {
+	hookPath, err := HookPath(config)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	if err := checkOwnHook(hookPath, force); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(hookPath), 0755); err != nil {
+		return "", erero.Wro(err)
+	}
+	quoted := make([]string, 0, len(command))
+	for _, arg := range command {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	script := "#!/bin/sh\n" + hookMarker + ", remove with clang-format-batch hook uninstall\nexec " + strings.Join(quoted, " ") + "\n"
+	if err := os.WriteFile(hookPath, []byte(script), 0755); err != nil {
+		return "", erero.Wro(err)
+	}
+	// os.WriteFile keeps the mode of an existing file, the hook must be executable
+	// os.WriteFile 会保持已有文件的权限，钩子必须可执行
+	if err := os.Chmod(hookPath, 0755); err != nil {
+		return "", erero.Wro(err)
+	}
+	return hookPath, nil
+}
+
+// Uninstall removes the pre-commit hook written by Install, a missing hook is not an error
+// Returns the hook path
+//
+// Uninstall 删除由 Install 写入的 pre-commit 钩子，钩子不存在不视为错误
+// 返回钩子路径
+func Uninstall(config *osexec.ExecConfig, force bool) (string, error) {
+	hookPath, err := HookPath(config)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	if err := checkOwnHook(hookPath, force); err != nil {
+		return "", err
+	}
+	if err := os.Remove(hookPath); err != nil && !os.IsNotExist(err) {
+		return "", erero.Wro(err)
+	}
+	return hookPath, nil
+}
+
+// checkOwnHook returns error when the hook exists and was not written by Install, unless force is set
+// checkOwnHook 在钩子存在且不是由 Install 写入时返回错误，除非设置了 force
+func checkOwnHook(hookPath string, force bool) error {
+	data, err := os.ReadFile(hookPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return erero.Wro(err)
+	}
+	if !force && !strings.Contains(string(data), hookMarker) {
+		return erero.Errorf("%s was not installed by clang-format-batch, use --force to replace it", hookPath)
+	}
+	return nil
+}
+
+// shellQuote quotes the arg for sh when it contains anything beyond safe characters
+// shellQuote 在参数包含安全字符以外的内容时为 sh 加上引号
+func shellQuote(arg string) string {
+	if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./,=:@+") == "" {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
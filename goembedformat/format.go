@@ -0,0 +1,480 @@
+// Package goembedformat: Clang-Format engine for C/C++ and proto snippets embedded in Go sources
+// Formats raw string literals tagged with a //clang-format:lang=<language> marker comment
+// Formats the asset files pulled in by //go:embed directives through the language registry
+// Re-parses the rewritten Go file before writing, so a snippet can never break the Go code
+//
+// goembedformat: Go 源码中内嵌 C/C++ 和 proto 片段的 Clang-Format 引擎
+// 格式化带有 //clang-format:lang=<language> 标记注释的原始字符串字面量
+// 通过语言注册表格式化 //go:embed 指令引入的资源文件
+// 写入前重新解析改写后的 Go 文件，确保片段不会破坏 Go 代码
+package goembedformat
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/internal/utils"
+	"github.com/go-xlan/clang-format/mdformat"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/osexistpath/osmustexist"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// markerPrefix starts the marker comment naming the language of the next raw string literal
+// markerPrefix 是标记注释的前缀，用于指明下一个原始字符串字面量的语言
+const markerPrefix = "clang-format:lang="
+
+// Languages maps marker languages to the file extensions passed to clang-format
+// Shares the table of fenced block languages in mdformat, so both name snippets the same way
+//
+// Languages 将标记中的语言映射到传给 clang-format 的文件扩展名
+// 与 mdformat 中围栏代码块的语言表共用，使两者以相同方式命名片段
+var Languages = mdformat.Languages
+
+// NewStyle creates the Style used on tagged raw string literals
+// Returns Google-based style with 2-space indentation, matching clangformat defaults
+//
+// NewStyle 创建用于带标记原始字符串字面量的样式
+// 返回基于 Google 的 2 空格缩进样式，与 clangformat 默认值一致
+func NewStyle() *clangformat.Style {
+	return clangformat.NewStyle()
+}
+
+// Formatter formats the tagged literals and embedded files of Go files with the clangformat.Options running clang-format and writing the files
+// The package-level functions use NewFormatter(), set the Options to format with the settings of a run
+//
+// Formatter 使用运行 clang-format 和写入文件的 clangformat.Options 格式化Go 文件的带标记字面量和嵌入文件
+// 包级函数使用 NewFormatter()，设置 Options 即可使用一次运行的设置进行格式化
+type Formatter struct {
+	options *clangformat.Options
+}
+
+// NewFormatter creates a Formatter with clangformat.NewOptions()
+//
+// NewFormatter 创建使用 clangformat.NewOptions() 的 Formatter
+func NewFormatter() *Formatter {
+	return &Formatter{options: clangformat.NewOptions()}
+}
+
+// WithOptions sets the clangformat.Options and returns the updated Formatter
+//
+// WithOptions 设置 clangformat.Options 并返回更新后的 Formatter
+func (f *Formatter) WithOptions(options *clangformat.Options) *Formatter {
+	f.options = options
+	return f
+}
+
+// DryRun returns the Go file content with formatted tagged literals
+// Neither the Go file nor its embedded files are modified
+//
+// DryRun 返回带标记字面量已格式化的 Go 文件内容
+// 不会修改 Go 文件及其嵌入的文件
+func DryRun(config *osexec.ExecConfig, path string, style *clangformat.Style) (output []byte, err error) {
+	return NewFormatter().DryRun(config, path, style)
+}
+
+// DryRun works like the package-level DryRun, running clang-format through the options of the Formatter
+// DryRun 与包级 DryRun 相同，通过 Formatter 的 options 运行 clang-format
+func (f *Formatter) DryRun(config *osexec.ExecConfig, path string, style *clangformat.Style) (output []byte, err error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return f.FormatSource(config, path, source, style)
+}
+
+// Format formats the tagged literals in the Go file and writes the result back
+// Writes only when the content changes, atomically through clangformat.WriteFile
+//
+// Format 格式化 Go 文件中带标记的字面量并写回结果
+// 仅在内容变化时通过 clangformat.WriteFile 原子写入
+func Format(config *osexec.ExecConfig, path string, style *clangformat.Style) (output []byte, err error) {
+	return NewFormatter().Format(config, path, style)
+}
+
+// Format works like the package-level Format, running clang-format and writing the files through the options of the Formatter
+// Format 与包级 Format 相同，通过 Formatter 的 options 运行 clang-format 并写入文件
+func (f *Formatter) Format(config *osexec.ExecConfig, path string, style *clangformat.Style) (output []byte, err error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	output, err = f.FormatSource(config, path, source, style)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if !bytes.Equal(source, output) {
+		if err := f.options.WriteFile(path, output); err != nil {
+			return nil, erero.Wro(err)
+		}
+	}
+	return nil, nil
+}
+
+// FormatSource formats the tagged raw string literals in the Go source and returns the new source
+// A marker comment alone on its line tags the literals starting on the next line,
+// a marker after code tags the literals starting on its own line
+// Blank lines around the snippet inside the backquotes are kept as they are
+// The path is used in parse errors and as the clang-format --assume-filename base
+//
+// FormatSource 格式化 Go 源码中带标记的原始字符串字面量并返回新的源码
+// 单独占一行的标记注释作用于下一行开始的字面量，
+// 位于代码之后的标记注释作用于本行开始的字面量
+// 反引号内片段前后的空行保持原样
+// path 用于解析错误信息，并作为 clang-format --assume-filename 的基础
+func FormatSource(config *osexec.ExecConfig, path string, source []byte, style *clangformat.Style) ([]byte, error) {
+	return NewFormatter().FormatSource(config, path, source, style)
+}
+
+// FormatSource works like the package-level FormatSource, running clang-format through the options of the Formatter
+// FormatSource 与包级 FormatSource 相同，通过 Formatter 的 options 运行 clang-format
+func (f *Formatter) FormatSource(config *osexec.ExecConfig, path string, source []byte, style *clangformat.Style) ([]byte, error) {
+	snippets, err := findSnippets(path, source)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	// splice from the end so earlier offsets stay valid
+	// 从末尾开始替换，使前面的偏移量保持有效
+	sort.Slice(snippets, func(i, j int) bool { return snippets[i].start > snippets[j].start })
+
+	var result = source
+	for _, snippet := range snippets {
+		content := string(source[snippet.start:snippet.end])
+		head, code, tail := splitMargins(content)
+		if strings.TrimSpace(code) == "" {
+			continue
+		}
+		output, err := f.options.DryRunSource(config, []byte(code), path+snippet.extension, style)
+		if err != nil {
+			return nil, erero.WithMessage(err, snippet.position)
+		}
+		formatted := strings.TrimRight(strings.TrimLeft(string(output), "\n"), "\n")
+		if strings.Contains(formatted, "`") {
+			return nil, erero.Errorf("%s: formatted snippet contains a backquote", snippet.position)
+		}
+		result = append(append(append([]byte{}, result[:snippet.start]...), head+formatted+tail...), result[snippet.end:]...)
+	}
+	if len(snippets) > 0 {
+		if _, err := parser.ParseFile(token.NewFileSet(), path, result, parser.ParseComments); err != nil {
+			return nil, erero.WithMessage(err, "formatted snippets break the Go source")
+		}
+	}
+	return result, nil
+}
+
+// EmbeddedFiles returns the files matched by the //go:embed directives of the Go source
+// Patterns resolve against the DIR of the Go file, matched DIRs contribute their files recursively
+// Files starting with . or _ inside matched DIRs are left out unless the pattern has the all: prefix
+//
+// EmbeddedFiles 返回 Go 源码中 //go:embed 指令匹配的文件
+// 模式基于 Go 文件所在目录解析，匹配到的目录递归提供其中的文件
+// 匹配目录中以 . 或 _ 开头的文件会被排除，除非模式带有 all: 前缀
+func EmbeddedFiles(path string, source []byte) ([]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), path, source, parser.ParseComments)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	dir := filepath.Dir(path)
+	var results []string
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			args, ok := strings.CutPrefix(comment.Text, "//go:embed")
+			if !ok || (args != "" && args[0] != ' ' && args[0] != '\t') {
+				continue
+			}
+			patterns, err := splitPatterns(args)
+			if err != nil {
+				return nil, erero.WithMessage(err, path)
+			}
+			for _, pattern := range patterns {
+				pattern, all := strings.CutPrefix(pattern, "all:")
+				matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+				if err != nil {
+					return nil, erero.WithMessage(err, pattern)
+				}
+				for _, match := range matches {
+					files, err := expandMatch(match, all)
+					if err != nil {
+						return nil, erero.Wro(err)
+					}
+					for _, name := range files {
+						if !slices.Contains(results, name) {
+							results = append(results, name)
+						}
+					}
+				}
+			}
+		}
+	}
+	return results, nil
+}
+
+// FormatEmbeds formats the files embedded by the Go file whose extension is registered
+// Each file goes through the formatter and default style of its language
+//
+// FormatEmbeds 格式化 Go 文件嵌入的、扩展名已注册的文件
+// 每个文件使用其语言的格式化器和默认样式
+func FormatEmbeds(config *osexec.ExecConfig, registry *clangformat.Registry, path string) error {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	files, err := EmbeddedFiles(path, source)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	for _, name := range files {
+		if err := formatEmbed(config, registry, name); err != nil {
+			return erero.Wro(err)
+		}
+	}
+	return nil
+}
+
+// FormatProject formats the tagged literals and embedded files of all .go files in the project
+// A file embedded by several Go files is formatted once
+//
+// FormatProject 格式化项目中所有 .go 文件的带标记字面量和嵌入文件
+// 被多个 Go 文件嵌入的文件只格式化一次
+func FormatProject(config *osexec.ExecConfig, registry *clangformat.Registry, projectPath string, style *clangformat.Style) error {
+	return NewFormatter().FormatProject(config, registry, projectPath, style)
+}
+
+// FormatProject works like the package-level FormatProject, running clang-format and writing the files through the options of the Formatter
+// FormatProject 与包级 FormatProject 相同，通过 Formatter 的 options 运行 clang-format 并写入文件
+func (f *Formatter) FormatProject(config *osexec.ExecConfig, registry *clangformat.Registry, projectPath string, style *clangformat.Style) error {
+	var formatted []string
+	if err := utils.WalkFilesWithExt(projectPath, ".go", func(path string, info os.FileInfo) error {
+		zaplog.LOG.Debug("go-embed-format", zap.String("path", path))
+		osmustexist.MustFile(path)
+
+		if _, err := f.Format(config, path, style); err != nil {
+			return erero.Wro(err)
+		}
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return erero.Wro(err)
+		}
+		files, err := EmbeddedFiles(path, source)
+		if err != nil {
+			return erero.Wro(err)
+		}
+		for _, name := range files {
+			if slices.Contains(formatted, name) {
+				continue
+			}
+			formatted = append(formatted, name)
+			if err := formatEmbed(config, registry, name); err != nil {
+				return erero.Wro(err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
+
+// formatEmbed formats the embedded file when its extension is registered, skipping it otherwise
+// formatEmbed 在扩展名已注册时格式化嵌入文件，否则跳过
+func formatEmbed(config *osexec.ExecConfig, registry *clangformat.Registry, path string) error {
+	language, ok := registry.Lookup(filepath.Ext(path))
+	if !ok {
+		return nil
+	}
+	zaplog.LOG.Debug("go-embed-format", zap.String("embed", path), zap.String("language", language.Name))
+	if _, err := language.Formatter.Format(config, path, language.NewStyle()); err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
+
+// snippet is the content location of a tagged raw string literal
+// snippet 是带标记原始字符串字面量内容的位置
+type snippet struct {
+	start     int    // Offset after the opening backquote // 起始反引号之后的偏移量
+	end       int    // Offset of the closing backquote // 结束反引号的偏移量
+	extension string // File extension of the language // 语言对应的文件扩展名
+	position  string // Position of the literal in errors // 错误信息中字面量的位置
+}
+
+// findSnippets parses the Go source and returns the raw string literals tagged by marker comments
+// Markers naming unknown languages fail, markers tagging no raw string literal are logged and skipped
+// The first marker wins when several tag the same line
+//
+// findSnippets 解析 Go 源码并返回被标记注释标注的原始字符串字面量
+// 标记中的语言未知时返回错误，未标注任何原始字符串字面量的标记会记录日志并跳过
+// 多个标记作用于同一行时以第一个为准
+func findSnippets(path string, source []byte) ([]*snippet, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, source, parser.ParseComments)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	markers := map[int]string{} // tagged line to language // 被标注的行到语言
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			language, ok := parseMarker(comment.Text)
+			if !ok {
+				continue
+			}
+			position := fset.Position(comment.Pos())
+			if _, ok := Languages[language]; !ok {
+				return nil, erero.Errorf("%s: unknown snippet language %s", position, language)
+			}
+			line := position.Line
+			lineStart := bytes.LastIndexByte(source[:position.Offset], '\n') + 1
+			if strings.TrimSpace(string(source[lineStart:position.Offset])) == "" {
+				line = fset.Position(comment.End()).Line + 1
+			}
+			if _, ok := markers[line]; !ok {
+				markers[line] = language
+			}
+		}
+	}
+	if len(markers) == 0 {
+		return nil, nil
+	}
+
+	var snippets []*snippet
+	used := map[int]bool{}
+	ast.Inspect(file, func(node ast.Node) bool {
+		literal, ok := node.(*ast.BasicLit)
+		if !ok || literal.Kind != token.STRING || !strings.HasPrefix(literal.Value, "`") {
+			return true
+		}
+		position := fset.Position(literal.Pos())
+		language, ok := markers[position.Line]
+		if !ok {
+			return true
+		}
+		used[position.Line] = true
+		snippets = append(snippets, &snippet{
+			start:     position.Offset + 1,
+			end:       fset.Position(literal.End()).Offset - 1,
+			extension: Languages[language],
+			position:  position.String(),
+		})
+		return true
+	})
+	for line, language := range markers {
+		if !used[line] {
+			zaplog.LOG.Warn("go-embed-format", zap.String("path", path), zap.Int("line", line), zap.String("language", language), zap.String("message", "marker tags no raw string literal"))
+		}
+	}
+	return snippets, nil
+}
+
+// parseMarker returns the language named by a marker comment
+// Accepts //clang-format:lang=proto, // clang-format:lang=proto and the /* */ forms
+//
+// parseMarker 返回标记注释中指明的语言
+// 接受 //clang-format:lang=proto、// clang-format:lang=proto 以及 /* */ 形式
+func parseMarker(text string) (string, bool) {
+	if strings.HasPrefix(text, "/*") {
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+	} else {
+		text = strings.TrimPrefix(text, "//")
+	}
+	language, ok := strings.CutPrefix(strings.TrimSpace(text), markerPrefix)
+	if !ok {
+		return "", false
+	}
+	return strings.ToLower(strings.TrimSpace(language)), true
+}
+
+// splitMargins splits the literal content into the blank margin before the code, the code and the margin after it
+// The head ends with the last newline before the code, the tail starts with the first newline after it
+//
+// splitMargins 将字面量内容拆分为代码之前的空白边距、代码以及代码之后的边距
+// head 以代码之前的最后一个换行结尾，tail 以代码之后的第一个换行开头
+func splitMargins(content string) (head string, code string, tail string) {
+	code = content
+	if leading := len(code) - len(strings.TrimLeft(code, " \t\r\n")); leading > 0 {
+		if idx := strings.LastIndexByte(code[:leading], '\n'); idx >= 0 {
+			head, code = code[:idx+1], code[idx+1:]
+		}
+	}
+	trimmed := strings.TrimRight(code, " \t\r\n")
+	if idx := strings.IndexByte(code[len(trimmed):], '\n'); idx >= 0 {
+		code, tail = code[:len(trimmed)+idx], code[len(trimmed)+idx:]
+	}
+	return head, code, tail
+}
+
+// splitPatterns splits the arguments of a //go:embed directive, unquoting "..." and `...` patterns
+// splitPatterns 拆分 //go:embed 指令的参数，并对 "..." 和 `...` 形式的模式去除引号
+func splitPatterns(args string) ([]string, error) {
+	var patterns []string
+	for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+		switch args[0] {
+		case '"', '`':
+			end := 1
+			for end < len(args) && args[end] != args[0] {
+				if args[0] == '"' && args[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(args) {
+				return nil, erero.Errorf("unterminated quoted pattern in //go:embed %s", args)
+			}
+			pattern, err := strconv.Unquote(args[:end+1])
+			if err != nil {
+				return nil, erero.WithMessage(err, args[:end+1])
+			}
+			patterns = append(patterns, pattern)
+			args = args[end+1:]
+		default:
+			end := strings.IndexAny(args, " \t")
+			if end < 0 {
+				end = len(args)
+			}
+			patterns = append(patterns, args[:end])
+			args = args[end:]
+		}
+	}
+	return patterns, nil
+}
+
+// expandMatch returns the files of a //go:embed match, walking DIRs recursively
+// expandMatch 返回 //go:embed 匹配项对应的文件，递归遍历目录
+func expandMatch(match string, all bool) ([]string, error) {
+	info, err := os.Stat(match)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if !info.IsDir() {
+		return []string{match}, nil
+	}
+	var files []string
+	if err := filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != match && !all && (strings.HasPrefix(info.Name(), ".") || strings.HasPrefix(info.Name(), "_")) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	}); err != nil {
+		return nil, erero.Wro(err)
+	}
+	return files, nil
+}
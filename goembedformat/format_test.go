@@ -0,0 +1,77 @@
+package goembedformat_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-xlan/clang-format/goembedformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/rese"
+)
+
+func TestFormatSourceWithoutMarker(t *testing.T) {
+	// 没有标记注释的文件不会调用 clang-format，内容保持不变
+	const source = "package demo\n\nconst tmpl = `int  main(){return 0;}`\n"
+	output, err := goembedformat.FormatSource(osexec.NewExecConfig(), "demo.go", []byte(source), goembedformat.NewStyle())
+	require.NoError(t, err)
+	require.Equal(t, source, string(output))
+}
+
+func TestFormatSourceUnknownLanguage(t *testing.T) {
+	// 标记中的语言未知时返回错误
+	const source = "package demo\n\n//clang-format:lang=cobol\nconst tmpl = `MOVE A TO B.`\n"
+	_, err := goembedformat.FormatSource(osexec.NewExecConfig(), "demo.go", []byte(source), goembedformat.NewStyle())
+	require.Error(t, err)
+}
+
+func TestEmbeddedFiles(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "go-embed-files-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	must.Done(os.MkdirAll(filepath.Join(tempDIR, "templates", "nested"), 0755))
+	for _, name := range []string{"schema.proto", "templates/a.cc", "templates/nested/b.h", "templates/_draft.cc", "my file.h"} {
+		must.Done(os.WriteFile(filepath.Join(tempDIR, filepath.FromSlash(name)), []byte("x\n"), 0644))
+	}
+
+	const source = "package demo\n\nimport \"embed\"\n\n//go:embed schema.proto templates \"my file.h\"\nvar assets embed.FS\n"
+	files, err := goembedformat.EmbeddedFiles(filepath.Join(tempDIR, "demo.go"), []byte(source))
+	require.NoError(t, err)
+	// 目录递归展开，以 _ 开头的文件被排除，带引号的模式被正确解析
+	require.Equal(t, []string{
+		filepath.Join(tempDIR, "schema.proto"),
+		filepath.Join(tempDIR, "templates", "a.cc"),
+		filepath.Join(tempDIR, "templates", "nested", "b.h"),
+		filepath.Join(tempDIR, "my file.h"),
+	}, files)
+
+	// all: 前缀保留以 _ 开头的文件
+	files, err = goembedformat.EmbeddedFiles(filepath.Join(tempDIR, "demo.go"), []byte("package demo\n\n//go:embed all:templates\nvar assets embed.FS\n"))
+	require.NoError(t, err)
+	require.Contains(t, files, filepath.Join(tempDIR, "templates", "_draft.cc"))
+}
+
+func TestDryRun(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "go-embed-format-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	// 创建带有标记的原始字符串字面量的 Go 文件
+	goFile := filepath.Join(tempDIR, "demo.go")
+	const originalContent = "package demo\n\n//clang-format:lang=cpp\nconst helper = `\nstatic int add(int a,int b){return a+b;}\n`\n\nconst plain = `int  x;`\n"
+	must.Done(os.WriteFile(goFile, []byte(originalContent), 0644))
+
+	output, err := goembedformat.DryRun(osexec.NewExecConfig().WithDebug(), goFile, goembedformat.NewStyle())
+	require.NoError(t, err)
+	t.Log(string(output))
+
+	// 带标记的字面量被格式化，前后的换行保持不变，未标记的字面量保持原样
+	const expectedResult = "package demo\n\n//clang-format:lang=cpp\nconst helper = `\nstatic int add(int a, int b) { return a + b; }\n`\n\nconst plain = `int  x;`\n"
+	require.Equal(t, expectedResult, string(output))
+
+	// DryRun 不应该修改文件
+	require.Equal(t, originalContent, string(rese.V1(os.ReadFile(goFile))))
+}
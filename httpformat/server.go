@@ -0,0 +1,303 @@
+// Package httpformat: Local HTTP/JSON formatting service for tools in other languages
+// Formats, diffs and checks snippets through the registry, so every caller shares the pinned styles
+// Each request may override fields of the language style, bounded by size and concurrency limits
+// Listens on a TCP address or, with the unix: prefix, on a unix socket
+//
+// httpformat: 面向其他语言工具的本地 HTTP/JSON 格式化服务
+// 通过注册表格式化、比较和检查代码片段，使所有调用方共享固定的样式
+// 每个请求可覆盖语言样式中的字段，并受请求大小和并发数限制
+// 监听 TCP 地址，或以 unix: 前缀监听 unix 套接字
+package httpformat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// Request is the JSON body of every endpoint
+// Filename picks the language by extension, Language picks it by registered name instead
+//
+// Request 是所有接口的 JSON 请求体
+// Filename 根据扩展名选择语言，Language 则按注册名称选择
+type Request struct {
+	Source   string          `json:"source"`   // Content to format // 待格式化的内容
+	Filename string          `json:"filename"` // Slash separated name, such as api/demo.proto // 以斜杠分隔的名称，例如 api/demo.proto
+	Language string          `json:"language"` // Registered language name, such as Cpp or Proto // 已注册的语言名称，例如 Cpp 或 Proto
+	Style    json.RawMessage `json:"style"`    // Style fields overriding the language style, such as {"IndentWidth": 4} // 覆盖语言样式的字段，例如 {"IndentWidth": 4}
+}
+
+// Response is the JSON body answered by format, diff and check
+//
+// Response 是 format、diff 和 check 返回的 JSON 响应体
+type Response struct {
+	Changed   bool   `json:"changed"`             // Whether formatting changes the source // 格式化是否改变了源码
+	Formatted string `json:"formatted,omitempty"` // Formatted content, answered by format // 格式化后的内容，由 format 返回
+	Diff      string `json:"diff,omitempty"`      // Unified diff from source to formatted, answered by diff // 从源码到格式化内容的统一差异，由 diff 返回
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server serves the formatting endpoints
+//
+// Server 提供格式化接口
+type Server struct {
+	config   *osexec.ExecConfig
+	registry *clangformat.Registry
+	maxBytes int64
+	slots    chan struct{}
+	options  *clangformat.Options
+}
+
+// NewServer creates a Server formatting through the registered languages
+// Request bodies are limited to 1 MiB and one formatting runs per CPU at a time
+//
+// NewServer 创建通过已注册语言进行格式化的 Server
+// 请求体限制为 1 MiB，每个 CPU 同时运行一个格式化
+func NewServer(config *osexec.ExecConfig, registry *clangformat.Registry) *Server {
+	return &Server{
+		config:   config,
+		registry: registry,
+		maxBytes: 1 << 20,
+		slots:    make(chan struct{}, runtime.NumCPU()),
+		options:  clangformat.NewOptions(),
+	}
+}
+
+// WithMaxBytes limits the size of request bodies and returns the updated Server
+//
+// WithMaxBytes 限制请求体的大小并返回更新后的 Server
+func (s *Server) WithMaxBytes(maxBytes int64) *Server {
+	s.maxBytes = maxBytes
+	return s
+}
+
+// WithConcurrency limits the formatting runs at a time and returns the updated Server
+// Requests beyond the limit wait for a free slot until the client gives up
+//
+// WithConcurrency 限制同时运行的格式化数量并返回更新后的 Server
+// 超出限制的请求等待空闲名额，直到客户端放弃
+func (s *Server) WithConcurrency(concurrency int) *Server {
+	s.slots = make(chan struct{}, max(concurrency, 1))
+	return s
+}
+
+// WithOptions sets the clangformat.Options whose ending policy applies to the formatted snippets, and returns the updated Server
+//
+// WithOptions 设置其换行策略作用于格式化代码片段的 clangformat.Options 并返回更新后的 Server
+func (s *Server) WithOptions(options *clangformat.Options) *Server {
+	s.options = options
+	return s
+}
+
+// Handler returns the HTTP handler serving POST /format, /diff, /check and /style
+//
+// Handler 返回提供 POST /format、/diff、/check 和 /style 的 HTTP 处理器
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /format", func(w http.ResponseWriter, r *http.Request) {
+		s.serveFormat(w, r, func(req *Request, source []byte, formatted []byte) *Response {
+			return &Response{Changed: !bytes.Equal(source, formatted), Formatted: string(formatted)}
+		})
+	})
+	mux.HandleFunc("POST /diff", func(w http.ResponseWriter, r *http.Request) {
+		s.serveFormat(w, r, func(req *Request, source []byte, formatted []byte) *Response {
+			return &Response{Changed: !bytes.Equal(source, formatted), Diff: unifiedDiff(req.Filename, source, formatted)}
+		})
+	})
+	mux.HandleFunc("POST /check", func(w http.ResponseWriter, r *http.Request) {
+		s.serveFormat(w, r, func(req *Request, source []byte, formatted []byte) *Response {
+			return &Response{Changed: !bytes.Equal(source, formatted)}
+		})
+	})
+	mux.HandleFunc("POST /style", func(w http.ResponseWriter, r *http.Request) {
+		req, status, err := s.readRequest(w, r)
+		if err != nil {
+			writeError(w, status, err)
+			return
+		}
+		_, style, _, err := s.resolve(req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, style)
+	})
+	return mux
+}
+
+// serveFormat formats the source of the request and answers the Response built from the result
+// serveFormat 格式化请求中的源码，并返回根据结果构建的 Response
+func (s *Server) serveFormat(w http.ResponseWriter, r *http.Request, respond func(req *Request, source []byte, formatted []byte) *Response) {
+	req, status, err := s.readRequest(w, r)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	language, style, assumeFilename, err := s.resolve(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-r.Context().Done():
+		writeError(w, http.StatusServiceUnavailable, erero.New("no formatting slot became free"))
+		return
+	}
+
+	source := []byte(req.Source)
+	formatted, err := language.DryRunSource(s.config, source, assumeFilename, style)
+	if err != nil {
+		zaplog.LOG.Debug("http-format", zap.String("path", r.URL.Path), zap.String("filename", req.Filename), zap.Error(err))
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	// the snippet keeps its line endings, BOM and final newline unless the policy asks otherwise
+	// 除非策略另有要求，否则代码片段保持其换行符、BOM 和末尾换行
+	formatted = clangformat.ApplyEndings(source, formatted, s.options.EndingPolicy())
+	writeJSON(w, http.StatusOK, respond(req, source, formatted))
+}
+
+// readRequest decodes the request body within the size limit, returning the HTTP status to answer on error
+// readRequest 在大小限制内解码请求体，出错时返回应答的 HTTP 状态码
+func (s *Server) readRequest(w http.ResponseWriter, r *http.Request) (*Request, int, error) {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.maxBytes))
+	decoder.DisallowUnknownFields()
+	var req Request
+	if err := decoder.Decode(&req); err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, http.StatusRequestEntityTooLarge, erero.Errorf("request body larger than %d bytes", maxBytesError.Limit)
+		}
+		return nil, http.StatusBadRequest, erero.Wro(err)
+	}
+	return &req, 0, nil
+}
+
+// resolve returns the language, the style with the overrides applied and the file name telling clang-format the language
+// The file name is placed under the config path, so no request reaches files outside it
+//
+// resolve 返回语言、应用了覆盖项的样式，以及告诉 clang-format 语言的文件名
+// 文件名位于 config 路径之下，因此请求不会涉及其以外的文件
+func (s *Server) resolve(req *Request) (*clangformat.Language, *clangformat.Style, string, error) {
+	var language *clangformat.Language
+	var ok bool
+	switch {
+	case req.Language != "":
+		if language, ok = s.registry.LookupName(req.Language); !ok {
+			return nil, nil, "", erero.Errorf("language %s not registered", req.Language)
+		}
+	case req.Filename != "":
+		if language, ok = s.registry.Lookup(path.Ext(req.Filename)); !ok {
+			return nil, nil, "", erero.Errorf("no language registered for %s", req.Filename)
+		}
+	default:
+		return nil, nil, "", erero.New("filename or language is required")
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+req.Filename), "/")
+	if req.Filename == "" && len(language.Extensions) > 0 {
+		name = "source" + language.Extensions[0]
+	}
+	style := language.NewStyle()
+	if len(req.Style) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(req.Style))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(style); err != nil {
+			return nil, nil, "", erero.WithMessage(err, "invalid style")
+		}
+	}
+	return language, style, filepath.Join(s.config.Path, filepath.FromSlash(name)), nil
+}
+
+// unifiedDiff returns the unified diff from the source to the formatted content, empty when they are the same
+// unifiedDiff 返回从源码到格式化内容的统一差异，两者相同时为空
+func unifiedDiff(name string, source []byte, formatted []byte) string {
+	if name == "" {
+		name = "source"
+	}
+	// the diff is written into an in-memory buffer, which never fails
+	// 差异写入内存缓冲区，不会失败
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(source),
+		B:        splitLines(formatted),
+		FromFile: "a/" + name,
+		ToFile:   "b/" + name,
+		Context:  3,
+	})
+	return diff
+}
+
+// splitLines splits the content into lines keeping their newlines, a last line without newline gets one
+// Unlike difflib.SplitLines, content ending with a newline gets no extra empty line
+//
+// splitLines 将内容拆分为保留换行符的行，缺少换行符的最后一行会补上换行符
+// 与 difflib.SplitLines 不同，以换行符结尾的内容不会多出空行
+func splitLines(content []byte) []string {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		zaplog.LOG.Debug("http-format", zap.Error(err))
+	}
+}
+
+// Listen listens on the address, a unix:/path/to.sock address listens on a unix socket
+// A stale socket file left by an earlier run is removed first, any other file at the path is an error
+//
+// Listen 监听该地址，unix:/path/to.sock 形式的地址监听 unix 套接字
+// 先删除之前运行遗留的套接字文件，该路径上的其他文件视为错误
+func Listen(address string) (net.Listener, error) {
+	socketPath, isUnix := strings.CutPrefix(address, "unix:")
+	if !isUnix {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		return listener, nil
+	}
+	if info, err := os.Lstat(socketPath); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, erero.Errorf("%s exists and is not a socket", socketPath)
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return nil, erero.Wro(err)
+		}
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return listener, nil
+}
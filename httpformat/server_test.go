@@ -0,0 +1,139 @@
+package httpformat_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/httpformat"
+	"github.com/go-xlan/clang-format/protoformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/rese"
+)
+
+const (
+	unformatted = "message A{int32 a=1;}\n"
+	formatted   = "message A {\n  int32 a = 1;\n}\n"
+)
+
+// newServer returns a test server formatting .proto files with the native backend, no clang-format needed
+// newServer 返回使用原生后端格式化 .proto 文件的测试服务，无需 clang-format
+func newServer(t *testing.T, maxBytes int64) *httptest.Server {
+	registry := clangformat.NewRegistry().Register(protoformat.NewFormatter().WithBackend(protoformat.BackendNative).NewLanguage())
+	server := httptest.NewServer(httpformat.NewServer(osexec.NewExecConfig().WithPath(os.TempDir()), registry).WithMaxBytes(maxBytes).WithConcurrency(2).Handler())
+	t.Cleanup(server.Close)
+	return server
+}
+
+// post sends the request to the endpoint and decodes the JSON answer into result
+// post 向接口发送请求，并将 JSON 应答解码到 result 中
+func post(t *testing.T, client *http.Client, url string, request any, result any) int {
+	body := rese.V1(json.Marshal(request))
+	res := rese.P1(client.Post(url, "application/json", bytes.NewReader(body)))
+	defer func() { must.Done(res.Body.Close()) }()
+	require.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	must.Done(json.NewDecoder(res.Body).Decode(result))
+	return res.StatusCode
+}
+
+func TestServer(t *testing.T) {
+	server := newServer(t, 1<<20)
+	client := server.Client()
+
+	// format 返回格式化后的内容
+	var response httpformat.Response
+	require.Equal(t, http.StatusOK, post(t, client, server.URL+"/format", &httpformat.Request{Source: unformatted, Filename: "api/demo.proto"}, &response))
+	require.True(t, response.Changed)
+	require.Equal(t, formatted, response.Formatted)
+
+	// 单个请求可以覆盖样式字段
+	response = httpformat.Response{}
+	require.Equal(t, http.StatusOK, post(t, client, server.URL+"/format", map[string]any{"source": unformatted, "language": "Proto", "style": map[string]any{"IndentWidth": 4}}, &response))
+	require.Equal(t, "message A {\n    int32 a = 1;\n}\n", response.Formatted)
+
+	// diff 返回统一差异
+	response = httpformat.Response{}
+	require.Equal(t, http.StatusOK, post(t, client, server.URL+"/diff", &httpformat.Request{Source: unformatted, Filename: "demo.proto"}, &response))
+	require.True(t, response.Changed)
+	require.Equal(t, "--- a/demo.proto\n+++ b/demo.proto\n@@ -1 +1,3 @@\n-message A{int32 a=1;}\n+message A {\n+  int32 a = 1;\n+}\n", response.Diff)
+
+	// check 只报告是否需要格式化
+	response = httpformat.Response{}
+	require.Equal(t, http.StatusOK, post(t, client, server.URL+"/check", &httpformat.Request{Source: formatted, Filename: "demo.proto"}, &response))
+	require.False(t, response.Changed)
+	require.Empty(t, response.Formatted)
+
+	// style 返回应用覆盖项后的样式
+	var style clangformat.Style
+	require.Equal(t, http.StatusOK, post(t, client, server.URL+"/style", map[string]any{"filename": "demo.proto", "style": map[string]any{"ColumnLimit": 100}}, &style))
+	expected := protoformat.NewStyle()
+	expected.ColumnLimit = 100
+	require.Equal(t, expected, &style)
+}
+
+func TestServerErrors(t *testing.T) {
+	server := newServer(t, 256)
+	client := server.Client()
+
+	// 未注册的扩展名、未知语言和未知样式字段都是错误请求
+	var failure struct{ Error string }
+	require.Equal(t, http.StatusBadRequest, post(t, client, server.URL+"/format", &httpformat.Request{Source: unformatted, Filename: "notes.txt"}, &failure))
+	require.Contains(t, failure.Error, "notes.txt")
+	require.Equal(t, http.StatusBadRequest, post(t, client, server.URL+"/format", &httpformat.Request{Source: unformatted, Language: "Cobol"}, &failure))
+	require.Equal(t, http.StatusBadRequest, post(t, client, server.URL+"/format", &httpformat.Request{Source: unformatted}, &failure))
+	require.Equal(t, http.StatusBadRequest, post(t, client, server.URL+"/format", map[string]any{"source": unformatted, "filename": "demo.proto", "style": map[string]any{"IndentWidht": 4}}, &failure))
+
+	// 无法解析的源码无法格式化
+	require.Equal(t, http.StatusUnprocessableEntity, post(t, client, server.URL+"/format", &httpformat.Request{Source: "message A {", Filename: "demo.proto"}, &failure))
+
+	// 超出大小限制的请求体被拒绝
+	require.Equal(t, http.StatusRequestEntityTooLarge, post(t, client, server.URL+"/format", &httpformat.Request{Source: strings.Repeat(unformatted, 20), Filename: "demo.proto"}, &failure))
+}
+
+func TestListenUnix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not tested on windows")
+	}
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "http-format-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	// 其他文件不会被当作遗留的套接字删除
+	socketPath := filepath.Join(tempDIR, "format.sock")
+	must.Done(os.WriteFile(socketPath, []byte("data"), 0644))
+	_, err := httpformat.Listen("unix:" + socketPath)
+	require.Error(t, err)
+	must.Done(os.Remove(socketPath))
+
+	// 遗留的套接字文件会被替换
+	listener := rese.V1(httpformat.Listen("unix:" + socketPath))
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	must.Done(listener.Close())
+	require.FileExists(t, socketPath)
+	listener = rese.V1(httpformat.Listen("unix:" + socketPath))
+
+	registry := clangformat.NewRegistry().Register(protoformat.NewFormatter().WithBackend(protoformat.BackendNative).NewLanguage())
+	server := &http.Server{Handler: httpformat.NewServer(osexec.NewExecConfig().WithPath(tempDIR), registry).Handler()}
+	go func() { _ = server.Serve(listener) }()
+	defer func() { must.Done(server.Shutdown(context.Background())) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	var response httpformat.Response
+	require.Equal(t, http.StatusOK, post(t, client, "http://unix/format", &httpformat.Request{Source: unformatted, Filename: "demo.proto"}, &response))
+	require.Equal(t, formatted, response.Formatted)
+}
@@ -0,0 +1,69 @@
+package protosyntax
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yyle88/erero"
+)
+
+// Divergence describes the first place where two token streams differ
+// Divergence 描述两个词法单元流第一次出现差异的位置
+type Divergence struct {
+	OriginalLine  int    // Line in the original source, 0 when the stream ended // 原始源码中的行号，流结束时为 0
+	FormattedLine int    // Line in the formatted source, 0 when the stream ended // 格式化后源码中的行号，流结束时为 0
+	Original      string // Original token text // 原始词法单元文本
+	Formatted     string // Formatted token text // 格式化后的词法单元文本
+}
+
+func (d *Divergence) Error() string {
+	return fmt.Sprintf("token streams differ: original line %d %q, formatted line %d %q", d.OriginalLine, d.Original, d.FormattedLine, d.Formatted)
+}
+
+// Compare tokenizes both sources and returns the first divergence, ignoring whitespace
+// Comments are compared with their inner whitespace collapsed, since reindenting block comments is allowed
+// Returns nil when the token streams are equivalent
+//
+// Compare 对两份源码进行词法分析并返回第一处差异，忽略空白
+// 注释比较时会合并其内部空白，因为允许重新缩进块注释
+// 词法单元流等价时返回 nil
+func Compare(original []byte, formatted []byte) (*Divergence, error) {
+	originalTokens, err := Tokenize(original)
+	if err != nil {
+		return nil, erero.WithMessage(err, "tokenize original")
+	}
+	formattedTokens, err := Tokenize(formatted)
+	if err != nil {
+		return nil, erero.WithMessage(err, "tokenize formatted")
+	}
+	for idx := 0; idx < max(len(originalTokens), len(formattedTokens)); idx++ {
+		var a, b *Token
+		if idx < len(originalTokens) {
+			a = originalTokens[idx]
+		}
+		if idx < len(formattedTokens) {
+			b = formattedTokens[idx]
+		}
+		if a != nil && b != nil && a.Kind == b.Kind && normalize(a) == normalize(b) {
+			continue
+		}
+		divergence := &Divergence{}
+		if a != nil {
+			divergence.OriginalLine, divergence.Original = a.Line, a.Text
+		}
+		if b != nil {
+			divergence.FormattedLine, divergence.Formatted = b.Line, b.Text
+		}
+		return divergence, nil
+	}
+	return nil, nil
+}
+
+// normalize returns the token text used in comparison
+// normalize 返回用于比较的词法单元文本
+func normalize(token *Token) string {
+	if token.Kind == Comment {
+		return strings.Join(strings.Fields(token.Text), " ")
+	}
+	return token.Text
+}
@@ -0,0 +1,241 @@
+package protosyntax
+
+import (
+	"github.com/yyle88/erero"
+)
+
+// NodeKind is the category of a node
+// NodeKind 是节点的类别
+type NodeKind int
+
+const (
+	CommentNode   NodeKind = iota // Standalone comment on its own line // 独占一行的注释
+	StatementNode                 // Statement ending with ; // 以 ; 结尾的语句
+	BlockNode                     // Declaration with a { } body // 带 { } 主体的声明
+)
+
+// Node is a statement, block or standalone comment in a proto file
+// Statement tokens keep comments found inside the statement
+//
+// Node 是 proto 文件中的语句、代码块或独立注释
+// 语句的词法单元保留语句内部的注释
+type Node struct {
+	Kind          NodeKind // Node category // 节点类别
+	BlankBefore   bool     // Whether a blank line precedes it in the source // 源码中前面是否有空行
+	Comment       *Token   // Comment of CommentNode // CommentNode 的注释
+	Tokens        []*Token // Statement tokens with the ending ;, or block header tokens before { // 语句词法单元（含结尾 ;），或代码块 { 之前的头部词法单元
+	Trailing      *Token   // Comment after the statement, or after { of a block // 语句之后或代码块 { 之后的注释
+	Body          []*Node  // Nodes inside the block // 代码块内部的节点
+	CloseTrailing *Token   // Comment after } of a block // 代码块 } 之后的注释
+	CloseLine     int      // Line of } of a block // 代码块 } 所在的行
+	CloseSemi     bool     // Whether } is followed by ; // } 之后是否跟随 ;
+}
+
+// File is a parsed proto file
+// File 是解析后的 proto 文件
+type File struct {
+	Nodes []*Node // Top-level nodes // 顶层节点
+}
+
+// Parse tokenizes and parses the proto source into nodes
+// Parse 对 proto 源码进行词法分析并解析为节点
+func Parse(source []byte) (*File, error) {
+	tokens, err := Tokenize(source)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	p := &parser{tokens: tokens}
+	nodes, err := p.parseBody(false)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return &File{Nodes: nodes}, nil
+}
+
+type parser struct {
+	tokens []*Token
+	pos    int
+}
+
+func (p *parser) peek() *Token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return nil
+}
+
+// parseBody parses nodes until } when nested, or until the end of the file
+// parseBody 在嵌套时解析到 } 为止，否则解析到文件末尾
+func (p *parser) parseBody(nested bool) ([]*Node, error) {
+	var nodes []*Node
+	var last *Node
+	var lastLine = -1
+	for {
+		token := p.peek()
+		if token == nil {
+			if nested {
+				return nil, erero.New("unexpected end of file, missing }")
+			}
+			return nodes, nil
+		}
+		if token.Kind == Symbol && token.Text == "}" {
+			if !nested {
+				return nil, erero.Errorf("line %d: unexpected }", token.Line)
+			}
+			return nodes, nil
+		}
+		if token.Kind == Comment {
+			p.pos++
+			if last != nil && last.Kind != CommentNode && token.Line == lastLine && last.trailingSlot() {
+				last.setTrailing(token)
+			} else {
+				last = &Node{Kind: CommentNode, Comment: token, BlankBefore: lastLine > 0 && token.Line > lastLine+1}
+				nodes = append(nodes, last)
+			}
+			lastLine = token.EndLine
+			continue
+		}
+		node, err := p.parseStatement()
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		node.BlankBefore = lastLine > 0 && node.Tokens[0].Line > lastLine+1
+		if node.Kind == BlockNode && len(node.Tokens) == 0 {
+			return nil, erero.Errorf("line %d: unexpected {", token.Line)
+		}
+		nodes = append(nodes, node)
+		last = node
+		lastLine = node.endLine()
+	}
+}
+
+// parseStatement parses a statement ending with ; or a block declaration
+// parseStatement 解析以 ; 结尾的语句或代码块声明
+func (p *parser) parseStatement() (*Node, error) {
+	node := &Node{Kind: StatementNode}
+	var depth int
+	for {
+		token := p.peek()
+		if token == nil {
+			return nil, erero.New("unexpected end of file, missing ;")
+		}
+		p.pos++
+		if token.Kind == Symbol {
+			switch token.Text {
+			case "(", "[":
+				depth++
+			case ")", "]":
+				depth--
+			case "{":
+				if depth > 0 || isValueStart(node.Tokens) {
+					node.Tokens = append(node.Tokens, token)
+					if err := p.skipAggregate(&node.Tokens); err != nil {
+						return nil, erero.Wro(err)
+					}
+					continue
+				}
+				return p.parseBlock(node, token)
+			case "}":
+				if depth == 0 {
+					return nil, erero.Errorf("line %d: unexpected }", token.Line)
+				}
+			case ";":
+				if depth == 0 {
+					node.Tokens = append(node.Tokens, token)
+					return node, nil
+				}
+			}
+		}
+		node.Tokens = append(node.Tokens, token)
+	}
+}
+
+// parseBlock parses the body after { and the closing }
+// parseBlock 解析 { 之后的主体以及结尾的 }
+func (p *parser) parseBlock(node *Node, open *Token) (*Node, error) {
+	node.Kind = BlockNode
+	if token := p.peek(); token != nil && token.Kind == Comment && token.Line == open.Line {
+		node.Trailing = token
+		p.pos++
+	}
+	body, err := p.parseBody(true)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	node.Body = body
+	closing := p.peek()
+	p.pos++
+	node.CloseLine = closing.Line
+	if token := p.peek(); token != nil && token.Kind == Symbol && token.Text == ";" && token.Line == closing.Line {
+		node.CloseSemi = true
+		p.pos++
+	}
+	return node, nil
+}
+
+// skipAggregate appends the tokens of an option aggregate value until the matching }
+// skipAggregate 追加选项聚合值的词法单元，直到匹配的 }
+func (p *parser) skipAggregate(tokens *[]*Token) error {
+	depth := 1
+	for depth > 0 {
+		token := p.peek()
+		if token == nil {
+			return erero.New("unexpected end of file in aggregate value")
+		}
+		p.pos++
+		if token.Kind == Symbol {
+			switch token.Text {
+			case "{":
+				depth++
+			case "}":
+				depth--
+			}
+		}
+		*tokens = append(*tokens, token)
+	}
+	return nil
+}
+
+// isValueStart reports whether a { after these tokens starts a value rather than a body
+// isValueStart 判断这些词法单元之后的 { 是否开始一个值而不是主体
+func isValueStart(tokens []*Token) bool {
+	for idx := len(tokens) - 1; idx >= 0; idx-- {
+		if tokens[idx].Kind == Comment {
+			continue
+		}
+		return tokens[idx].Kind == Symbol && (tokens[idx].Text == "=" || tokens[idx].Text == ":")
+	}
+	return false
+}
+
+// trailingSlot reports whether a trailing comment can still be attached to the node
+// trailingSlot 判断节点是否还能附加尾随注释
+func (n *Node) trailingSlot() bool {
+	if n.Kind == BlockNode {
+		return n.CloseTrailing == nil
+	}
+	return n.Trailing == nil
+}
+
+// setTrailing attaches the comment after the end of the node
+// setTrailing 将注释附加到节点末尾之后
+func (n *Node) setTrailing(comment *Token) {
+	if n.Kind == BlockNode {
+		n.CloseTrailing = comment
+	} else {
+		n.Trailing = comment
+	}
+}
+
+// endLine returns the last source line of the node
+// endLine 返回节点在源码中的最后一行
+func (n *Node) endLine() int {
+	switch n.Kind {
+	case CommentNode:
+		return n.Comment.EndLine
+	case BlockNode:
+		return n.CloseLine
+	default:
+		return n.Tokens[len(n.Tokens)-1].EndLine
+	}
+}
@@ -0,0 +1,441 @@
+package protosyntax
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Options controls the layout produced by Print
+// Options 控制 Print 生成的布局
+type Options struct {
+	IndentWidth      int  // Spaces per nesting level // 每层嵌套的空格数
+	AlignAssignments bool // Align = of consecutive statements // 对齐连续语句的 =
+}
+
+// spacesBeforeTrailingComments matches the Google style used by clang-format on proto files
+// spacesBeforeTrailingComments 与 clang-format 在 proto 文件上使用的 Google 样式一致
+const spacesBeforeTrailingComments = 2
+
+// outLine is one line of output before trailing comment alignment
+// outLine 是尾随注释对齐之前的一行输出
+type outLine struct {
+	indent     string // Leading indentation // 前导缩进
+	code       string // Code text, empty on standalone comments // 代码文本，独立注释时为空
+	comment    string // Trailing or standalone comment // 尾随注释或独立注释
+	blank      bool   // Whether this is a blank line // 是否为空行
+	assignment int    // Byte offset of the first = in code, -1 when absent // code 中第一个 = 的字节偏移，不存在时为 -1
+}
+
+// Print renders the parsed file with normalized indentation and spacing
+// Keeps comments, keeps at most one blank line between nodes and drops blank lines at block edges
+// Aligns trailing comments of consecutive lines, the way clang-format does
+//
+// Print 以规范化的缩进和空格渲染解析后的文件
+// 保留注释，节点之间最多保留一个空行，并去除代码块边缘的空行
+// 像 clang-format 一样对齐连续行的尾随注释
+func Print(file *File, options *Options) []byte {
+	p := &printer{options: options}
+	p.printNodes(file.Nodes, 0)
+	p.alignAssignments()
+	p.alignComments()
+
+	var result strings.Builder
+	for _, line := range p.lines {
+		if line.blank {
+			result.WriteString("\n")
+			continue
+		}
+		text := line.indent + line.code
+		if line.comment != "" {
+			if line.code != "" {
+				text += " "
+			}
+			text += line.comment
+		}
+		result.WriteString(strings.TrimRight(text, " ") + "\n")
+	}
+	return []byte(result.String())
+}
+
+type printer struct {
+	options *Options
+	lines   []*outLine
+}
+
+func (p *printer) indent(level int) string {
+	return strings.Repeat(" ", level*p.options.IndentWidth)
+}
+
+func (p *printer) emit(line *outLine) {
+	p.lines = append(p.lines, line)
+}
+
+// printNodes renders nodes at the nesting level
+// printNodes 在嵌套层级上渲染节点
+func (p *printer) printNodes(nodes []*Node, level int) {
+	for idx, node := range nodes {
+		if node.BlankBefore && idx > 0 {
+			p.emit(&outLine{blank: true})
+		}
+		switch node.Kind {
+		case CommentNode:
+			p.printComment(node.Comment, level)
+		case StatementNode:
+			p.printTokens(node.Tokens, level, commentText(node.Trailing))
+		case BlockNode:
+			p.printBlock(node, level)
+		}
+	}
+}
+
+// printBlock renders a block header, its body and the closing brace
+// printBlock 渲染代码块头部、主体和结尾的大括号
+func (p *printer) printBlock(node *Node, level int) {
+	closing := "}"
+	if node.CloseSemi {
+		closing = "};"
+	}
+	if len(node.Body) == 0 && node.Trailing == nil {
+		p.printTokens(append(node.Tokens, &Token{Kind: Symbol, Text: "{" + closing}), level, commentText(node.CloseTrailing))
+		return
+	}
+	p.printTokens(append(node.Tokens, &Token{Kind: Symbol, Text: "{"}), level, commentText(node.Trailing))
+	p.printNodes(node.Body, level+1)
+	p.emit(&outLine{indent: p.indent(level), code: closing, comment: commentText(node.CloseTrailing), assignment: -1})
+}
+
+// printComment renders a standalone comment, shifting continuation lines of block comments with it
+// printComment 渲染独立注释，块注释的后续行随之平移
+func (p *printer) printComment(comment *Token, level int) {
+	indent := p.indent(level)
+	lines := strings.Split(comment.Text, "\n")
+	p.emit(&outLine{indent: indent, comment: lines[0], assignment: -1})
+	shift := len(indent) - comment.Column
+	for _, text := range lines[1:] {
+		text = strings.TrimRight(text, " \t\r")
+		switch {
+		case shift > 0 && text != "":
+			text = strings.Repeat(" ", shift) + text
+		case shift < 0:
+			trim := min(-shift, len(text)-len(strings.TrimLeft(text, " ")))
+			text = text[trim:]
+		}
+		p.emit(&outLine{comment: text, assignment: -1})
+	}
+}
+
+// printTokens renders statement tokens starting at the level, the trailing comment goes to the last line
+// printTokens 从该层级开始渲染语句词法单元，尾随注释放在最后一行
+func (p *printer) printTokens(tokens []*Token, level int, trailing string) {
+	r := &renderer{printer: p, level: level, first: true, line: &outLine{indent: p.indent(level), assignment: -1}}
+	r.render(tokens)
+	r.line.code = r.code.String()
+	if trailing != "" {
+		r.line.comment = trailing
+	}
+	p.emit(r.line)
+}
+
+// renderer writes tokens of one statement, breaking lines inside multi-line aggregates
+// renderer 写出一条语句的词法单元，在多行聚合值内部换行
+type renderer struct {
+	printer *printer
+	level   int
+	first   bool // Whether writing the first line of the statement // 是否正在写语句的第一行
+	line    *outLine
+	prev    *Token
+	code    strings.Builder
+}
+
+func (r *renderer) render(tokens []*Token) {
+	for idx := 0; idx < len(tokens); idx++ {
+		token := tokens[idx]
+		if token.Kind == Comment {
+			r.writeComment(token, r.level+2)
+			continue
+		}
+		if token.Kind == Symbol && token.Text == "{" {
+			if end := matchBrace(tokens, idx); end > idx {
+				r.renderAggregate(tokens[idx:end+1], r.level)
+				idx = end
+				continue
+			}
+		}
+		r.write(token, r.needSpace(tokens, idx))
+	}
+}
+
+// write appends the token text, with a space before it when needed
+// write 追加词法单元文本，必要时在前面加空格
+func (r *renderer) write(token *Token, space bool) {
+	if space && r.code.Len() > 0 {
+		r.code.WriteString(" ")
+	}
+	if token.Kind == Symbol && token.Text == "=" && r.first && r.line.assignment < 0 {
+		r.line.assignment = r.code.Len()
+	}
+	r.code.WriteString(token.Text)
+	r.prev = token
+}
+
+// writeComment places a comment found inside a statement, a line comment ends the line
+// writeComment 放置语句内部的注释，行注释会结束当前行
+func (r *renderer) writeComment(comment *Token, level int) {
+	if strings.HasPrefix(comment.Text, "/*") && !strings.Contains(comment.Text, "\n") {
+		r.write(comment, true)
+		return
+	}
+	r.line.comment = comment.Text
+	r.newLine(level)
+}
+
+// newLine flushes the current line when it has content and starts a new one at the level
+// newLine 当前行有内容时输出该行，并在该层级开始新的一行
+func (r *renderer) newLine(level int) {
+	r.line.code = r.code.String()
+	if r.line.code != "" || r.line.comment != "" {
+		r.printer.emit(r.line)
+		r.first = false
+	}
+	r.line = &outLine{indent: r.printer.indent(level), assignment: -1}
+	r.code.Reset()
+	r.prev = nil
+}
+
+// renderAggregate writes an option aggregate value, one field per line when the source spans lines
+// renderAggregate 写出选项聚合值，源码跨多行时每个字段一行
+func (r *renderer) renderAggregate(tokens []*Token, level int) {
+	open, closing := tokens[0], tokens[len(tokens)-1]
+	inner := tokens[1 : len(tokens)-1]
+	r.write(open, r.prev != nil && !(r.prev.Kind == Symbol && (r.prev.Text == "[" || r.prev.Text == "(")))
+	if len(inner) == 0 {
+		r.write(closing, false)
+		return
+	}
+	if open.Line == closing.Line {
+		for idx := range inner {
+			r.write(inner[idx], r.needSpace(inner, idx))
+		}
+		r.write(closing, true)
+		return
+	}
+	for _, field := range splitFields(inner) {
+		r.newLine(level + 1)
+		for idx := 0; idx < len(field); idx++ {
+			token := field[idx]
+			if token.Kind == Comment {
+				r.writeComment(token, level+1)
+				continue
+			}
+			if token.Kind == Symbol && token.Text == "{" {
+				if end := matchBrace(field, idx); end > idx {
+					r.renderAggregate(field[idx:end+1], level+1)
+					idx = end
+					continue
+				}
+			}
+			r.write(token, r.needSpace(field, idx))
+		}
+	}
+	r.newLine(level)
+	r.write(closing, false)
+}
+
+// needSpace decides whether a space goes before tokens[idx]
+// needSpace 判断 tokens[idx] 之前是否需要空格
+func (r *renderer) needSpace(tokens []*Token, idx int) bool {
+	token, prev := tokens[idx], r.prev
+	if prev == nil {
+		return false
+	}
+	if token.Kind == Symbol {
+		switch token.Text {
+		case ";", ",", ")", "]", ">", ":":
+			return false
+		case ".", "/":
+			return !adjacent(prev, token)
+		case "(":
+			if prev.Kind == Symbol && (prev.Text == "[" || prev.Text == "(" || prev.Text == "." || prev.Text == "-") {
+				return false
+			}
+			return !isMethodName(tokens, idx-1)
+		case "<":
+			return false
+		}
+	}
+	if prev.Kind == Symbol {
+		switch prev.Text {
+		case "(", "[", "<", ".", "/":
+			return !adjacent(prev, token) && (prev.Text == "." || prev.Text == "/")
+		case "-", "+":
+			return !isUnary(tokens, idx-1)
+		}
+	}
+	return true
+}
+
+// isUnary reports whether the sign at idx applies to the following number
+// isUnary 判断 idx 处的符号是否作用于后面的数字
+func isUnary(tokens []*Token, idx int) bool {
+	if idx <= 0 {
+		return true
+	}
+	prev := tokens[idx-1]
+	return prev.Kind == Symbol && strings.Contains("=:[(,{<", prev.Text)
+}
+
+// isMethodName reports whether tokens[idx] is the method name of an rpc statement
+// isMethodName 判断 tokens[idx] 是否为 rpc 语句的方法名
+func isMethodName(tokens []*Token, idx int) bool {
+	return idx == 1 && tokens[0].Text == "rpc" && tokens[idx].Kind == Ident
+}
+
+// adjacent reports whether two tokens touch each other in the source
+// adjacent 判断两个词法单元在源码中是否紧挨
+func adjacent(prev *Token, token *Token) bool {
+	return prev.EndLine == token.Line && prev.Column+len(prev.Text) == token.Column
+}
+
+// matchBrace returns the index of the } matching the { at idx, or idx when unmatched
+// matchBrace 返回与 idx 处 { 匹配的 } 的下标，不匹配时返回 idx
+func matchBrace(tokens []*Token, idx int) int {
+	depth := 0
+	for end := idx; end < len(tokens); end++ {
+		if tokens[end].Kind != Symbol {
+			continue
+		}
+		switch tokens[end].Text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				return end
+			}
+		}
+	}
+	return idx
+}
+
+// splitFields splits aggregate content into text format fields, each with its separator and comments
+// splitFields 将聚合值内容拆分为文本格式字段，每个字段带有其分隔符和注释
+func splitFields(tokens []*Token) [][]*Token {
+	var fields [][]*Token
+	var field []*Token
+	var depth int
+	flush := func() {
+		if len(field) > 0 {
+			fields = append(fields, field)
+			field = nil
+		}
+	}
+	for idx, token := range tokens {
+		field = append(field, token)
+		if token.Kind == Symbol {
+			switch token.Text {
+			case "{", "[", "<":
+				depth++
+			case "}", "]", ">":
+				depth--
+			}
+		}
+		if depth > 0 || token.Kind == Comment {
+			continue
+		}
+		// a field ends after its value, when the next token starts a new name
+		// 字段在其值之后结束，即下一个词法单元开始新的名称
+		next := nextSignificant(tokens, idx+1)
+		switch {
+		case token.Kind == Symbol && (token.Text == "," || token.Text == ";"):
+			flush()
+		case next == nil:
+		case token.Kind == Symbol && (token.Text == ":" || token.Text == "-" || token.Text == "." || token.Text == "/"):
+		case next.Kind == Symbol && strings.Contains(":{<,;./", next.Text):
+		case token.Kind == Symbol && token.Text == "[":
+		default:
+			if token.Kind != Symbol || token.Text == "}" || token.Text == "]" || token.Text == ">" {
+				if next.Kind == Ident || (next.Kind == Symbol && next.Text == "[") {
+					flush()
+				}
+			}
+		}
+	}
+	flush()
+	return fields
+}
+
+// nextSignificant returns the next non-comment token from idx
+// nextSignificant 返回从 idx 开始的下一个非注释词法单元
+func nextSignificant(tokens []*Token, idx int) *Token {
+	for ; idx < len(tokens); idx++ {
+		if tokens[idx].Kind != Comment {
+			return tokens[idx]
+		}
+	}
+	return nil
+}
+
+// alignAssignments pads code so = of consecutive statements line up
+// alignAssignments 填充代码使连续语句的 = 对齐
+func (p *printer) alignAssignments() {
+	if !p.options.AlignAssignments {
+		return
+	}
+	p.alignRuns(func(line *outLine) bool {
+		return line.assignment >= 0 && !strings.Contains(line.code, "{")
+	}, func(line *outLine) int {
+		return width(line.indent + strings.TrimRight(line.code[:line.assignment], " "))
+	}, func(line *outLine, column int) {
+		before := strings.TrimRight(line.code[:line.assignment], " ")
+		pad := column - width(line.indent+before)
+		line.code = before + strings.Repeat(" ", pad+1) + line.code[line.assignment:]
+	})
+}
+
+// alignComments moves trailing comments of consecutive lines to the same column
+// alignComments 将连续行的尾随注释移动到同一列
+func (p *printer) alignComments() {
+	p.alignRuns(func(line *outLine) bool {
+		return line.code != "" && line.comment != ""
+	}, func(line *outLine) int {
+		return width(line.indent + line.code)
+	}, func(line *outLine, column int) {
+		line.code += strings.Repeat(" ", column-width(line.indent+line.code)+spacesBeforeTrailingComments-1)
+	})
+}
+
+// alignRuns applies the alignment on each run of consecutive matching lines
+// alignRuns 对每一段连续匹配的行应用对齐
+func (p *printer) alignRuns(match func(*outLine) bool, column func(*outLine) int, apply func(*outLine, int)) {
+	for start := 0; start < len(p.lines); {
+		if !match(p.lines[start]) {
+			start++
+			continue
+		}
+		end := start
+		maxColumn := 0
+		for end < len(p.lines) && match(p.lines[end]) {
+			maxColumn = max(maxColumn, column(p.lines[end]))
+			end++
+		}
+		for _, line := range p.lines[start:end] {
+			apply(line, maxColumn)
+		}
+		start = end
+	}
+}
+
+// width returns the display width of the text, counting runes
+// width 返回文本的显示宽度，按字符计数
+func width(text string) int {
+	return utf8.RuneCountInString(text)
+}
+
+// commentText returns the comment text, or empty when absent
+// commentText 返回注释文本，不存在时返回空
+func commentText(comment *Token) string {
+	if comment == nil {
+		return ""
+	}
+	return comment.Text
+}
@@ -0,0 +1,219 @@
+package protosyntax
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/rese"
+	"github.com/yyle88/runpath"
+)
+
+func format(t *testing.T, source string) string {
+	file, err := Parse([]byte(source))
+	require.NoError(t, err)
+	return string(Print(file, &Options{IndentWidth: 2}))
+}
+
+func TestTokenize(t *testing.T) {
+	tokens, err := Tokenize([]byte("int32 id = -1 [default = 1.5e-3]; // done\n/* a\nb */ 'x\\'y'"))
+	require.NoError(t, err)
+	var texts []string
+	for _, token := range tokens {
+		texts = append(texts, token.Text)
+	}
+	require.Equal(t, []string{"int32", "id", "=", "-", "1", "[", "default", "=", "1.5e-3", "]", ";", "// done", "/* a\nb */", `'x\'y'`}, texts)
+	require.Equal(t, 3, tokens[len(tokens)-2].EndLine)
+	require.Equal(t, 3, tokens[len(tokens)-1].Line)
+
+	_, err = Tokenize([]byte(`string s = "abc`))
+	require.Error(t, err)
+}
+
+func TestPrint(t *testing.T) {
+	const source = `syntax="proto3";
+
+package service;
+
+option go_package="service/proto;service";
+
+message Request {
+int32 page=1;
+int32 size=2;
+repeated string filters  =3;
+}
+
+message Response{
+repeated string data=1;
+  int32 total_count   = 2;
+}
+
+service TestService {
+rpc GetData(Request)returns(Response);
+}`
+	// same as clang-format output of the protoformat tests
+	const expected = `syntax = "proto3";
+
+package service;
+
+option go_package = "service/proto;service";
+
+message Request {
+  int32 page = 1;
+  int32 size = 2;
+  repeated string filters = 3;
+}
+
+message Response {
+  repeated string data = 1;
+  int32 total_count = 2;
+}
+
+service TestService {
+  rpc GetData(Request) returns (Response);
+}
+`
+	require.Equal(t, expected, format(t, source))
+	require.Equal(t, expected, format(t, expected))
+}
+
+func TestPrintDetails(t *testing.T) {
+	const source = `// header comment
+
+
+syntax = "proto2";
+import public "a.proto";
+package  a.b ;
+option (my.opt).value=-5;
+option (my.agg) = {
+  name: "x"   count: 2
+  nested { flag: true }
+};
+message Outer {
+
+  optional .a.b.Inner inner = 1 [deprecated=true, (custom)= { a: 1 }];
+  map<string,int32> counts=2;   // counts
+  optional group Result = 3 {
+    optional string url = 1;
+  }
+  reserved 4 , 6 to 9;
+  reserved "old";
+  oneof kind { string s = 10; int64 n = 11; }
+  extensions 100 to max;
+  message Empty {}
+
+}
+service S {
+  rpc Stream (stream Req) returns (stream Resp) {
+    option idempotency_level = NO_SIDE_EFFECTS;
+  }
+  /*
+   * block comment
+   */
+  rpc Get(Req) returns (Resp);  // get
+}
+`
+	const expected = `// header comment
+
+syntax = "proto2";
+import public "a.proto";
+package a.b;
+option (my.opt).value = -5;
+option (my.agg) = {
+  name: "x"
+  count: 2
+  nested { flag: true }
+};
+message Outer {
+  optional .a.b.Inner inner = 1 [deprecated = true, (custom) = { a: 1 }];
+  map<string, int32> counts = 2;  // counts
+  optional group Result = 3 {
+    optional string url = 1;
+  }
+  reserved 4, 6 to 9;
+  reserved "old";
+  oneof kind {
+    string s = 10;
+    int64 n = 11;
+  }
+  extensions 100 to max;
+  message Empty {}
+}
+service S {
+  rpc Stream(stream Req) returns (stream Resp) {
+    option idempotency_level = NO_SIDE_EFFECTS;
+  }
+  /*
+   * block comment
+   */
+  rpc Get(Req) returns (Resp);  // get
+}
+`
+	output := format(t, source)
+	require.Equal(t, expected, output)
+	require.Equal(t, expected, format(t, output))
+}
+
+func TestPrintAlignment(t *testing.T) {
+	const source = `message Enum {
+  int32 code = 1; // 数字编码
+  string name = 2;  // 枚举名称
+  string description = 3;
+  string desc = 4; // 枚举描述
+}
+`
+	const expected = `message Enum {
+  int32 code = 1;   // 数字编码
+  string name = 2;  // 枚举名称
+  string description = 3;
+  string desc = 4;  // 枚举描述
+}
+`
+	require.Equal(t, expected, format(t, source))
+
+	file := rese.P1(Parse([]byte(source)))
+	const aligned = `message Enum {
+  int32 code         = 1;  // 数字编码
+  string name        = 2;  // 枚举名称
+  string description = 3;
+  string desc        = 4;  // 枚举描述
+}
+`
+	require.Equal(t, aligned, string(Print(file, &Options{IndentWidth: 2, AlignAssignments: true})))
+}
+
+func TestPrintExampleProtos(t *testing.T) {
+	// already formatted by clang-format, the native printer keeps them unchanged
+	source := rese.V1(os.ReadFile(runpath.PARENT.UpTo(2, "internal/examples/example1/protos/enum.proto")))
+	require.Equal(t, string(source), format(t, string(source)))
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, source := range []string{
+		"message A {",
+		"message A { int32 a = 1; }}",
+		"syntax = \"proto3\"",
+	} {
+		_, err := Parse([]byte(source))
+		require.Error(t, err, source)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	divergence, err := Compare([]byte("message A{int32 a=1;/* x\n   y */}"), []byte("message A {\n  int32 a = 1;\n  /* x\n y */\n}\n"))
+	require.NoError(t, err)
+	require.Nil(t, divergence)
+
+	divergence, err = Compare([]byte("option a = \"x y\";\n// keep\n"), []byte("option a = \"x  y\";\n"))
+	require.NoError(t, err)
+	require.NotNil(t, divergence)
+	require.Equal(t, 1, divergence.OriginalLine)
+	require.Equal(t, `"x y"`, divergence.Original)
+	require.Equal(t, `"x  y"`, divergence.Formatted)
+
+	divergence, err = Compare([]byte("a;\n// keep\n"), []byte("a;\n"))
+	require.NoError(t, err)
+	require.Equal(t, 2, divergence.OriginalLine)
+	require.Equal(t, 0, divergence.FormattedLine)
+	require.Contains(t, divergence.Error(), "// keep")
+}
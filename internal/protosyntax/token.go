@@ -0,0 +1,135 @@
+// Package protosyntax: Tokenizer, comment-preserving parser and printer for Protocol Buffers sources
+// Supports proto2, proto3 and editions files without semantic validation
+// Keeps comments and blank lines so formatting round-trips the content of the file
+// Designed for internal use by the protoformat native backend and its tooling
+//
+// protosyntax: Protocol Buffers 源码的词法分析器、保留注释的解析器和打印器
+// 支持 proto2、proto3 和 editions 文件，不做语义校验
+// 保留注释和空行，使格式化后文件内容保持一致
+// 专为 protoformat 原生后端及其工具内部使用而设计
+package protosyntax
+
+import (
+	"strings"
+
+	"github.com/yyle88/erero"
+)
+
+// Kind is the category of a token
+// Kind 是词法单元的类别
+type Kind int
+
+const (
+	Ident   Kind = iota // Identifiers and keywords // 标识符和关键字
+	Number              // Integer and float literals // 整数和浮点数字面量
+	String              // Quoted string literals // 带引号的字符串字面量
+	Symbol              // Punctuation such as { } ; = // 标点符号，例如 { } ; =
+	Comment             // Line and block comments // 行注释和块注释
+)
+
+// Token is a lexical unit with its position in the source
+// Token 是带有源码位置的词法单元
+type Token struct {
+	Kind    Kind   // Token category // 词法单元类别
+	Text    string // Exact source text // 精确的源码文本
+	Line    int    // Start line, 1-based // 起始行，从 1 开始
+	EndLine int    // End line, differs from Line on multi-line block comments // 结束行，多行块注释时与 Line 不同
+	Column  int    // Start column in bytes, 0-based // 起始列（字节），从 0 开始
+}
+
+// Tokenize splits the proto source into tokens, comments included
+// Returns error on unterminated strings and block comments, or unexpected characters
+//
+// Tokenize 将 proto 源码拆分为词法单元，包含注释
+// 遇到未结束的字符串、块注释或意外字符时返回错误
+func Tokenize(source []byte) ([]*Token, error) {
+	text := string(source)
+	text = strings.TrimPrefix(text, "\ufeff")
+	var tokens []*Token
+	line, lineStart := 1, 0
+	for pos := 0; pos < len(text); {
+		char := text[pos]
+		start := pos
+		switch {
+		case char == '\n':
+			pos++
+			line++
+			lineStart = pos
+			continue
+		case char == ' ' || char == '\t' || char == '\r' || char == '\f' || char == '\v':
+			pos++
+			continue
+		case strings.HasPrefix(text[pos:], "//"):
+			end := strings.IndexByte(text[pos:], '\n')
+			if end < 0 {
+				end = len(text) - pos
+			}
+			pos += end
+			tokens = append(tokens, &Token{Kind: Comment, Text: strings.TrimRight(text[start:pos], " \t\r"), Line: line, EndLine: line, Column: start - lineStart})
+			continue
+		case strings.HasPrefix(text[pos:], "/*"):
+			end := strings.Index(text[pos+2:], "*/")
+			if end < 0 {
+				return nil, erero.Errorf("line %d: unterminated block comment", line)
+			}
+			pos += end + 4
+			content := text[start:pos]
+			endLine := line + strings.Count(content, "\n")
+			tokens = append(tokens, &Token{Kind: Comment, Text: content, Line: line, EndLine: endLine, Column: start - lineStart})
+			if endLine != line {
+				line = endLine
+				lineStart = start + strings.LastIndexByte(content, '\n') + 1
+			}
+			continue
+		case char == '"' || char == '\'':
+			pos++
+			for pos < len(text) && text[pos] != char {
+				if text[pos] == '\n' {
+					return nil, erero.Errorf("line %d: unterminated string", line)
+				}
+				if text[pos] == '\\' {
+					pos++
+				}
+				pos++
+			}
+			if pos >= len(text) {
+				return nil, erero.Errorf("line %d: unterminated string", line)
+			}
+			pos++
+			tokens = append(tokens, &Token{Kind: String, Text: text[start:pos], Line: line, EndLine: line, Column: start - lineStart})
+			continue
+		case isIdentStart(char):
+			for pos < len(text) && isIdentPart(text[pos]) {
+				pos++
+			}
+			tokens = append(tokens, &Token{Kind: Ident, Text: text[start:pos], Line: line, EndLine: line, Column: start - lineStart})
+			continue
+		case isDigit(char) || (char == '.' && pos+1 < len(text) && isDigit(text[pos+1])):
+			for pos < len(text) && (isIdentPart(text[pos]) || text[pos] == '.' ||
+				((text[pos] == '+' || text[pos] == '-') && (text[pos-1] == 'e' || text[pos-1] == 'E') && !strings.HasPrefix(text[start:pos], "0x") && !strings.HasPrefix(text[start:pos], "0X"))) {
+				pos++
+			}
+			tokens = append(tokens, &Token{Kind: Number, Text: text[start:pos], Line: line, EndLine: line, Column: start - lineStart})
+			continue
+		case strings.IndexByte("{}[]()<>;,=:.-+/", char) >= 0:
+			pos++
+			tokens = append(tokens, &Token{Kind: Symbol, Text: text[start:pos], Line: line, EndLine: line, Column: start - lineStart})
+			continue
+		default:
+			return nil, erero.Errorf("line %d: unexpected character %q", line, char)
+		}
+	}
+	return tokens, nil
+}
+
+func isIdentStart(char byte) bool {
+	return char == '_' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z')
+}
+
+func isIdentPart(char byte) bool {
+	return isIdentStart(char) || isDigit(char)
+}
+
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
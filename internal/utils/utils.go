@@ -10,18 +10,28 @@
 package utils
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 )
 
+// VcsDIRs are version control metadata DIRs, their files are never sources of the project
+// Skipped by WalkFilesWithExt and by the watcher, so both visit the same files
+//
+// VcsDIRs 是版本控制的元数据目录，其中的文件从不是项目源码
+// WalkFilesWithExt 和监听器都会跳过它们，使两者访问相同的文件
+var VcsDIRs = []string{".git", ".hg", ".svn", ".bzr", "_darcs", ".jj"}
+
 // WalkFilesWithExt traverses a file structure and processes files with matching extensions
-// Executes the provided run function on each file that matches the specified extension
-// Skips paths, handles errors with care, and validates file info before processing
+// Executes the provided run function on each file that matches the specified extension, ignoring case
+// Skips version control DIRs such as .git, handles errors with care, and validates file info before processing
 // Returns any error encountered during navigation or callback execution
 //
 // WalkFilesWithExt 遍历文件结构并处理匹配扩展名的文件
-// 对每个匹配指定扩展名的文件执行提供的 run 函数
-// 跳过路径，细心处理错误，处理前验证文件信息
+// 对每个匹配指定扩展名（忽略大小写）的文件执行提供的 run 函数
+// 跳过 .git 等版本控制目录，细心处理错误，处理前验证文件信息
 // 返回导航或回调执行期间遇到的任何错误
 func WalkFilesWithExt(root string, extension string, run func(path string, info os.FileInfo) error) (err error) {
 	err = filepath.Walk(root,
@@ -33,9 +43,12 @@ func WalkFilesWithExt(root string, extension string, run func(path string, info
 				return nil
 			}
 			if info.IsDir() {
+				if path != root && slices.Contains(VcsDIRs, info.Name()) {
+					return filepath.SkipDir
+				}
 				return nil
 			}
-			if filepath.Ext(path) == extension {
+			if strings.EqualFold(filepath.Ext(path), extension) {
 				return run(path, info)
 			}
 			return nil
@@ -43,3 +56,90 @@ func WalkFilesWithExt(root string, extension string, run func(path string, info
 	)
 	return err
 }
+
+// MatchExt reports whether the extension of the path is one of the extensions
+// Extensions match regardless of case, as clang-format picks languages by extension
+//
+// MatchExt 判断路径的扩展名是否为这些扩展名之一
+// 扩展名匹配时忽略大小写，与 clang-format 按扩展名选择语言的方式一致
+func MatchExt(path string, extensions []string) bool {
+	return slices.ContainsFunc(extensions, func(extension string) bool {
+		return strings.EqualFold(filepath.Ext(path), extension)
+	})
+}
+
+// MergePaths resolves the given paths against root and removes overlapping entries
+// Relative paths are joined with root, and root itself is used when no paths are given
+// Drops duplicates and any path nested inside another directory path in the list
+// Keeps the first-seen order so the formatting sequence stays predictable
+//
+// MergePaths 将给定路径基于 root 解析并去除重叠的条目
+// 相对路径会与 root 拼接，未给出路径时使用 root 本身
+// 去除重复路径以及嵌套在列表中其他目录路径内的路径
+// 保持首次出现的顺序，使格式化顺序可预测
+func MergePaths(root string, paths []string) []string {
+	if len(paths) == 0 {
+		paths = []string{root}
+	}
+	var absPaths []string
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, path)
+		}
+		absPaths = append(absPaths, filepath.Clean(path))
+	}
+
+	var results []string
+	for _, path := range absPaths {
+		if slices.Contains(results, path) {
+			continue
+		}
+		if slices.ContainsFunc(absPaths, func(other string) bool {
+			return other != path && IsSubPath(other, path)
+		}) {
+			continue
+		}
+		results = append(results, path)
+	}
+	return results
+}
+
+// IsSubPath reports whether path is located inside the parent DIR
+// Both paths are expected to be cleaned absolute paths
+//
+// IsSubPath 判断 path 是否位于 parent 目录内部
+// 两个路径都应是清理过的绝对路径
+func IsSubPath(parent string, path string) bool {
+	rel, err := filepath.Rel(parent, path)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// SplitFileList splits a file list into paths using NUL or newline separators
+// NUL separators take precedence, matching output of git ls-files -z and find -print0
+// Trims the carriage return of CRLF lists and skips empty entries in newline-separated lists
+// Spaces are kept, they may belong to the file names
+//
+// SplitFileList 使用 NUL 或换行分隔符将文件列表拆分为路径
+// NUL 分隔符优先，与 git ls-files -z 和 find -print0 的输出一致
+// 在换行分隔的列表中去除 CRLF 列表的回车符并跳过空条目
+// 空格会被保留，它们可能属于文件名
+func SplitFileList(data []byte) []string {
+	var separator = "\n"
+	if bytes.IndexByte(data, 0) >= 0 {
+		separator = "\x00"
+	}
+	var paths []string
+	for _, path := range strings.Split(string(data), separator) {
+		if separator == "\n" {
+			path = strings.TrimSuffix(path, "\r")
+		}
+		if path == "" {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
@@ -2,9 +2,12 @@ package utils
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
 	"github.com/yyle88/runpath"
 )
 
@@ -16,3 +19,58 @@ func TestWalkFilesWithExt(t *testing.T) {
 	})
 	require.NoError(t, err)
 }
+
+func TestWalkFilesWithExtSkipsVCS(t *testing.T) {
+	tempDIR := rese.V1(os.MkdirTemp("", "walk-vcs-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	// 版本控制目录中的无扩展名文件不会被遍历
+	must.Done(os.MkdirAll(filepath.Join(tempDIR, ".git", "refs"), 0755))
+	must.Done(os.WriteFile(filepath.Join(tempDIR, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0644))
+	must.Done(os.WriteFile(filepath.Join(tempDIR, ".git", "refs", "main"), []byte("0000\n"), 0644))
+	must.Done(os.WriteFile(filepath.Join(tempDIR, "Makefile"), []byte("all:\n"), 0644))
+
+	var paths []string
+	require.NoError(t, WalkFilesWithExt(tempDIR, "", func(path string, info os.FileInfo) error {
+		paths = append(paths, path)
+		return nil
+	}))
+	require.Equal(t, []string{filepath.Join(tempDIR, "Makefile")}, paths)
+}
+
+func TestMatchExt(t *testing.T) {
+	require.True(t, MatchExt("src/Foo.CPP", []string{".h", ".cpp"}))
+	require.True(t, MatchExt("src/foo.cpp", []string{".CPP"}))
+	require.False(t, MatchExt("src/foo.cppm", []string{".cpp"}))
+	require.False(t, MatchExt("src/Makefile", []string{".cpp"}))
+}
+
+func TestMergePaths(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "project")
+
+	require.Equal(t, []string{root}, MergePaths(root, nil))
+
+	paths := MergePaths(root, []string{"src", "api/", "src/core", "./src", "api/v1/a.proto", "docs/a.proto"})
+	require.Equal(t, []string{
+		filepath.Join(root, "src"),
+		filepath.Join(root, "api"),
+		filepath.Join(root, "docs", "a.proto"),
+	}, paths)
+
+	require.Equal(t, []string{root}, MergePaths(root, []string{".", "src", "../project/api"}))
+}
+
+func TestIsSubPath(t *testing.T) {
+	require.True(t, IsSubPath("/a", "/a/b"))
+	require.True(t, IsSubPath("/a", "/a/b/c.proto"))
+	require.False(t, IsSubPath("/a", "/a"))
+	require.False(t, IsSubPath("/a", "/ab"))
+	require.False(t, IsSubPath("/a/b", "/a"))
+}
+
+func TestSplitFileList(t *testing.T) {
+	require.Equal(t, []string{"a.proto", "b/c.h"}, SplitFileList([]byte("a.proto\r\n\nb/c.h\n")))
+	require.Equal(t, []string{"a.proto", "b c.h"}, SplitFileList([]byte("a.proto\x00b c.h\x00")))
+	require.Equal(t, []string{" a.proto", "b c.h "}, SplitFileList([]byte(" a.proto\r\nb c.h \n")))
+	require.Empty(t, SplitFileList([]byte("\n\n")))
+}
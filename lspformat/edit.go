@@ -0,0 +1,63 @@
+package lspformat
+
+import (
+	"bytes"
+	"unicode/utf16"
+)
+
+// position is a zero-based line and UTF-16 character offset, the LSP default encoding
+// position 是从零开始的行号和 UTF-16 字符偏移，即 LSP 的默认编码
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type textRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type textEdit struct {
+	Range   textRange `json:"range"`
+	NewText string    `json:"newText"`
+}
+
+// textEdits returns the edit turning the source into the formatted content, none when they are the same
+// The edit replaces whole lines from the first to the last changed line, so it never splits a character or a CRLF
+//
+// textEdits 返回将源码变为格式化内容的编辑，两者相同时不返回编辑
+// 编辑替换从第一个到最后一个变化行的整行内容，因此不会拆分字符或 CRLF
+func textEdits(source []byte, formatted []byte) []*textEdit {
+	if bytes.Equal(source, formatted) {
+		return []*textEdit{}
+	}
+	prefix := 0
+	for prefix < len(source) && prefix < len(formatted) && source[prefix] == formatted[prefix] {
+		prefix++
+	}
+	prefix = bytes.LastIndexByte(source[:prefix], '\n') + 1
+
+	suffix := 0
+	for suffix < len(source)-prefix && suffix < len(formatted)-prefix && source[len(source)-1-suffix] == formatted[len(formatted)-1-suffix] {
+		suffix++
+	}
+	// shrink the common suffix until it starts a line
+	// 缩短公共后缀，直到其从行首开始
+	for suffix > 0 && len(source)-suffix > prefix && source[len(source)-suffix-1] != '\n' {
+		suffix--
+	}
+	return []*textEdit{{
+		Range:   textRange{Start: offsetPosition(source, prefix), End: offsetPosition(source, len(source)-suffix)},
+		NewText: string(formatted[prefix : len(formatted)-suffix]),
+	}}
+}
+
+// offsetPosition converts a byte offset of the content into a position
+// offsetPosition 将内容中的字节偏移转换为位置
+func offsetPosition(content []byte, offset int) position {
+	lineStart := bytes.LastIndexByte(content[:offset], '\n') + 1
+	return position{
+		Line:      bytes.Count(content[:offset], []byte("\n")),
+		Character: len(utf16.Encode(bytes.Runes(content[lineStart:offset]))),
+	}
+}
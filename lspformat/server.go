@@ -0,0 +1,337 @@
+// Package lspformat: Language Server Protocol formatting server over stdio
+// Answers textDocument/formatting, rangeFormatting and onTypeFormatting through the registry
+// Styles come from the registered languages and project config, not from the editor, so every editor formats alike
+// Open documents are formatted from the editor buffer, others are read from disk
+//
+// lspformat: 基于标准输入输出的语言服务器协议格式化服务
+// 通过注册表响应 textDocument/formatting、rangeFormatting 和 onTypeFormatting
+// 样式来自已注册的语言和项目配置，而非编辑器，使所有编辑器格式化结果一致
+// 已打开的文档从编辑器缓冲区格式化，其余文档从磁盘读取
+package lspformat
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// JSON-RPC and LSP error codes answered by the Server
+// Server 返回的 JSON-RPC 和 LSP 错误码
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeNotInitialized = -32002
+	codeRequestFailed  = -32803
+)
+
+// Server is an LSP server formatting documents through the registry
+// Requests are handled one by one in the order they arrive
+//
+// Server 是通过注册表格式化文档的 LSP 服务
+// 请求按到达顺序逐个处理
+type Server struct {
+	config      *osexec.ExecConfig
+	registry    *clangformat.Registry
+	documents   map[string][]byte
+	initialized bool
+	shutdown    bool
+	options     *clangformat.Options
+}
+
+// NewServer creates a Server formatting the documents of the registered languages
+//
+// NewServer 创建格式化已注册语言文档的 Server
+func NewServer(config *osexec.ExecConfig, registry *clangformat.Registry) *Server {
+	return &Server{
+		config:    config,
+		registry:  registry,
+		documents: map[string][]byte{},
+		options:   clangformat.NewOptions(),
+	}
+}
+
+// WithOptions sets the clangformat.Options whose ending policy applies to the formatted documents, and returns the updated Server
+//
+// WithOptions 设置其换行策略作用于格式化文档的 clangformat.Options 并返回更新后的 Server
+func (s *Server) WithOptions(options *clangformat.Options) *Server {
+	s.options = options
+	return s
+}
+
+// request is a JSON-RPC request, or a notification when ID is missing
+// request 是 JSON-RPC 请求，缺少 ID 时为通知
+type request struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result"`
+}
+
+type errorResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Error   *responseError  `json:"error"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Serve reads requests from the reader and writes responses to the writer until the exit notification
+// Returns error when the client exits without shutdown first, as the protocol asks for exit code 1 then
+// The end of input is treated as exit
+//
+// Serve 从 reader 读取请求并向 writer 写入响应，直到收到 exit 通知
+// 客户端未先发送 shutdown 就退出时返回错误，协议要求此时以退出码 1 结束
+// 输入结束视为 exit
+func (s *Server) Serve(reader io.Reader, writer io.Writer) error {
+	input := bufio.NewReader(reader)
+	for {
+		data, err := readMessage(input)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return erero.Wro(err)
+		}
+		var req request
+		if err := json.Unmarshal(data, &req); err != nil {
+			if err := writeMessage(writer, &errorResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &responseError{Code: codeParseError, Message: err.Error()}}); err != nil {
+				return erero.Wro(err)
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return erero.New("exit notification before shutdown")
+			}
+			return nil
+		}
+		result, failure := s.handle(&req)
+		if len(req.ID) == 0 {
+			if failure != nil {
+				zaplog.LOG.Debug("lsp-format", zap.String("method", req.Method), zap.String("error", failure.Message))
+			}
+			continue
+		}
+		var message any = &response{JSONRPC: "2.0", ID: req.ID, Result: result}
+		if failure != nil {
+			message = &errorResponse{JSONRPC: "2.0", ID: req.ID, Error: failure}
+		}
+		if err := writeMessage(writer, message); err != nil {
+			return erero.Wro(err)
+		}
+	}
+}
+
+// handle runs the method of the request and returns its result
+// handle 执行请求的方法并返回结果
+func (s *Server) handle(req *request) (any, *responseError) {
+	switch {
+	case req.Method == "initialize":
+		s.initialized = true
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":                1, // full content on each change // 每次变更发送完整内容
+				"documentFormattingProvider":      true,
+				"documentRangeFormattingProvider": true,
+				"documentOnTypeFormattingProvider": map[string]any{
+					"firstTriggerCharacter": "}",
+					"moreTriggerCharacter":  []string{";", "\n"},
+				},
+			},
+			"serverInfo": map[string]any{"name": "clang-format-batch"},
+		}, nil
+	case !s.initialized:
+		return nil, &responseError{Code: codeNotInitialized, Message: "server not initialized"}
+	case req.Method == "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case s.shutdown:
+		return nil, &responseError{Code: codeInvalidRequest, Message: "server is shutting down"}
+	}
+
+	var params documentParams
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+		}
+	}
+	switch req.Method {
+	case "initialized", "$/cancelRequest", "$/setTrace", "textDocument/didSave":
+		return nil, nil
+	case "textDocument/didOpen":
+		s.documents[params.TextDocument.URI] = []byte(params.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		// full sync, the last change holds the whole content
+		// 完整同步，最后一次变更包含全部内容
+		if count := len(params.ContentChanges); count > 0 {
+			s.documents[params.TextDocument.URI] = []byte(params.ContentChanges[count-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		delete(s.documents, params.TextDocument.URI)
+		return nil, nil
+	case "textDocument/formatting":
+		return s.format(params.TextDocument.URI, 0, 0)
+	case "textDocument/rangeFormatting":
+		first, last := params.Range.Start.Line+1, params.Range.End.Line+1
+		// a selection ending at the start of a line does not cover that line
+		// 结束于行首的选区不包含该行
+		if params.Range.End.Character == 0 && last > first {
+			last--
+		}
+		return s.format(params.TextDocument.URI, first, last)
+	case "textDocument/onTypeFormatting":
+		// after a newline the finished line is formatted along with the new one
+		// 换行后格式化刚完成的行以及新的一行
+		first, last := params.Position.Line+1, params.Position.Line+1
+		if params.Ch == "\n" && first > 1 {
+			first--
+		}
+		return s.format(params.TextDocument.URI, first, last)
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not supported: " + req.Method}
+}
+
+// documentParams holds the params of the document methods the Server handles
+// documentParams 保存 Server 所处理的文档方法的参数
+type documentParams struct {
+	TextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+	Range    textRange `json:"range"`
+	Position position  `json:"position"`
+	Ch       string    `json:"ch"`
+}
+
+// format returns the edits formatting the document, or only the lines first to last (1-based) when first is set
+// Formatters without LinesFormatter format the whole document, the ones without SourceFormatter fall back to clang-format
+//
+// format 返回格式化文档的编辑，设置 first 时只格式化第 first 到 last 行（从 1 开始）
+// 未实现 LinesFormatter 的格式化器格式化整个文档，未实现 SourceFormatter 的回退到 clang-format
+func (s *Server) format(uri string, first int, last int) (any, *responseError) {
+	path, err := uriPath(uri)
+	if err != nil {
+		return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	language, ok := s.registry.Lookup(filepath.Ext(path))
+	if !ok {
+		return []*textEdit{}, nil
+	}
+	source, ok := s.documents[uri]
+	if !ok {
+		if source, err = os.ReadFile(path); err != nil {
+			return nil, &responseError{Code: codeRequestFailed, Message: err.Error()}
+		}
+	}
+	style := language.NewStyle()
+
+	var output []byte
+	if formatter, ok := language.Formatter.(clangformat.LinesFormatter); ok && first > 0 {
+		output, err = formatter.DryRunLines(s.config, source, path, style, first, last)
+	} else {
+		output, err = language.DryRunSource(s.config, source, path, style)
+	}
+	if err != nil {
+		zaplog.LOG.Debug("lsp-format", zap.String("path", path), zap.Error(err))
+		return nil, &responseError{Code: codeRequestFailed, Message: err.Error()}
+	}
+	// the buffer keeps its line endings, BOM and final newline unless the policy asks otherwise
+	// 除非策略另有要求，否则缓冲区保持其换行符、BOM 和末尾换行
+	output = clangformat.ApplyEndings(source, output, s.options.EndingPolicy())
+	return textEdits(source, output), nil
+}
+
+// uriPath converts a file URI into a local path
+// uriPath 将 file URI 转换为本地路径
+func uriPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", erero.Wro(err)
+	}
+	if u.Scheme != "file" {
+		return "", erero.Errorf("unsupported URI %s, only file URIs are formatted", uri)
+	}
+	path := u.Path
+	// file:///C:/dir/a.cc has the path /C:/dir/a.cc on Windows
+	// 在 Windows 上 file:///C:/dir/a.cc 的路径为 /C:/dir/a.cc
+	if runtime.GOOS == "windows" && len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path), nil
+}
+
+// readMessage reads the content of the next message framed by a Content-Length header
+// readMessage 读取下一条以 Content-Length 头部分隔的消息内容
+func readMessage(reader *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length < 0 {
+				return nil, io.EOF
+			}
+			return nil, erero.Wro(err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, erero.Wro(err)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, erero.New("message without Content-Length header")
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, erero.Wro(err)
+	}
+	return data, nil
+}
+
+// writeMessage writes the message framed by a Content-Length header
+// writeMessage 写入以 Content-Length 头部分隔的消息
+func writeMessage(writer io.Writer, message any) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	if _, err := io.WriteString(writer, "Content-Length: "+strconv.Itoa(len(data))+"\r\n\r\n"); err != nil {
+		return erero.Wro(err)
+	}
+	if _, err := writer.Write(data); err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package lspformat_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/lspformat"
+	"github.com/go-xlan/clang-format/protoformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/rese"
+)
+
+// fakeSqueeze is a clang-format stand-in squeezing repeated spaces of stdin, recording its args one run per line
+//
+// fakeSqueeze 是替代 clang-format 的脚本，压缩标准输入中重复的空格并按每次运行一行记录其参数
+const fakeSqueeze = `#!/bin/sh
+echo $(printf '%s ' "$@") >> "$CLANG_FORMAT_ARGS"
+tr -s ' '
+`
+
+// session builds the client messages sent to the server, with request ids counting from 1
+// session 构建发送给服务的客户端消息，请求 id 从 1 开始计数
+type session struct {
+	input bytes.Buffer
+	id    int
+}
+
+func (s *session) send(method string, params any, request bool) {
+	message := map[string]any{"jsonrpc": "2.0", "method": method, "params": params}
+	if request {
+		s.id++
+		message["id"] = s.id
+	}
+	data := rese.V1(json.Marshal(message))
+	s.input.WriteString("Content-Length: " + strconv.Itoa(len(data)) + "\r\n\r\n")
+	s.input.Write(data)
+}
+
+type response struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code int `json:"code"`
+	} `json:"error"`
+}
+
+type textEdit struct {
+	Range struct {
+		Start struct{ Line, Character int }
+		End   struct{ Line, Character int }
+	}
+	NewText string
+}
+
+// readResponses parses the framed responses written by the server
+// readResponses 解析服务写出的带分隔头的响应
+func readResponses(t *testing.T, output []byte) []*response {
+	var responses []*response
+	reader := bufio.NewReader(bytes.NewReader(output))
+	for {
+		header, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return responses
+		}
+		require.NoError(t, err)
+		length := rese.V1(strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "Content-Length:"))))
+		rese.V1(reader.ReadString('\n'))
+		data := make([]byte, length)
+		rese.V1(io.ReadFull(reader, data))
+		var res response
+		must.Done(json.Unmarshal(data, &res))
+		responses = append(responses, &res)
+	}
+}
+
+// applyEdits applies the edits of an ASCII document
+// applyEdits 对 ASCII 文档应用编辑
+func applyEdits(t *testing.T, text string, result json.RawMessage) string {
+	var edits []*textEdit
+	must.Done(json.Unmarshal(result, &edits))
+	offset := func(line int, character int) int {
+		start := 0
+		for i := 0; i < line; i++ {
+			start += strings.IndexByte(text[start:], '\n') + 1
+		}
+		return start + character
+	}
+	for i := len(edits) - 1; i >= 0; i-- {
+		edit := edits[i]
+		start := offset(edit.Range.Start.Line, edit.Range.Start.Character)
+		end := offset(edit.Range.End.Line, edit.Range.End.Character)
+		require.LessOrEqual(t, start, end)
+		text = text[:start] + edit.NewText + text[end:]
+	}
+	return text
+}
+
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+func TestServerFormatting(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "lsp-format-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	// 原生后端不需要 clang-format
+	registry := clangformat.NewRegistry().Register(protoformat.NewFormatter().WithBackend(protoformat.BackendNative).NewLanguage())
+	server := lspformat.NewServer(osexec.NewExecConfig().WithPath(tempDIR), registry)
+
+	// 已打开的文档从编辑器缓冲区格式化，而不是磁盘上的内容
+	uri := fileURI(filepath.Join(tempDIR, "demo.proto"))
+	opened := "syntax = \"proto3\";\n\nmessage A{int32 a=1;}\n"
+	changed := "syntax = \"proto3\";\n\nmessage B{int32 b=2;}\n"
+	must.Done(os.WriteFile(filepath.Join(tempDIR, "demo.proto"), []byte("message C{}\n"), 0644))
+
+	var client session
+	client.send("initialize", map[string]any{"processId": nil, "rootUri": fileURI(tempDIR), "capabilities": map[string]any{}}, true)
+	client.send("initialized", map[string]any{}, false)
+	client.send("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": uri, "languageId": "proto", "version": 1, "text": opened}}, false)
+	client.send("textDocument/didChange", map[string]any{"textDocument": map[string]any{"uri": uri, "version": 2}, "contentChanges": []any{map[string]any{"text": changed}}}, false)
+	client.send("textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": uri}, "options": map[string]any{"tabSize": 8, "insertSpaces": false}}, true)
+	client.send("textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": fileURI(filepath.Join(tempDIR, "notes.txt"))}}, true)
+	client.send("shutdown", nil, true)
+	client.send("exit", nil, false)
+
+	var output bytes.Buffer
+	require.NoError(t, server.Serve(&client.input, &output))
+	responses := readResponses(t, output.Bytes())
+	require.Len(t, responses, 4)
+
+	// 初始化结果声明了三种格式化能力
+	var initialize struct {
+		Capabilities struct {
+			DocumentFormattingProvider       bool
+			DocumentRangeFormattingProvider  bool
+			DocumentOnTypeFormattingProvider struct{ FirstTriggerCharacter string }
+		}
+	}
+	must.Done(json.Unmarshal(responses[0].Result, &initialize))
+	require.True(t, initialize.Capabilities.DocumentFormattingProvider)
+	require.True(t, initialize.Capabilities.DocumentRangeFormattingProvider)
+	require.Equal(t, "}", initialize.Capabilities.DocumentOnTypeFormattingProvider.FirstTriggerCharacter)
+
+	// 编辑只替换变化的行，样式来自项目而非编辑器选项
+	require.Nil(t, responses[1].Error)
+	require.Equal(t, "syntax = \"proto3\";\n\nmessage B {\n  int32 b = 2;\n}\n", applyEdits(t, changed, responses[1].Result))
+	var edits []*textEdit
+	must.Done(json.Unmarshal(responses[1].Result, &edits))
+	require.Len(t, edits, 1)
+	require.Equal(t, 2, edits[0].Range.Start.Line)
+
+	// 未注册的扩展名没有编辑
+	require.Nil(t, responses[2].Error)
+	require.JSONEq(t, "[]", string(responses[2].Result))
+	require.JSONEq(t, "null", string(responses[3].Result))
+}
+
+func TestServerRangeFormatting(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake clang-format is a shell script")
+	}
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "lsp-format-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	binDIR := filepath.Join(tempDIR, "bin")
+	argsPath := filepath.Join(tempDIR, "args")
+	must.Done(os.Mkdir(binDIR, 0755))
+	must.Done(os.WriteFile(filepath.Join(binDIR, "clang-format"), []byte(fakeSqueeze), 0755))
+	t.Setenv("PATH", binDIR+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("CLANG_FORMAT_ARGS", argsPath)
+
+	// 未打开的文档从磁盘读取，缺少末尾换行的状态保持不变
+	path := filepath.Join(tempDIR, "demo.cc")
+	text := "int  a;\nint  b;\nint  c;"
+	must.Done(os.WriteFile(path, []byte(text), 0644))
+	uri := fileURI(path)
+
+	var client session
+	client.send("textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": uri}}, true)
+	client.send("initialize", map[string]any{"capabilities": map[string]any{}}, true)
+	client.send("textDocument/rangeFormatting", map[string]any{"textDocument": map[string]any{"uri": uri}, "range": map[string]any{"start": map[string]any{"line": 1, "character": 0}, "end": map[string]any{"line": 3, "character": 0}}}, true)
+	client.send("textDocument/onTypeFormatting", map[string]any{"textDocument": map[string]any{"uri": uri}, "position": map[string]any{"line": 2, "character": 0}, "ch": "\n"}, true)
+	client.send("textDocument/onTypeFormatting", map[string]any{"textDocument": map[string]any{"uri": uri}, "position": map[string]any{"line": 0, "character": 7}, "ch": ";"}, true)
+	client.send("textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": uri}}, true)
+	client.send("textDocument/hover", map[string]any{"textDocument": map[string]any{"uri": uri}}, true)
+	client.send("shutdown", nil, true)
+	client.send("exit", nil, false)
+
+	var output bytes.Buffer
+	require.NoError(t, server(tempDIR).Serve(&client.input, &output))
+	responses := readResponses(t, output.Bytes())
+	require.Len(t, responses, 8)
+
+	// 初始化之前的请求被拒绝
+	require.Equal(t, -32002, responses[0].Error.Code)
+
+	// 范围和输入时格式化只格式化对应的行
+	args := strings.Split(strings.TrimSpace(string(rese.V1(os.ReadFile(argsPath)))), "\n")
+	require.Len(t, args, 4)
+	require.Contains(t, args[0], "--lines 2:3")
+	require.Contains(t, args[1], "--lines 2:3")
+	require.Contains(t, args[2], "--lines 1:1")
+	require.NotContains(t, args[3], "--lines")
+	require.Contains(t, args[3], "--assume-filename "+path)
+	require.Equal(t, "int a;\nint b;\nint c;", applyEdits(t, text, responses[5].Result))
+
+	// 不支持的方法返回错误
+	require.Equal(t, -32601, responses[6].Error.Code)
+}
+
+func server(projectPath string) *lspformat.Server {
+	return lspformat.NewServer(osexec.NewExecConfig().WithPath(projectPath), clangformat.NewRegistry())
+}
+
+func TestServerExitWithoutShutdown(t *testing.T) {
+	var client session
+	client.send("initialize", map[string]any{"capabilities": map[string]any{}}, true)
+	client.send("exit", nil, false)
+
+	// 未先发送 shutdown 就退出时返回错误
+	var output bytes.Buffer
+	require.Error(t, server(os.TempDir()).Serve(&client.input, &output))
+	require.Len(t, readResponses(t, output.Bytes()), 1)
+}
@@ -0,0 +1,410 @@
+// Package mdformat: Clang-Format engine for fenced code blocks in Markdown documents
+// Extracts ``` and ~~~ fenced blocks whose info string names a clang-format language
+// Formats each block in memory through clangformat and splices the result back
+// Leaves prose and blocks of other languages untouched, with a check mode reporting unformatted blocks
+//
+// mdformat: Markdown 文档中围栏代码块的 Clang-Format 引擎
+// 提取信息字符串为 clang-format 语言的 ``` 和 ~~~ 围栏代码块
+// 通过 clangformat 在内存中格式化每个代码块并将结果拼接回去
+// 不修改正文和其他语言的代码块，并提供报告未格式化代码块的检查模式
+package mdformat
+
+import (
+	"bytes"
+	"os"
+	"strings"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/osexistpath/osmustexist"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// Languages maps fenced block info strings to the file extensions passed to clang-format
+// Add entries to format blocks of more info strings
+//
+// Languages 将围栏代码块的信息字符串映射到传给 clang-format 的文件扩展名
+// 添加条目即可格式化更多信息字符串的代码块
+var Languages = map[string]string{
+	"c":           ".c",
+	"h":           ".h",
+	"cpp":         ".cpp",
+	"c++":         ".cpp",
+	"cc":          ".cpp",
+	"cxx":         ".cpp",
+	"hpp":         ".hpp",
+	"cuda":        ".cu",
+	"objc":        ".m",
+	"objective-c": ".m",
+	"objectivec":  ".m",
+	"java":        ".java",
+	"js":          ".js",
+	"javascript":  ".js",
+	"ts":          ".ts",
+	"typescript":  ".ts",
+	"cs":          ".cs",
+	"csharp":      ".cs",
+	"proto":       ".proto",
+	"protobuf":    ".proto",
+	"textproto":   ".textproto",
+	"pbtxt":       ".textproto",
+}
+
+// Issue reports a fenced block that is not formatted
+//
+// Issue 报告一个未格式化的围栏代码块
+type Issue struct {
+	Path     string // Markdown file path // Markdown 文件路径
+	Line     int    // Line number of the opening fence, 1-based // 起始围栏的行号，从 1 开始
+	Language string // Info string language // 信息字符串中的语言
+}
+
+// NewStyle creates the Style used on fenced code blocks
+// Returns Google-based style with 2-space indentation, matching clangformat defaults
+//
+// NewStyle 创建用于围栏代码块的样式
+// 返回基于 Google 的 2 空格缩进样式，与 clangformat 默认值一致
+func NewStyle() *clangformat.Style {
+	return clangformat.NewStyle()
+}
+
+// Formatter formats the fenced code blocks of Markdown files with the clangformat.Options running clang-format and writing the files
+// The package-level functions use NewFormatter(), set the Options to format with the settings of a run
+//
+// Formatter 使用运行 clang-format 和写入文件的 clangformat.Options 格式化Markdown 文件的围栏代码块
+// 包级函数使用 NewFormatter()，设置 Options 即可使用一次运行的设置进行格式化
+type Formatter struct {
+	options *clangformat.Options
+}
+
+// NewFormatter creates a Formatter with clangformat.NewOptions()
+//
+// NewFormatter 创建使用 clangformat.NewOptions() 的 Formatter
+func NewFormatter() *Formatter {
+	return &Formatter{options: clangformat.NewOptions()}
+}
+
+// WithOptions sets the clangformat.Options and returns the updated Formatter
+//
+// WithOptions 设置 clangformat.Options 并返回更新后的 Formatter
+func (f *Formatter) WithOptions(options *clangformat.Options) *Formatter {
+	f.options = options
+	return f
+}
+
+// DryRun returns the Markdown content with formatted fenced blocks
+// The Markdown file is not modified
+//
+// DryRun 返回围栏代码块已格式化的 Markdown 内容
+// 不会修改 Markdown 文件
+func DryRun(config *osexec.ExecConfig, path string, style *clangformat.Style) (output []byte, err error) {
+	return NewFormatter().DryRun(config, path, style)
+}
+
+// DryRun works like the package-level DryRun, running clang-format through the options of the Formatter
+// DryRun 与包级 DryRun 相同，通过 Formatter 的 options 运行 clang-format
+func (f *Formatter) DryRun(config *osexec.ExecConfig, path string, style *clangformat.Style) (output []byte, err error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	output, _, err = f.formatSource(config, path, source, style)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return output, nil
+}
+
+// Format formats the fenced blocks in the Markdown file and writes the result back
+// Writes only when the content changes, atomically through clangformat.WriteFile
+//
+// Format 格式化 Markdown 文件中的围栏代码块并写回结果
+// 仅在内容变化时通过 clangformat.WriteFile 原子写入
+func Format(config *osexec.ExecConfig, path string, style *clangformat.Style) (output []byte, err error) {
+	return NewFormatter().Format(config, path, style)
+}
+
+// Format works like the package-level Format, running clang-format and writing the files through the options of the Formatter
+// Format 与包级 Format 相同，通过 Formatter 的 options 运行 clang-format 并写入文件
+func (f *Formatter) Format(config *osexec.ExecConfig, path string, style *clangformat.Style) (output []byte, err error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	output, _, err = f.formatSource(config, path, source, style)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if !bytes.Equal(source, output) {
+		if err := f.options.WriteFile(path, output); err != nil {
+			return nil, erero.Wro(err)
+		}
+	}
+	return nil, nil
+}
+
+// FormatSource formats the fenced blocks in the Markdown source and returns the new source
+// The path is used as the clang-format --assume-filename base
+//
+// FormatSource 格式化 Markdown 源码中的围栏代码块并返回新的源码
+// path 作为 clang-format --assume-filename 的基础
+func FormatSource(config *osexec.ExecConfig, path string, source []byte, style *clangformat.Style) ([]byte, error) {
+	return NewFormatter().FormatSource(config, path, source, style)
+}
+
+// FormatSource works like the package-level FormatSource, running clang-format through the options of the Formatter
+// FormatSource 与包级 FormatSource 相同，通过 Formatter 的 options 运行 clang-format
+func (f *Formatter) FormatSource(config *osexec.ExecConfig, path string, source []byte, style *clangformat.Style) ([]byte, error) {
+	output, _, err := f.formatSource(config, path, source, style)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return output, nil
+}
+
+// Check reports the fenced blocks in the Markdown file that are not formatted
+// The Markdown file is not modified
+//
+// Check 报告 Markdown 文件中未格式化的围栏代码块
+// 不会修改 Markdown 文件
+func Check(config *osexec.ExecConfig, path string, style *clangformat.Style) ([]*Issue, error) {
+	return NewFormatter().Check(config, path, style)
+}
+
+// Check works like the package-level Check, running clang-format through the options of the Formatter
+// Check 与包级 Check 相同，通过 Formatter 的 options 运行 clang-format
+func (f *Formatter) Check(config *osexec.ExecConfig, path string, style *clangformat.Style) ([]*Issue, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	_, issues, err := f.formatSource(config, path, source, style)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return issues, nil
+}
+
+// FormatProject formats fenced blocks of all .md files in the project
+//
+// FormatProject 格式化项目中所有 .md 文件的围栏代码块
+func FormatProject(config *osexec.ExecConfig, projectPath string, style *clangformat.Style) error {
+	return NewFormatter().FormatProject(config, projectPath, style)
+}
+
+// FormatProject works like the package-level FormatProject, running clang-format and writing the files through the options of the Formatter
+// FormatProject 与包级 FormatProject 相同，通过 Formatter 的 options 运行 clang-format 并写入文件
+func (f *Formatter) FormatProject(config *osexec.ExecConfig, projectPath string, style *clangformat.Style) error {
+	if err := utils.WalkFilesWithExt(projectPath, ".md", func(path string, info os.FileInfo) error {
+		zaplog.LOG.Debug("md-format", zap.String("path", path))
+		osmustexist.MustFile(path)
+
+		if _, err := f.Format(config, path, style); err != nil {
+			return erero.Wro(err)
+		}
+		return nil
+	}); err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
+
+// CheckProject reports unformatted fenced blocks of all .md files in the project
+//
+// CheckProject 报告项目中所有 .md 文件里未格式化的围栏代码块
+func CheckProject(config *osexec.ExecConfig, projectPath string, style *clangformat.Style) ([]*Issue, error) {
+	return NewFormatter().CheckProject(config, projectPath, style)
+}
+
+// CheckProject works like the package-level CheckProject, running clang-format through the options of the Formatter
+// CheckProject 与包级 CheckProject 相同，通过 Formatter 的 options 运行 clang-format
+func (f *Formatter) CheckProject(config *osexec.ExecConfig, projectPath string, style *clangformat.Style) ([]*Issue, error) {
+	var issues []*Issue
+	if err := utils.WalkFilesWithExt(projectPath, ".md", func(path string, info os.FileInfo) error {
+		zaplog.LOG.Debug("md-check", zap.String("path", path))
+		osmustexist.MustFile(path)
+
+		results, err := f.Check(config, path, style)
+		if err != nil {
+			return erero.Wro(err)
+		}
+		issues = append(issues, results...)
+		return nil
+	}); err != nil {
+		return nil, erero.Wro(err)
+	}
+	return issues, nil
+}
+
+// formatSource formats each recognized fenced block and collects the blocks that changed
+// formatSource 格式化每个可识别的围栏代码块并收集发生变化的代码块
+func (f *Formatter) formatSource(config *osexec.ExecConfig, path string, source []byte, style *clangformat.Style) ([]byte, []*Issue, error) {
+	lines := strings.SplitAfter(string(source), "\n")
+	// code is formatted with LF, rebuilt blocks get the CRLF endings back in CRLF documents
+	// 代码以 LF 格式化，CRLF 文档中重建的代码块恢复 CRLF 换行
+	newline := "\n"
+	if clangformat.DetectEndings(source).LineEnding == clangformat.LineEndingCRLF {
+		newline = "\r\n"
+	}
+	var issues []*Issue
+	var result strings.Builder
+	for _, block := range splitBlocks(lines) {
+		if block.fence == nil {
+			result.WriteString(strings.Join(block.lines, ""))
+			continue
+		}
+		extension, ok := Languages[block.fence.language]
+		code := block.code()
+		if !ok || strings.TrimSpace(code) == "" {
+			result.WriteString(strings.Join(block.lines, ""))
+			continue
+		}
+		output, err := f.options.DryRunSource(config, []byte(code), path+extension, style)
+		if err != nil {
+			return nil, nil, erero.Wro(err)
+		}
+		formatted := string(output)
+		if !strings.HasSuffix(formatted, "\n") {
+			formatted += "\n"
+		}
+		if formatted == code {
+			result.WriteString(strings.Join(block.lines, ""))
+			continue
+		}
+		issues = append(issues, &Issue{Path: path, Line: block.line, Language: block.fence.language})
+		result.WriteString(block.rebuild(formatted, newline))
+	}
+	return []byte(result.String()), issues, nil
+}
+
+// fence describes the opening fence of a code block
+// fence 描述代码块的起始围栏
+type fence struct {
+	indent   int    // Spaces before the fence // 围栏前的空格数
+	marker   string // Fence characters such as ``` or ~~~~ // 围栏字符，例如 ``` 或 ~~~~
+	language string // First word of the info string, lowercased // 信息字符串的第一个单词，小写
+}
+
+// block is either a run of prose lines or a fenced code block with its fences
+// block 是一段正文行，或者包含围栏的代码块
+type block struct {
+	fence *fence   // Nil on prose // 正文时为 nil
+	line  int      // Line number of the first line, 1-based // 第一行的行号，从 1 开始
+	lines []string // Lines with line endings, fences included // 包含行尾的行，包括围栏
+}
+
+// splitBlocks groups the lines into prose runs and fenced code blocks
+// Unclosed fences run to the end of the document, as CommonMark specifies, and are kept as prose
+//
+// splitBlocks 将行分组为正文段和围栏代码块
+// 按照 CommonMark 规范，未闭合的围栏延伸到文档末尾，这种情况作为正文保留
+func splitBlocks(lines []string) []*block {
+	var blocks []*block
+	var current = &block{line: 1}
+	for idx := 0; idx < len(lines); idx++ {
+		opening := parseFence(lines[idx])
+		if opening == nil {
+			current.lines = append(current.lines, lines[idx])
+			continue
+		}
+		closing := -1
+		for end := idx + 1; end < len(lines); end++ {
+			if isClosingFence(lines[end], opening) {
+				closing = end
+				break
+			}
+		}
+		if closing < 0 {
+			current.lines = append(current.lines, lines[idx:]...)
+			break
+		}
+		if len(current.lines) > 0 {
+			blocks = append(blocks, current)
+		}
+		blocks = append(blocks, &block{fence: opening, line: idx + 1, lines: lines[idx : closing+1]})
+		current = &block{line: closing + 2}
+		idx = closing
+	}
+	if len(current.lines) > 0 {
+		blocks = append(blocks, current)
+	}
+	return blocks
+}
+
+// parseFence returns the fence when the line opens a fenced code block
+// parseFence 当该行是围栏代码块的起始行时返回围栏
+func parseFence(line string) *fence {
+	content := strings.TrimRight(line, "\r\n")
+	indent := len(content) - len(strings.TrimLeft(content, " "))
+	if indent > 3 {
+		return nil
+	}
+	content = content[indent:]
+	var marker string
+	for _, char := range []string{"`", "~"} {
+		count := len(content) - len(strings.TrimLeft(content, char))
+		if count >= 3 {
+			marker = content[:count]
+		}
+	}
+	if marker == "" {
+		return nil
+	}
+	info := strings.TrimSpace(content[len(marker):])
+	if marker[0] == '`' && strings.Contains(info, "`") {
+		return nil
+	}
+	var language string
+	if fields := strings.Fields(info); len(fields) > 0 {
+		language = strings.ToLower(strings.Trim(fields[0], "{}."))
+	}
+	return &fence{indent: indent, marker: marker, language: language}
+}
+
+// isClosingFence reports whether the line closes the fenced block opened by the fence
+// isClosingFence 判断该行是否闭合由该围栏开启的代码块
+func isClosingFence(line string, opening *fence) bool {
+	content := strings.TrimSpace(line)
+	if len(line)-len(strings.TrimLeft(line, " ")) > 3 {
+		return false
+	}
+	return strings.HasPrefix(content, opening.marker) && strings.Trim(content, opening.marker[:1]) == ""
+}
+
+// code returns the block content without fences and fence indentation
+// code 返回去除围栏和围栏缩进后的代码块内容
+func (b *block) code() string {
+	var code strings.Builder
+	for _, line := range b.lines[1 : len(b.lines)-1] {
+		code.WriteString(trimIndent(strings.ReplaceAll(line, "\r\n", "\n"), b.fence.indent))
+	}
+	return code.String()
+}
+
+// rebuild returns the block with the formatted content between the original fences, its lines end with newline
+// rebuild 返回在原有围栏之间放入格式化内容后的代码块，各行以 newline 结尾
+func (b *block) rebuild(formatted string, newline string) string {
+	var result strings.Builder
+	result.WriteString(b.lines[0])
+	prefix := strings.Repeat(" ", b.fence.indent)
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(formatted, "\n"), "\n") {
+		if strings.TrimSpace(line) != "" {
+			result.WriteString(prefix)
+		}
+		result.WriteString(strings.TrimSuffix(line, "\n") + newline)
+	}
+	result.WriteString(b.lines[len(b.lines)-1])
+	return result.String()
+}
+
+// trimIndent removes up to width leading spaces from the line
+// trimIndent 从行首移除最多 width 个空格
+func trimIndent(line string, width int) string {
+	for idx := 0; idx < width && strings.HasPrefix(line, " "); idx++ {
+		line = line[1:]
+	}
+	return line
+}
@@ -0,0 +1,70 @@
+package mdformat_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/mdformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/rese"
+)
+
+func TestFormatSourceWithoutBlocks(t *testing.T) {
+	// 没有可识别语言的代码块时不会调用 clang-format，内容保持不变
+	const source = "# Title\n\nSome prose.\n\n```go\nfunc  main(){}\n```\n\n```\nplain  text\n```\n\n~~~cpp\nunclosed fence\n"
+	output, err := mdformat.FormatSource(osexec.NewExecConfig(), "README.md", []byte(source), mdformat.NewStyle())
+	require.NoError(t, err)
+	require.Equal(t, source, string(output))
+}
+
+func TestDryRun(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "md-format-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	// 创建包含格式不规范的 proto 和 cpp 代码块的 Markdown 文件
+	mdFile := filepath.Join(tempDIR, "README.md")
+	const originalContent = "# Demo\n\nProse  stays   as is.\n\n```proto\nmessage User{\nint32    id=1;\n}\n```\n\n- item\n\n  ```cpp\n  int main(){return 0;}\n  ```\n"
+	must.Done(os.WriteFile(mdFile, []byte(originalContent), 0644))
+
+	execConfig := osexec.NewExecConfig().WithDebug()
+	output, err := mdformat.DryRun(execConfig, mdFile, mdformat.NewStyle())
+	require.NoError(t, err)
+	t.Log(string(output))
+
+	// 代码块被格式化，正文和列表缩进保持不变
+	const expectedResult = "# Demo\n\nProse  stays   as is.\n\n```proto\nmessage User {\n  int32 id = 1;\n}\n```\n\n- item\n\n  ```cpp\n  int main() { return 0; }\n  ```\n"
+	require.Equal(t, expectedResult, string(output))
+
+	// 检查模式按行报告未格式化的代码块
+	issues, err := mdformat.Check(execConfig, mdFile, mdformat.NewStyle())
+	require.NoError(t, err)
+	require.Len(t, issues, 2)
+	require.Equal(t, 5, issues[0].Line)
+	require.Equal(t, "proto", issues[0].Language)
+	require.Equal(t, 13, issues[1].Line)
+	require.Equal(t, "cpp", issues[1].Language)
+
+	// DryRun 不应该修改文件
+	require.Equal(t, originalContent, string(rese.V1(os.ReadFile(mdFile))))
+}
+
+func TestFormatSourceCRLF(t *testing.T) {
+	// 使用压缩连续空格的假执行器，无需 clang-format
+	fake := clangformat.NewFakeExecutor().WithScript(func(call *clangformat.Call) (*clangformat.Execution, error) {
+		return &clangformat.Execution{Stdout: bytes.ReplaceAll(call.Stdin, []byte("  "), []byte(" "))}, nil
+	})
+	formatter := mdformat.NewFormatter().WithOptions(clangformat.NewOptions().WithExecutor(fake))
+
+	// CRLF 文档中重建的代码块保持 CRLF 换行，不会出现混用的换行符
+	const source = "# Demo\r\n\r\n```c\r\nint  x;\r\nint  y;\r\n```\r\n\r\nProse.\r\n"
+	output, err := formatter.FormatSource(osexec.NewExecConfig(), "README.md", []byte(source), mdformat.NewStyle())
+	require.NoError(t, err)
+	require.Equal(t, "# Demo\r\n\r\n```c\r\nint x;\r\nint y;\r\n```\r\n\r\nProse.\r\n", string(output))
+	require.Equal(t, "int  x;\nint  y;\n", string(fake.Calls()[0].Stdin))
+}
@@ -0,0 +1,207 @@
+package protoformat
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/go-xlan/clang-format/internal/utils"
+	"github.com/yyle88/erero"
+	"gopkg.in/yaml.v3"
+)
+
+// BufModule is a buf module root with the DIRs excluded from it
+// Paths are absolute
+//
+// BufModule 是 buf 模块根目录及其排除的目录
+// 路径均为绝对路径
+type BufModule struct {
+	Root     string   // Module root DIR // 模块根目录
+	Excludes []string // Excluded DIRs inside the root // 根目录中被排除的目录
+}
+
+// bufConfig is the subset of buf.yaml and buf.work.yaml read here
+// Covers buf.yaml v1 build excludes, buf.yaml v2 modules and buf.work.yaml v1 directories
+//
+// bufConfig 是此处读取的 buf.yaml 和 buf.work.yaml 子集
+// 涵盖 buf.yaml v1 的 build excludes、buf.yaml v2 的 modules 以及 buf.work.yaml v1 的 directories
+type bufConfig struct {
+	Version string `yaml:"version"`
+	Build   struct {
+		Excludes []string `yaml:"excludes"`
+	} `yaml:"build"`
+	Modules []struct {
+		Path     string   `yaml:"path"`
+		Excludes []string `yaml:"excludes"`
+	} `yaml:"modules"`
+	Directories []string `yaml:"directories"`
+}
+
+// LoadBufModules finds the nearest buf.work.yaml or buf.yaml at or above the path and returns its modules
+// Returns nil when the path is not inside a buf workspace or module
+//
+// LoadBufModules 在该路径及其上级目录中查找最近的 buf.work.yaml 或 buf.yaml 并返回其模块
+// 路径不在 buf 工作区或模块中时返回 nil
+func LoadBufModules(path string) ([]*BufModule, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if config, err := readBufConfig(filepath.Join(dir, "buf.work.yaml")); err != nil {
+			return nil, erero.Wro(err)
+		} else if config != nil {
+			var modules []*BufModule
+			for _, directory := range config.Directories {
+				module, err := loadBufModule(filepath.Join(dir, directory))
+				if err != nil {
+					return nil, erero.Wro(err)
+				}
+				modules = append(modules, module)
+			}
+			return modules, nil
+		}
+		if config, err := readBufConfig(filepath.Join(dir, "buf.yaml")); err != nil {
+			return nil, erero.Wro(err)
+		} else if config != nil {
+			return bufModules(dir, config), nil
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return nil, nil
+		}
+	}
+}
+
+// loadBufModule returns the module of a buf.work.yaml directory, with excludes of its own buf.yaml
+// loadBufModule 返回 buf.work.yaml 中某个目录的模块，包含其自身 buf.yaml 中的排除项
+func loadBufModule(root string) (*BufModule, error) {
+	config, err := readBufConfig(filepath.Join(root, "buf.yaml"))
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	module := &BufModule{Root: root}
+	if config != nil {
+		module.Excludes = joinPaths(root, config.Build.Excludes)
+	}
+	return module, nil
+}
+
+// bufModules returns the modules declared by a buf.yaml in the DIR
+// v2 paths and excludes are relative to the DIR, v1 declares the DIR itself as the module
+//
+// bufModules 返回目录中 buf.yaml 声明的模块
+// v2 的路径和排除项相对于该目录，v1 将该目录本身声明为模块
+func bufModules(dir string, config *bufConfig) []*BufModule {
+	if config.Version == "v2" {
+		if len(config.Modules) == 0 {
+			return []*BufModule{{Root: dir}}
+		}
+		var modules []*BufModule
+		for _, module := range config.Modules {
+			modules = append(modules, &BufModule{
+				Root:     filepath.Join(dir, module.Path),
+				Excludes: joinPaths(dir, module.Excludes),
+			})
+		}
+		return modules
+	}
+	return []*BufModule{{Root: dir, Excludes: joinPaths(dir, config.Build.Excludes)}}
+}
+
+// readBufConfig parses the buf config file, returns nil when the file does not exist
+// readBufConfig 解析 buf 配置文件，文件不存在时返回 nil
+func readBufConfig(path string) (*bufConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, erero.Wro(err)
+	}
+	config := &bufConfig{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, erero.WithMessage(err, path)
+	}
+	return config, nil
+}
+
+// joinPaths joins each relative path with the DIR
+// joinPaths 将每个相对路径与目录拼接
+func joinPaths(dir string, paths []string) []string {
+	var results []string
+	for _, path := range paths {
+		results = append(results, filepath.Join(dir, path))
+	}
+	return results
+}
+
+// excluded reports whether the path is one of the module excludes or inside one
+// excluded 判断路径是否为模块排除项之一或位于其中
+func (m *BufModule) excluded(path string) bool {
+	for _, exclude := range m.Excludes {
+		if path == exclude || utils.IsSubPath(exclude, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkRoot is a DIR to walk with the module whose excludes apply, module is nil outside buf modules
+// walkRoot 是需要遍历的目录及适用其排除项的模块，不在 buf 模块中时 module 为 nil
+type walkRoot struct {
+	dir    string
+	module *BufModule
+}
+
+// walkRoots returns the DIRs to walk inside projectPath in module order
+// projectPath is walked as a whole when it is outside any buf module
+//
+// walkRoots 按模块顺序返回 projectPath 中需要遍历的目录
+// projectPath 不在任何 buf 模块中时将整体遍历
+func walkRoots(projectPath string) ([]*walkRoot, error) {
+	projectPath, err := filepath.Abs(projectPath)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	modules, err := LoadBufModules(projectPath)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if modules == nil {
+		return []*walkRoot{{dir: projectPath}}, nil
+	}
+	var roots []*walkRoot
+	for _, module := range modules {
+		switch {
+		case module.Root == projectPath || utils.IsSubPath(module.Root, projectPath):
+			roots = append(roots, &walkRoot{dir: projectPath, module: module})
+		case utils.IsSubPath(projectPath, module.Root):
+			roots = append(roots, &walkRoot{dir: module.Root, module: module})
+		}
+	}
+	return roots, nil
+}
+
+// InProject reports whether WalkProject visits the path when walking projectPath
+// Paths outside the buf modules of projectPath, or inside their excludes, are not visited
+//
+// InProject 判断遍历 projectPath 时 WalkProject 是否会访问该路径
+// 位于 projectPath 的 buf 模块之外或其排除项之中的路径不会被访问
+func InProject(projectPath string, path string) (bool, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false, erero.Wro(err)
+	}
+	roots, err := walkRoots(projectPath)
+	if err != nil {
+		return false, erero.Wro(err)
+	}
+	for _, root := range roots {
+		if path != root.dir && !utils.IsSubPath(root.dir, path) {
+			continue
+		}
+		if root.module == nil || !root.module.excluded(path) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,87 @@
+package protoformat_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-xlan/clang-format/protoformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+// writeFiles creates the files with their content under the DIR
+// writeFiles 在目录下创建文件及其内容
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		must.Done(os.MkdirAll(filepath.Dir(path), 0755))
+		must.Done(os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+// walkedFiles returns the walked .proto files relative to the root
+// walkedFiles 返回遍历到的 .proto 文件，路径相对于根目录
+func walkedFiles(t *testing.T, root string, projectPath string) []string {
+	t.Helper()
+	var paths []string
+	must.Done(protoformat.WalkProject(projectPath, ".proto", func(path string) error {
+		paths = append(paths, rese.V1(filepath.Rel(root, path)))
+		return nil
+	}))
+	return paths
+}
+
+func TestWalkProjectBufWorkspace(t *testing.T) {
+	tempDIR := rese.V1(os.MkdirTemp("", "proto-buf-work-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	writeFiles(t, tempDIR, map[string]string{
+		"buf.work.yaml":                  "version: v1\ndirectories:\n  - proto\n  - api\n",
+		"proto/buf.yaml":                 "version: v1\nbuild:\n  excludes:\n    - vendor\n",
+		"proto/user/v1/user.proto":       "",
+		"proto/vendor/google/api.proto":  "",
+		"api/service.proto":              "",
+		"third_party/googleapis/a.proto": "",
+	})
+
+	require.Equal(t, []string{"proto/user/v1/user.proto", "api/service.proto"}, walkedFiles(t, tempDIR, tempDIR))
+
+	// walking inside a module keeps its excludes
+	// 在模块内部遍历时保留其排除项
+	require.Equal(t, []string{"proto/user/v1/user.proto"}, walkedFiles(t, tempDIR, filepath.Join(tempDIR, "proto")))
+}
+
+func TestWalkProjectBufV2(t *testing.T) {
+	tempDIR := rese.V1(os.MkdirTemp("", "proto-buf-v2-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	writeFiles(t, tempDIR, map[string]string{
+		"buf.yaml":                  "version: v2\nmodules:\n  - path: proto\n    excludes:\n      - proto/third_party\n",
+		"proto/a.proto":             "",
+		"proto/third_party/b.proto": "",
+		"vendor/googleapis/c.proto": "",
+	})
+
+	require.Equal(t, []string{"proto/a.proto"}, walkedFiles(t, tempDIR, tempDIR))
+
+	modules := rese.V1(protoformat.LoadBufModules(filepath.Join(tempDIR, "proto")))
+	require.Len(t, modules, 1)
+	require.Equal(t, filepath.Join(tempDIR, "proto"), modules[0].Root)
+	require.Equal(t, []string{filepath.Join(tempDIR, "proto/third_party")}, modules[0].Excludes)
+}
+
+func TestWalkProjectWithoutBuf(t *testing.T) {
+	tempDIR := rese.V1(os.MkdirTemp("", "proto-buf-none-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	writeFiles(t, tempDIR, map[string]string{
+		"a.proto":        "",
+		"vendor/b.proto": "",
+	})
+
+	require.Equal(t, []string{"a.proto", "vendor/b.proto"}, walkedFiles(t, tempDIR, tempDIR))
+	require.Nil(t, rese.V1(protoformat.LoadBufModules(tempDIR)))
+}
@@ -10,16 +10,8 @@
 package protoformat
 
 import (
-	"os"
-
 	"github.com/go-xlan/clang-format/clangformat"
-	"github.com/go-xlan/clang-format/internal/utils"
-	"github.com/yyle88/erero"
-	"github.com/yyle88/eroticgo"
 	"github.com/yyle88/osexec"
-	"github.com/yyle88/osexistpath/osmustexist"
-	"github.com/yyle88/zaplog"
-	"go.uber.org/zap"
 )
 
 // NewStyle creates a Protocol Buffers optimized Style configuration
@@ -41,50 +33,49 @@ func NewStyle() *clangformat.Style {
 // DryRun performs a preview formatting operation on a Protocol Buffer file
 // Returns formatted content without modifying the original file
 // Wraps clangformat.DryRun with proto-specific context
+// Uses the clang-format backend, see BackendNative.DryRun for the pure Go one
 //
 // DryRun 对 Protocol Buffer 文件执行预览格式化操作
 // 返回格式化内容而不修改原始文件
 // 在 proto 特定上下文中包装 clangformat.DryRun
+// 使用 clang-format 后端，纯 Go 后端参见 BackendNative.DryRun
 func DryRun(config *osexec.ExecConfig, protoPath string, style *clangformat.Style) (output []byte, err error) {
-	return clangformat.DryRun(config, protoPath, style)
+	return BackendClangFormat.DryRun(config, protoPath, style)
 }
 
 // Format applies formatting changes to a Protocol Buffer file
 // Modifies the target .proto file in-place with the specified style
 // Wraps clangformat.Format with proto-specific context
+// Uses the clang-format backend, see BackendNative.Format for the pure Go one
 //
 // Format 直接对 Protocol Buffer 文件应用格式化更改
 // 使用指定样式就地修改目标 .proto 文件
 // 在 proto 特定上下文中包装 clangformat.Format
+// 使用 clang-format 后端，纯 Go 后端参见 BackendNative.Format
 func Format(config *osexec.ExecConfig, protoPath string, style *clangformat.Style) (output []byte, err error) {
-	return clangformat.Format(config, protoPath, style)
+	return BackendClangFormat.Format(config, protoPath, style)
 }
 
 // FormatProject performs batch formatting operation on all .proto files in a project
 // Discovers and formats all Protocol Buffer files within the specified path
 // Provides detailed logging and validation with success feedback upon completion
 // Uses intelligent file traversal to handle complex project structures
+// Uses the clang-format backend, see BackendNative.FormatProject for the pure Go one
 //
 // FormatProject 对项目中的所有 .proto 文件执行批量格式化操作
 // 递归发现并格式化指定路径内的所有 Protocol Buffer 文件
 // 提供详细日志和验证，完成时给出成功反馈
 // 使用智能文件遍历处理复杂的项目结构
+// 使用 clang-format 后端，纯 Go 后端参见 BackendNative.FormatProject
 func FormatProject(config *osexec.ExecConfig, projectPath string, style *clangformat.Style) error {
-	if err := utils.WalkFilesWithExt(projectPath, ".proto", func(path string, info os.FileInfo) error {
-		zaplog.LOG.Debug("proto-format", zap.String("path", path))
-		osmustexist.MustFile(path)
+	return BackendClangFormat.FormatProject(config, projectPath, style)
+}
 
-		output, err := Format(config, path, style)
-		if err != nil {
-			return erero.Wro(err)
-		}
-		if len(output) > 0 {
-			zaplog.LOG.Debug("proto-format", zap.String("path", path), zap.ByteString("output", output))
-		}
-		return nil
-	}); err != nil {
-		return erero.Wro(err)
-	}
-	eroticgo.GREEN.ShowMessage("SUCCESS")
-	return nil
+// NewLanguage creates the Proto language bound to this package
+// Register it on a clangformat.Registry to route .proto files through protoformat
+//
+// NewLanguage 创建绑定到本包的 Proto 语言
+// 将其注册到 clangformat.Registry 以便 .proto 文件经由 protoformat 处理
+func NewLanguage() *clangformat.Language {
+	return NewFormatter().NewLanguage()
 }
@@ -0,0 +1,273 @@
+package protoformat
+
+import (
+	"os"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/eroticgo"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/osexistpath/osmustexist"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// Backend selects the engine that formats .proto files
+//
+// Backend 选择格式化 .proto 文件的引擎
+type Backend string
+
+const (
+	BackendClangFormat Backend = "clang-format" // Runs the clang-format binary // 运行 clang-format 程序
+	BackendNative      Backend = "native"       // Pure Go formatter, no clang-format needed // 纯 Go 格式化器，无需 clang-format
+)
+
+// ParseBackend converts the backend name into a Backend
+// Returns error on unknown names
+//
+// ParseBackend 将后端名称转换为 Backend
+// 名称未知时返回错误
+func ParseBackend(name string) (Backend, error) {
+	switch backend := Backend(name); backend {
+	case BackendClangFormat, BackendNative:
+		return backend, nil
+	default:
+		return "", erero.Errorf("unknown proto backend %s, expected %s or %s", name, BackendClangFormat, BackendNative)
+	}
+}
+
+// DryRun previews the formatting of a Protocol Buffer file with this backend, the file is not modified
+//
+// DryRun 使用该后端预览 Protocol Buffer 文件的格式化结果，不修改文件
+func (b Backend) DryRun(config *osexec.ExecConfig, protoPath string, style *clangformat.Style) (output []byte, err error) {
+	return NewFormatter().WithBackend(b).DryRun(config, protoPath, style)
+}
+
+// Format formats a Protocol Buffer file in-place with this backend
+//
+// Format 使用该后端就地格式化 Protocol Buffer 文件
+func (b Backend) Format(config *osexec.ExecConfig, protoPath string, style *clangformat.Style) (output []byte, err error) {
+	return NewFormatter().WithBackend(b).Format(config, protoPath, style)
+}
+
+// FormatProject formats all .proto files in the project with this backend
+//
+// FormatProject 使用该后端格式化项目中的所有 .proto 文件
+func (b Backend) FormatProject(config *osexec.ExecConfig, projectPath string, style *clangformat.Style) error {
+	return NewFormatter().WithBackend(b).FormatProject(config, projectPath, ".proto", style)
+}
+
+// Formatter formats Protocol Buffer files with the selected backend
+// Implements clangformat.Formatter so it can be registered as the Proto language formatter
+// The native backend honors IndentWidth and AlignConsecutiveAssignments of the style, and does not wrap long lines
+//
+// Formatter 使用选定的后端格式化 Protocol Buffer 文件
+// 实现 clangformat.Formatter，可注册为 Proto 语言的格式化器
+// 原生后端遵循样式中的 IndentWidth 和 AlignConsecutiveAssignments，不会折行
+type Formatter struct {
+	backend Backend
+	verify  bool
+	imports *ImportPolicy
+	layout  *LayoutStyle
+	options *clangformat.Options
+}
+
+// NewFormatter creates a Formatter using the clang-format backend
+//
+// NewFormatter 创建使用 clang-format 后端的 Formatter
+func NewFormatter() *Formatter {
+	return &Formatter{backend: BackendClangFormat, options: clangformat.NewOptions()}
+}
+
+// WithOptions sets the clangformat.Options running clang-format and writing the files, and returns the updated Formatter
+//
+// WithOptions 设置运行 clang-format 和写入文件的 clangformat.Options 并返回更新后的 Formatter
+func (f *Formatter) WithOptions(options *clangformat.Options) *Formatter {
+	f.options = options
+	return f
+}
+
+// WithBackend sets the backend and returns the updated Formatter
+//
+// WithBackend 设置后端并返回更新后的 Formatter
+func (f *Formatter) WithBackend(backend Backend) *Formatter {
+	f.backend = backend
+	return f
+}
+
+// WithVerify enables the semantic equivalence guard and returns the updated Formatter
+// Formatted content is compared token by token with the original, and nothing is written on mismatch
+//
+// WithVerify 启用语义等价保护并返回更新后的 Formatter
+// 格式化内容会与原始内容逐个词法单元比较，不一致时不会写入任何内容
+func (f *Formatter) WithVerify(verify bool) *Formatter {
+	f.verify = verify
+	return f
+}
+
+// WithImportPolicy enables the import-organizing pass with the policy and returns the updated Formatter
+// Imports are sorted and grouped before the backend formats the content, nil disables the pass
+// The equivalence guard checks the backend output against the content with sorted imports
+//
+// WithImportPolicy 使用该策略启用导入整理步骤并返回更新后的 Formatter
+// 导入在后端格式化内容之前排序和分组，nil 表示禁用该步骤
+// 等价保护将后端输出与导入排序后的内容进行比较
+func (f *Formatter) WithImportPolicy(policy *ImportPolicy) *Formatter {
+	f.imports = policy
+	return f
+}
+
+// WithLayout enables the proto layout rules and returns the updated Formatter
+// The rules run on the backend output, nil disables them
+//
+// WithLayout 启用 proto 布局规则并返回更新后的 Formatter
+// 规则在后端输出上运行，nil 表示禁用
+func (f *Formatter) WithLayout(style *LayoutStyle) *Formatter {
+	f.layout = style
+	return f
+}
+
+// DryRun returns the formatted content of the .proto file without modifying it
+//
+// DryRun 返回 .proto 文件格式化后的内容，不修改文件
+func (f *Formatter) DryRun(config *osexec.ExecConfig, protoPath string, style *clangformat.Style) (output []byte, err error) {
+	if f.backend == BackendClangFormat && !f.verify && f.imports == nil && f.layout == nil {
+		return f.options.DryRun(config, protoPath, style)
+	}
+	source, err := os.ReadFile(protoPath)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return f.DryRunSource(config, source, protoPath, style)
+}
+
+// Format formats the .proto file in place
+// With the native backend, the guard, the import pass or the layout rules enabled, the result is written only when the content changes, through the WriteFile of the options
+//
+// Format 就地格式化 .proto 文件
+// 使用原生后端、启用保护、导入整理或布局规则时，仅在内容变化时通过 options 的 WriteFile 写入结果
+func (f *Formatter) Format(config *osexec.ExecConfig, protoPath string, style *clangformat.Style) (output []byte, err error) {
+	if f.backend == BackendClangFormat && !f.verify && f.imports == nil && f.layout == nil {
+		return f.options.Format(config, protoPath, style)
+	}
+	source, err := os.ReadFile(protoPath)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	output, err = f.DryRunSource(config, source, protoPath, style)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	// WriteFile applies the ending policy and skips the write when the content stays the same
+	// WriteFile 应用换行策略，内容不变时跳过写入
+	if err := f.options.WriteFile(protoPath, output); err != nil {
+		return nil, erero.Wro(err)
+	}
+	return nil, nil
+}
+
+// DryRunSource formats in-memory .proto content, protoPath tells clang-format where to search .clang-format files
+// Returns *Divergence when the guard is enabled and the tokens changed
+//
+// DryRunSource 格式化内存中的 .proto 内容，protoPath 告诉 clang-format 查找 .clang-format 文件的位置
+// 启用保护且词法单元发生变化时返回 *Divergence
+func (f *Formatter) DryRunSource(config *osexec.ExecConfig, source []byte, protoPath string, style *clangformat.Style) (output []byte, err error) {
+	if f.imports != nil {
+		var skip string
+		if source, skip, err = sortImports(source, f.imports); err != nil {
+			return nil, erero.Wro(err)
+		}
+		if skip != "" {
+			zaplog.LOG.Warn("proto-format", zap.String("path", protoPath), zap.String("skip", skip))
+		}
+	}
+	if f.backend == BackendNative {
+		output, err = formatNative(source, style)
+	} else {
+		output, err = f.options.DryRunSource(config, source, protoPath, style)
+	}
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	if f.layout != nil {
+		if output, err = ApplyLayout(output, f.layout); err != nil {
+			return nil, erero.Wro(err)
+		}
+	}
+	if f.verify {
+		if err := Verify(protoPath, source, output); err != nil {
+			return nil, err
+		}
+	}
+	return output, nil
+}
+
+// FormatProject formats the files with the extension in the project
+// Logs each file and shows SUCCESS upon completion
+//
+// FormatProject 格式化项目中带有该扩展名的文件
+// 记录每个文件的日志，完成时显示 SUCCESS
+func (f *Formatter) FormatProject(config *osexec.ExecConfig, projectPath string, extension string, style *clangformat.Style) error {
+	if err := WalkProject(projectPath, extension, func(path string) error {
+		zaplog.LOG.Debug("proto-format", zap.String("path", path))
+
+		output, err := f.Format(config, path, style)
+		if err != nil {
+			return erero.Wro(err)
+		}
+		if len(output) > 0 {
+			zaplog.LOG.Debug("proto-format", zap.String("path", path), zap.ByteString("output", output))
+		}
+		return nil
+	}); err != nil {
+		return erero.Wro(err)
+	}
+	eroticgo.GREEN.ShowMessage("SUCCESS")
+	return nil
+}
+
+// NewLanguage creates the Proto language bound to this Formatter
+//
+// NewLanguage 创建绑定到该 Formatter 的 Proto 语言
+func (f *Formatter) NewLanguage() *clangformat.Language {
+	return &clangformat.Language{
+		Name:       "Proto",
+		Extensions: []string{".proto", ".protodevel"},
+		NewStyle:   NewStyle,
+		Formatter:  f,
+	}
+}
+
+// InProject reports whether FormatProject visits the path, implementing clangformat.ProjectFilter
+//
+// InProject 判断 FormatProject 是否会访问该路径，实现 clangformat.ProjectFilter
+func (f *Formatter) InProject(projectPath string, path string) (bool, error) {
+	return InProject(projectPath, path)
+}
+
+// WalkProject calls run on each file with the extension in the project
+// Inside a buf workspace or module, only module sources are visited and module excludes are skipped
+// Shared by FormatProject and LintProject so both visit the same files
+//
+// WalkProject 对项目中每个带有该扩展名的文件调用 run
+// 在 buf 工作区或模块中时，只访问模块源码并跳过模块的排除项
+// 由 FormatProject 和 LintProject 共用，使两者访问相同的文件
+func WalkProject(projectPath string, extension string, run func(path string) error) error {
+	roots, err := walkRoots(projectPath)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	for _, root := range roots {
+		if err := utils.WalkFilesWithExt(root.dir, extension, func(path string, info os.FileInfo) error {
+			if root.module != nil && root.module.excluded(path) {
+				return nil
+			}
+			osmustexist.MustFile(path)
+			return run(path)
+		}); err != nil {
+			return erero.Wro(err)
+		}
+	}
+	return nil
+}
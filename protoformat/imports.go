@@ -0,0 +1,311 @@
+package protoformat
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/go-xlan/clang-format/internal/protosyntax"
+	"github.com/yyle88/erero"
+)
+
+// ImportGroup names a group of import statements
+//
+// ImportGroup 表示一组 import 语句的名称
+type ImportGroup string
+
+const (
+	ImportGroupWellKnown ImportGroup = "well-known" // Imports of google/protobuf/* // google/protobuf/* 的导入
+	ImportGroupPlain     ImportGroup = "plain"      // Imports without modifier // 不带修饰符的导入
+	ImportGroupPublic    ImportGroup = "public"     // import public statements // import public 语句
+	ImportGroupWeak      ImportGroup = "weak"       // import weak statements // import weak 语句
+)
+
+// ImportPolicy controls how SortImports organizes import statements
+// Groups lists the group order, groups left out fold into the plain group
+// Each group is sorted by path and separated from the next by one blank line
+//
+// ImportPolicy 控制 SortImports 组织 import 语句的方式
+// Groups 列出分组顺序，未列出的分组并入 plain 分组
+// 每个分组按路径排序，分组之间以一个空行分隔
+type ImportPolicy struct {
+	Groups           []ImportGroup // Group order // 分组顺序
+	RemoveDuplicates bool          // Whether to drop repeated imports of the same path // 是否删除相同路径的重复导入
+}
+
+// NewImportPolicy creates the default ImportPolicy
+// Orders well-known imports first, then plain, public and weak imports, and removes duplicates
+//
+// NewImportPolicy 创建默认的 ImportPolicy
+// 依次排列 well-known、plain、public 和 weak 导入，并删除重复项
+func NewImportPolicy() *ImportPolicy {
+	return &ImportPolicy{
+		Groups:           []ImportGroup{ImportGroupWellKnown, ImportGroupPlain, ImportGroupPublic, ImportGroupWeak},
+		RemoveDuplicates: true,
+	}
+}
+
+// ParseImportGroups converts group names into ImportGroup values
+// Returns error on unknown or repeated names
+//
+// ParseImportGroups 将分组名称转换为 ImportGroup 值
+// 名称未知或重复时返回错误
+func ParseImportGroups(names []string) ([]ImportGroup, error) {
+	var groups []ImportGroup
+	for _, name := range names {
+		group := ImportGroup(strings.TrimSpace(name))
+		switch group {
+		case ImportGroupWellKnown, ImportGroupPlain, ImportGroupPublic, ImportGroupWeak:
+		default:
+			return nil, erero.Errorf("unknown import group %s, expected %s, %s, %s or %s", name, ImportGroupWellKnown, ImportGroupPlain, ImportGroupPublic, ImportGroupWeak)
+		}
+		if slices.Contains(groups, group) {
+			return nil, erero.Errorf("import group %s listed twice", name)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// importEntry is an import statement with its leading comments, as source lines
+// importEntry 是带有前导注释的 import 语句，以源码行表示
+type importEntry struct {
+	path     string   // Imported path without quotes // 不带引号的导入路径
+	modifier string   // public, weak or empty // public、weak 或空
+	leading  []string // Source lines of the comments above the import // import 上方注释的源码行
+	lines    []string // Source lines of the import, trailing comment included // import 的源码行，包含尾随注释
+	trailing string   // Text of the trailing comment, empty when none // 尾随注释的文本，没有时为空
+}
+
+// absorb carries the comments of a dropped duplicate over to the entry, so removing duplicates never loses comments
+// A trailing comment moves after the import when the entry has none, otherwise it joins the leading comments
+//
+// absorb 将被丢弃重复项的注释转移到该条目，使去重不会丢失注释
+// 条目没有尾随注释时尾随注释移到 import 之后，否则加入前导注释
+func (e *importEntry) absorb(dropped *importEntry) {
+	e.leading = append(e.leading, dropped.leading...)
+	if dropped.trailing == "" || dropped.trailing == e.trailing {
+		return
+	}
+	last := e.lines[len(e.lines)-1]
+	code := strings.TrimRight(last, "\r\n")
+	newline := last[len(code):]
+	if e.trailing == "" && !strings.Contains(dropped.trailing, "\n") {
+		e.lines[len(e.lines)-1] = code + "  " + dropped.trailing + newline
+		e.trailing = dropped.trailing
+		return
+	}
+	if newline == "" {
+		newline = "\n"
+	}
+	indent := code[:len(code)-len(strings.TrimLeft(code, " \t"))]
+	e.leading = append(e.leading, indent+dropped.trailing+newline)
+}
+
+// SortImports sorts, groups and deduplicates the top-level import statements of the .proto source
+// Comments directly above an import and after it on the same line move with the import
+// The source is returned unchanged when imports share lines or are interleaved with other statements
+//
+// SortImports 对 .proto 源码顶层的 import 语句进行排序、分组和去重
+// 紧邻 import 上方的注释以及同一行之后的注释随 import 一起移动
+// 当 import 与其他语句共享行或交错出现时，源码原样返回
+func SortImports(source []byte, policy *ImportPolicy) ([]byte, error) {
+	output, _, err := sortImports(source, policy)
+	return output, err
+}
+
+// sortImports sorts the imports like SortImports, returning why the source was left unchanged when the imports could not be sorted
+// sortImports 像 SortImports 一样排序导入，无法排序时返回源码保持不变的原因
+func sortImports(source []byte, policy *ImportPolicy) (output []byte, skip string, err error) {
+	file, err := protosyntax.Parse(source)
+	if err != nil {
+		return nil, "", erero.Wro(err)
+	}
+	first, last := -1, -1
+	for idx, node := range file.Nodes {
+		if isImport(node) {
+			if first < 0 {
+				first = idx
+			}
+			last = idx
+		}
+	}
+	if first < 0 {
+		return source, "", nil
+	}
+	// leading comments of the first import belong to the import region
+	// 第一个 import 的前导注释属于导入区域
+	for first > 0 && file.Nodes[first-1].Kind == protosyntax.CommentNode && !file.Nodes[first].BlankBefore {
+		first--
+	}
+	region := file.Nodes[first : last+1]
+	for idx, node := range region {
+		if node.Kind != protosyntax.CommentNode && !isImport(node) {
+			return source, "imports are interleaved with other statements", nil
+		}
+		if idx > 0 && startLine(node) <= endLine(region[idx-1]) {
+			return source, "imports share lines with other statements", nil
+		}
+	}
+	if first > 0 && endLine(file.Nodes[first-1]) >= startLine(region[0]) {
+		return source, "imports share lines with other statements", nil
+	}
+	if last+1 < len(file.Nodes) && startLine(file.Nodes[last+1]) <= endLine(region[len(region)-1]) {
+		return source, "imports share lines with other statements", nil
+	}
+
+	lines := strings.SplitAfter(strings.TrimPrefix(string(source), "\ufeff"), "\n")
+	var entries []*importEntry
+	var pending []string
+	for _, node := range region {
+		text := lines[startLine(node)-1 : endLine(node)]
+		if node.Kind == protosyntax.CommentNode {
+			pending = append(pending, text...)
+			continue
+		}
+		entry := &importEntry{
+			path:     strings.Trim(node.Tokens[len(node.Tokens)-2].Text, `"'`),
+			modifier: importModifier(node),
+			leading:  pending,
+			lines:    slices.Clone(text),
+		}
+		if node.Trailing != nil {
+			entry.trailing = node.Trailing.Text
+		}
+		entries = append(entries, entry)
+		pending = nil
+	}
+	if policy.RemoveDuplicates {
+		entries = dedupeImports(entries)
+	}
+
+	var block []string
+	for _, group := range orderGroups(policy.Groups) {
+		var members []*importEntry
+		for _, entry := range entries {
+			if classifyImport(entry, policy.Groups) == group {
+				members = append(members, entry)
+			}
+		}
+		if len(members) == 0 {
+			continue
+		}
+		slices.SortStableFunc(members, func(a, b *importEntry) int { return strings.Compare(a.path, b.path) })
+		if len(block) > 0 {
+			block = append(block, "\n")
+		}
+		for _, entry := range members {
+			block = append(block, entry.leading...)
+			block = append(block, entry.lines...)
+		}
+	}
+	// a trailing comment block that no import follows stays at the end of the region
+	// 后面没有 import 的尾部注释保留在区域末尾
+	block = append(block, pending...)
+	if last := block[len(block)-1]; !strings.HasSuffix(last, "\n") {
+		block[len(block)-1] = last + "\n"
+	}
+
+	startIdx := startLine(region[0]) - 1
+	endIdx := endLine(region[len(region)-1])
+	result := strings.Join(lines[:startIdx], "")
+	result += strings.Join(block, "")
+	if endIdx < len(lines) {
+		result += strings.Join(lines[endIdx:], "")
+	} else if !strings.HasSuffix(string(source), "\n") {
+		result = strings.TrimSuffix(result, "\n")
+	}
+	if strings.HasPrefix(string(source), "\ufeff") {
+		result = "\ufeff" + result
+	}
+	return []byte(result), "", nil
+}
+
+// isImport reports whether the node is an import statement
+// isImport 判断节点是否为 import 语句
+func isImport(node *protosyntax.Node) bool {
+	return node.Kind == protosyntax.StatementNode && len(node.Tokens) >= 3 && node.Tokens[0].Text == "import" && node.Tokens[len(node.Tokens)-2].Kind == protosyntax.String
+}
+
+// importModifier returns public, weak or empty
+// importModifier 返回 public、weak 或空
+func importModifier(node *protosyntax.Node) string {
+	if len(node.Tokens) == 4 && (node.Tokens[1].Text == "public" || node.Tokens[1].Text == "weak") {
+		return node.Tokens[1].Text
+	}
+	return ""
+}
+
+// dedupeImports keeps the first import of each path, upgrading it to public when a duplicate is public
+// The comments of each dropped duplicate are carried over to the kept import
+//
+// dedupeImports 保留每个路径的第一个导入，若重复项为 public 则将其提升为 public
+// 每个被丢弃重复项的注释都转移到保留的导入上
+func dedupeImports(entries []*importEntry) []*importEntry {
+	var results []*importEntry
+	for _, entry := range entries {
+		idx := slices.IndexFunc(results, func(kept *importEntry) bool { return kept.path == entry.path })
+		if idx < 0 {
+			results = append(results, entry)
+			continue
+		}
+		if entry.modifier == "public" && results[idx].modifier != "public" {
+			results[idx], entry = entry, results[idx]
+		}
+		results[idx].absorb(entry)
+	}
+	return results
+}
+
+// orderGroups returns the groups in output order, with plain appended when missing
+// orderGroups 返回输出顺序的分组，缺少 plain 时追加到末尾
+func orderGroups(groups []ImportGroup) []ImportGroup {
+	if slices.Contains(groups, ImportGroupPlain) {
+		return groups
+	}
+	return append(slices.Clone(groups), ImportGroupPlain)
+}
+
+// classifyImport returns the group of the import under the listed groups
+// Modifiers take precedence over the well-known path
+//
+// classifyImport 返回导入在所列分组下的归属分组
+// 修饰符优先于 well-known 路径
+func classifyImport(entry *importEntry, groups []ImportGroup) ImportGroup {
+	switch {
+	case entry.modifier == "public" && slices.Contains(groups, ImportGroupPublic):
+		return ImportGroupPublic
+	case entry.modifier == "weak" && slices.Contains(groups, ImportGroupWeak):
+		return ImportGroupWeak
+	case entry.modifier == "" && strings.HasPrefix(entry.path, "google/protobuf/") && slices.Contains(groups, ImportGroupWellKnown):
+		return ImportGroupWellKnown
+	default:
+		return ImportGroupPlain
+	}
+}
+
+// startLine returns the first source line of the node
+// startLine 返回节点在源码中的第一行
+func startLine(node *protosyntax.Node) int {
+	if node.Kind == protosyntax.CommentNode {
+		return node.Comment.Line
+	}
+	return node.Tokens[0].Line
+}
+
+// endLine returns the last source line of the node, trailing comment included
+// endLine 返回节点在源码中的最后一行，包含尾随注释
+func endLine(node *protosyntax.Node) int {
+	switch {
+	case node.Kind == protosyntax.CommentNode:
+		return node.Comment.EndLine
+	case node.Kind == protosyntax.BlockNode:
+		if node.CloseTrailing != nil {
+			return node.CloseTrailing.EndLine
+		}
+		return node.CloseLine
+	case node.Trailing != nil:
+		return node.Trailing.EndLine
+	default:
+		return node.Tokens[len(node.Tokens)-1].EndLine
+	}
+}
@@ -0,0 +1,119 @@
+package protoformat_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-xlan/clang-format/protoformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+func TestSortImports(t *testing.T) {
+	source := `syntax = "proto3";
+
+package demo;
+
+// user types
+import "demo/user.proto";
+import public "demo/common.proto";
+import "google/protobuf/timestamp.proto";
+import "demo/account.proto";  // accounts
+import weak "demo/legacy.proto";
+
+import "google/protobuf/any.proto";
+import "demo/user.proto";
+
+option go_package = "demo";
+`
+	expected := `syntax = "proto3";
+
+package demo;
+
+import "google/protobuf/any.proto";
+import "google/protobuf/timestamp.proto";
+
+import "demo/account.proto";  // accounts
+// user types
+import "demo/user.proto";
+
+import public "demo/common.proto";
+
+import weak "demo/legacy.proto";
+
+option go_package = "demo";
+`
+	output := rese.V1(protoformat.SortImports([]byte(source), protoformat.NewImportPolicy()))
+	require.Equal(t, expected, string(output))
+
+	// sorting twice gives the same result
+	// 重复排序得到相同的结果
+	require.Equal(t, expected, string(rese.V1(protoformat.SortImports(output, protoformat.NewImportPolicy()))))
+}
+
+func TestSortImportsPolicy(t *testing.T) {
+	source := "import public \"b.proto\";\nimport \"google/protobuf/empty.proto\";\nimport \"a.proto\";\nimport \"a.proto\";\n"
+
+	policy := &protoformat.ImportPolicy{Groups: []protoformat.ImportGroup{protoformat.ImportGroupPublic}}
+	output := rese.V1(protoformat.SortImports([]byte(source), policy))
+	require.Equal(t, "import public \"b.proto\";\n\nimport \"a.proto\";\nimport \"a.proto\";\nimport \"google/protobuf/empty.proto\";\n", string(output))
+
+	// interleaved statements keep the source unchanged
+	// 交错出现的语句保持源码不变
+	interleaved := "import \"b.proto\";\noption java_package = \"x\";\nimport \"a.proto\";\n"
+	require.Equal(t, interleaved, string(rese.V1(protoformat.SortImports([]byte(interleaved), protoformat.NewImportPolicy()))))
+
+	// a public duplicate wins over the plain import
+	// public 重复项优先于普通导入
+	output = rese.V1(protoformat.SortImports([]byte("import \"a.proto\";\nimport public \"a.proto\";"), protoformat.NewImportPolicy()))
+	require.Equal(t, "import public \"a.proto\";", string(output))
+}
+
+func TestSortImportsDuplicateComments(t *testing.T) {
+	// 被丢弃重复项的前导注释和尾随注释转移到保留的导入上
+	source := "import \"a.proto\";\n// needed by Order\nimport \"a.proto\";  // keep for v1\n"
+	output := rese.V1(protoformat.SortImports([]byte(source), protoformat.NewImportPolicy()))
+	require.Equal(t, "// needed by Order\nimport \"a.proto\";  // keep for v1\n", string(output))
+
+	// 保留的导入已有尾随注释时，重复项的尾随注释放入前导注释
+	source = "// users\nimport \"a.proto\";  // first\nimport \"a.proto\";  // second\n"
+	output = rese.V1(protoformat.SortImports([]byte(source), protoformat.NewImportPolicy()))
+	require.Equal(t, "// users\n// second\nimport \"a.proto\";  // first\n", string(output))
+
+	// public 重复项替换普通导入时，普通导入的注释同样保留
+	source = "// plain\nimport \"a.proto\";  // old\nimport public \"a.proto\";\n"
+	output = rese.V1(protoformat.SortImports([]byte(source), protoformat.NewImportPolicy()))
+	require.Equal(t, "// plain\nimport public \"a.proto\";  // old\n", string(output))
+}
+
+func TestParseImportGroups(t *testing.T) {
+	groups := rese.V1(protoformat.ParseImportGroups([]string{"plain", "well-known"}))
+	require.Equal(t, []protoformat.ImportGroup{protoformat.ImportGroupPlain, protoformat.ImportGroupWellKnown}, groups)
+
+	_, err := protoformat.ParseImportGroups([]string{"system"})
+	require.Error(t, err)
+	_, err = protoformat.ParseImportGroups([]string{"weak", "weak"})
+	require.Error(t, err)
+}
+
+func TestFormatProjectSortImports(t *testing.T) {
+	tempDIR := rese.V1(os.MkdirTemp("", "proto-format-imports-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	protoFile := filepath.Join(tempDIR, "user.proto")
+	must.Done(os.WriteFile(protoFile, []byte("syntax = \"proto3\";\nimport \"b.proto\";\nimport \"a.proto\";\nmessage User {int32 id = 1;}\n"), 0644))
+
+	formatter := protoformat.NewFormatter().WithBackend(protoformat.BackendNative).WithImportPolicy(protoformat.NewImportPolicy()).WithVerify(true)
+	must.Done(formatter.FormatProject(nil, tempDIR, ".proto", protoformat.NewStyle()))
+	require.Equal(t, "syntax = \"proto3\";\nimport \"a.proto\";\nimport \"b.proto\";\nmessage User {\n  int32 id = 1;\n}\n", string(rese.V1(os.ReadFile(protoFile))))
+}
+
+func TestDryRunSourceInterleavedImports(t *testing.T) {
+	// 交错出现的 import 保持原有顺序（并记录带路径的警告），其余内容照常格式化
+	source := "import \"b.proto\";\noption java_package = \"x\";\nimport \"a.proto\";\nmessage User {int32 id = 1;}\n"
+	formatter := protoformat.NewFormatter().WithBackend(protoformat.BackendNative).WithImportPolicy(protoformat.NewImportPolicy())
+	output := rese.V1(formatter.DryRunSource(nil, []byte(source), "user.proto", protoformat.NewStyle()))
+	require.Equal(t, "import \"b.proto\";\noption java_package = \"x\";\nimport \"a.proto\";\nmessage User {\n  int32 id = 1;\n}\n", string(output))
+}
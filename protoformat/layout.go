@@ -0,0 +1,436 @@
+package protoformat
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-xlan/clang-format/internal/protosyntax"
+	"github.com/yyle88/erero"
+)
+
+// LayoutStyle holds the proto layout rules applied after the backend formats the content
+// These rules cover what AlignConsecutiveAssignments of Style does not, such as field options and declaration spacing
+//
+// LayoutStyle 保存在后端格式化内容之后应用的 proto 布局规则
+// 这些规则覆盖 Style 的 AlignConsecutiveAssignments 未涵盖的内容，例如字段选项和声明间距
+type LayoutStyle struct {
+	AlignFieldNumbers            bool // Align = N of consecutive fields and enum values // 对齐连续字段和枚举值的 = N
+	AlignOptions                 bool // Align [...] options of consecutive fields // 对齐连续字段的 [...] 选项
+	AlignComments                bool // Align trailing comments of consecutive lines // 对齐连续行的尾随注释
+	AlignAcrossComments          bool // Whether standalone comment lines keep a field run going // 独立注释行是否不打断字段对齐段
+	NormalizeOptions             bool // Rewrite field options as [a = 1, (b).c = "x"] // 将字段选项改写为 [a = 1, (b).c = "x"]
+	BlankLineBetweenDeclarations bool // Separate top-level message, enum, service and extend blocks by one blank line // 用一个空行分隔顶层 message、enum、service 和 extend 代码块
+}
+
+// NewLayoutStyle creates a LayoutStyle with every rule enabled
+//
+// NewLayoutStyle 创建启用全部规则的 LayoutStyle
+func NewLayoutStyle() *LayoutStyle {
+	return &LayoutStyle{
+		AlignFieldNumbers:            true,
+		AlignOptions:                 true,
+		AlignComments:                true,
+		AlignAcrossComments:          true,
+		NormalizeOptions:             true,
+		BlankLineBetweenDeclarations: true,
+	}
+}
+
+// layoutLine is one line of formatted content split into the parts the rules work on
+// layoutLine 是拆分为规则所处理部分的一行格式化内容
+type layoutLine struct {
+	text    string // Original line text // 原始行文本
+	indent  string // Leading indentation // 前导缩进
+	code    string // Code before the trailing comment // 尾随注释之前的代码
+	comment string // Single-line trailing comment // 单行尾随注释
+	gap     string // Spacing between code and comment // 代码与注释之间的空白
+	depth   int    // Brace depth at the start of the line // 行首的大括号深度
+	kind    layoutKind
+	field   *fieldParts // Parts of a field line // 字段行的各部分
+	changed bool        // Whether the code was rewritten // 代码是否被改写
+}
+
+// layoutKind is the category of a layout line
+// layoutKind 是布局行的类别
+type layoutKind int
+
+const (
+	layoutOther   layoutKind = iota // Lines the rules leave alone // 规则不处理的行
+	layoutBlank                     // Empty lines // 空行
+	layoutComment                   // Standalone comment lines // 独立注释行
+	layoutCode                      // Statements on a single line // 单行语句
+	layoutField                     // Fields and enum values with = N // 带 = N 的字段和枚举值
+)
+
+// fieldParts splits a field line around the field number
+// fieldParts 以字段编号为界拆分字段行
+type fieldParts struct {
+	head    string // Text before = // = 之前的文本
+	number  string // Field number, with the sign // 字段编号，含符号
+	options string // [...] options, empty when absent // [...] 选项，不存在时为空
+}
+
+// ApplyLayout applies the proto layout rules on formatted content
+// Only whitespace and the spacing inside field options change, lines the rules do not understand are kept
+//
+// ApplyLayout 在格式化内容上应用 proto 布局规则
+// 只改变空白和字段选项内部的空格，规则无法识别的行保持不变
+func ApplyLayout(source []byte, style *LayoutStyle) ([]byte, error) {
+	tokens, err := protosyntax.Tokenize(source)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	text := string(source)
+	bom := strings.HasPrefix(text, "\ufeff")
+	text = strings.TrimPrefix(text, "\ufeff")
+	newline := strings.HasSuffix(text, "\n")
+	lines := splitLayoutLines(strings.Split(strings.TrimSuffix(text, "\n"), "\n"), tokens)
+
+	for _, line := range lines {
+		if line.kind == layoutField && style.NormalizeOptions && line.field.options != "" {
+			if options := normalizeOptions(line.field.options); options != line.field.options {
+				line.field.options = options
+				line.changed = true
+			}
+		}
+	}
+	if style.AlignFieldNumbers || style.AlignOptions {
+		alignFields(lines, style)
+	}
+	for _, line := range lines {
+		if line.kind == layoutField {
+			if code := renderField(line.field); code != line.code {
+				line.changed = true
+				line.code = code
+			}
+		}
+	}
+	if style.AlignComments {
+		alignLayoutRuns(lines, func(line *layoutLine) bool {
+			return (line.kind == layoutCode || line.kind == layoutField) && line.comment != ""
+		}, func(line *layoutLine) int {
+			return utf8.RuneCountInString(line.indent + line.code)
+		}, func(line *layoutLine, column int) {
+			gap := strings.Repeat(" ", column-utf8.RuneCountInString(line.indent+line.code)+2)
+			line.changed = line.changed || gap != line.gap
+			line.gap = gap
+		})
+	}
+	if style.BlankLineBetweenDeclarations {
+		lines = separateDeclarations(lines)
+	}
+
+	var result strings.Builder
+	if bom {
+		result.WriteString("\ufeff")
+	}
+	for idx, line := range lines {
+		if idx > 0 {
+			result.WriteString("\n")
+		}
+		if !line.changed {
+			result.WriteString(line.text)
+			continue
+		}
+		out := line.indent + line.code
+		if line.comment != "" {
+			out += line.gap + line.comment
+		}
+		result.WriteString(out)
+	}
+	if newline {
+		result.WriteString("\n")
+	}
+	return []byte(result.String()), nil
+}
+
+// splitLayoutLines classifies each line with the tokens starting on it
+// splitLayoutLines 根据每行起始的词法单元对行进行分类
+func splitLayoutLines(texts []string, tokens []*protosyntax.Token) []*layoutLine {
+	lines := make([]*layoutLine, len(texts))
+	for idx, text := range texts {
+		lines[idx] = &layoutLine{text: text, kind: layoutOther}
+		if strings.TrimSpace(text) == "" {
+			lines[idx].kind = layoutBlank
+		}
+	}
+	var depth int
+	var prev *protosyntax.Token // previous non-comment token // 前一个非注释词法单元
+	for pos := 0; pos < len(tokens); {
+		lineNumber := tokens[pos].Line
+		end := pos
+		for end < len(tokens) && tokens[end].Line == lineNumber {
+			end++
+		}
+		onLine := tokens[pos:end]
+		line := lines[lineNumber-1]
+		line.depth = depth
+		classifyLine(line, onLine, prev)
+		for _, token := range onLine {
+			if token.Kind == protosyntax.Comment {
+				continue
+			}
+			switch token.Text {
+			case "{":
+				depth++
+			case "}":
+				depth--
+			}
+			prev = token
+		}
+		pos = end
+	}
+	return lines
+}
+
+// classifyLine sets the kind and parts of the line from its tokens
+// classifyLine 根据行的词法单元设置行的类别和各部分
+func classifyLine(line *layoutLine, tokens []*protosyntax.Token, prev *protosyntax.Token) {
+	if tokens[0].Kind == protosyntax.Comment {
+		if len(tokens) == 1 && tokens[0].EndLine == tokens[0].Line {
+			line.kind = layoutComment
+		}
+		return
+	}
+	// the line must hold whole statements, starting after ; { } and ending on this line
+	// 该行必须包含完整语句，从 ; { } 之后开始并在本行结束
+	if prev != nil && (prev.Kind != protosyntax.Symbol || !slices.Contains([]string{";", "{", "}"}, prev.Text)) {
+		return
+	}
+	code := tokens
+	last := tokens[len(tokens)-1]
+	if last.Kind == protosyntax.Comment {
+		if last.EndLine != last.Line {
+			return
+		}
+		code = tokens[:len(tokens)-1]
+	}
+	for _, token := range code {
+		if token.Kind == protosyntax.Comment || token.EndLine != token.Line {
+			return
+		}
+	}
+	tail := code[len(code)-1]
+	if tail.Kind != protosyntax.Symbol || !slices.Contains([]string{";", "{", "}"}, tail.Text) {
+		return
+	}
+	line.indent = line.text[:code[0].Column]
+	line.code = strings.TrimRight(line.text[code[0].Column:tail.Column+len(tail.Text)], " \t")
+	if len(code) < len(tokens) {
+		line.comment = last.Text
+		line.gap = line.text[tail.Column+len(tail.Text) : last.Column]
+	}
+	line.kind = layoutCode
+	if field := splitField(line.text, code); field != nil {
+		line.kind = layoutField
+		line.field = field
+	}
+}
+
+// splitField returns the parts of a field or enum value statement, nil on other statements
+// splitField 返回字段或枚举值语句的各部分，其他语句返回 nil
+func splitField(text string, tokens []*protosyntax.Token) *fieldParts {
+	if tokens[len(tokens)-1].Text != ";" || tokens[0].Kind != protosyntax.Ident {
+		return nil
+	}
+	if slices.Contains([]string{"option", "syntax", "edition", "package", "import", "reserved", "extensions"}, tokens[0].Text) {
+		return nil
+	}
+	eq := slices.IndexFunc(tokens, func(token *protosyntax.Token) bool { return token.Kind == protosyntax.Symbol && token.Text == "=" })
+	if eq < 1 || eq+1 >= len(tokens) {
+		return nil
+	}
+	for _, token := range tokens[:eq] {
+		if token.Kind == protosyntax.Symbol && slices.Contains([]string{"{", "}", "(", ")", "[", "]", ";"}, token.Text) {
+			return nil
+		}
+	}
+	idx := eq + 1
+	number := ""
+	if tokens[idx].Text == "-" && idx+1 < len(tokens) {
+		number = "-"
+		idx++
+	}
+	if tokens[idx].Kind != protosyntax.Number {
+		return nil
+	}
+	number += tokens[idx].Text
+	idx++
+	field := &fieldParts{
+		head:   strings.TrimRight(text[tokens[0].Column:tokens[eq].Column], " \t"),
+		number: number,
+	}
+	if tokens[idx].Text == "[" {
+		closing := len(tokens) - 2
+		if closing <= idx || tokens[closing].Text != "]" {
+			return nil
+		}
+		for _, token := range tokens[idx:closing] {
+			if token.Text == "{" || token.Text == "}" {
+				return nil
+			}
+		}
+		field.options = text[tokens[idx].Column : tokens[closing].Column+1]
+		idx = closing + 1
+	}
+	if idx != len(tokens)-1 {
+		return nil
+	}
+	return field
+}
+
+// normalizeOptions rewrites [ a=1 ,(b).c= "x" ] as [a = 1, (b).c = "x"]
+// Options holding aggregate values are returned unchanged
+//
+// normalizeOptions 将 [ a=1 ,(b).c= "x" ] 改写为 [a = 1, (b).c = "x"]
+// 包含聚合值的选项原样返回
+func normalizeOptions(options string) string {
+	tokens, err := protosyntax.Tokenize([]byte(options))
+	if err != nil {
+		return options
+	}
+	var result strings.Builder
+	for idx, token := range tokens {
+		if token.Kind == protosyntax.Comment {
+			return options
+		}
+		if idx > 0 {
+			prev := tokens[idx-1]
+			switch {
+			case token.Text == "=" || prev.Text == "=" || prev.Text == ",":
+				result.WriteString(" ")
+			case isWord(prev) && isWord(token):
+				result.WriteString(" ")
+			}
+		}
+		result.WriteString(token.Text)
+	}
+	return result.String()
+}
+
+// isWord reports whether the token needs a space when it follows another word
+// isWord 判断词法单元跟在另一个单词之后时是否需要空格
+func isWord(token *protosyntax.Token) bool {
+	return token.Kind == protosyntax.Ident || token.Kind == protosyntax.Number || token.Kind == protosyntax.String
+}
+
+// alignFields pads the heads and numbers of consecutive fields in a block so = and [ line up
+// alignFields 填充代码块中连续字段的头部和编号，使 = 和 [ 对齐
+func alignFields(lines []*layoutLine, style *LayoutStyle) {
+	for start := 0; start < len(lines); {
+		if lines[start].kind != layoutField {
+			start++
+			continue
+		}
+		var run []*layoutLine
+		end := start
+		for ; end < len(lines); end++ {
+			line := lines[end]
+			if line.kind == layoutField && line.depth == lines[start].depth {
+				run = append(run, line)
+				continue
+			}
+			if line.kind == layoutComment && style.AlignAcrossComments {
+				continue
+			}
+			break
+		}
+		if style.AlignFieldNumbers {
+			column := 0
+			for _, line := range run {
+				column = max(column, utf8.RuneCountInString(line.field.head))
+			}
+			for _, line := range run {
+				line.field.head += strings.Repeat(" ", column-utf8.RuneCountInString(line.field.head))
+			}
+		}
+		if style.AlignOptions {
+			column := 0
+			for _, line := range run {
+				if line.field.options != "" {
+					column = max(column, utf8.RuneCountInString(line.field.head+line.field.number))
+				}
+			}
+			for _, line := range run {
+				if line.field.options != "" {
+					line.field.number += strings.Repeat(" ", column-utf8.RuneCountInString(line.field.head+line.field.number))
+				}
+			}
+		}
+		start = end
+	}
+}
+
+// renderField joins the field parts back into code
+// renderField 将字段各部分重新拼接为代码
+func renderField(field *fieldParts) string {
+	code := field.head + " = " + field.number
+	if field.options != "" {
+		code += " " + field.options
+	}
+	return code + ";"
+}
+
+// alignLayoutRuns applies the alignment on each run of consecutive matching lines
+// alignLayoutRuns 对每一段连续匹配的行应用对齐
+func alignLayoutRuns(lines []*layoutLine, match func(*layoutLine) bool, column func(*layoutLine) int, apply func(*layoutLine, int)) {
+	for start := 0; start < len(lines); {
+		if !match(lines[start]) {
+			start++
+			continue
+		}
+		end := start
+		maxColumn := 0
+		for end < len(lines) && match(lines[end]) {
+			maxColumn = max(maxColumn, column(lines[end]))
+			end++
+		}
+		for _, line := range lines[start:end] {
+			apply(line, maxColumn)
+		}
+		start = end
+	}
+}
+
+// separateDeclarations inserts a blank line before top-level blocks and after their closing }
+// Comments directly above a block stay attached to it
+//
+// separateDeclarations 在顶层代码块之前及其结尾 } 之后插入空行
+// 紧邻代码块上方的注释保持与其相连
+func separateDeclarations(lines []*layoutLine) []*layoutLine {
+	needBlank := make([]bool, len(lines)+1)
+	for idx, line := range lines {
+		if line.depth != 0 || line.kind != layoutCode {
+			continue
+		}
+		if !strings.Contains(line.code, "{") || !slices.Contains([]string{"message", "enum", "service", "extend"}, strings.Fields(line.code)[0]) {
+			continue
+		}
+		top := idx
+		for top > 0 && lines[top-1].kind == layoutComment && lines[top-1].depth == 0 {
+			top--
+		}
+		needBlank[top] = top > 0 && lines[top-1].kind != layoutBlank
+		// a block closed on the same line also needs the blank line after it
+		// 在同一行结束的代码块之后也需要空行
+		if !strings.HasSuffix(line.code, "{") && idx+1 < len(lines) && lines[idx+1].kind != layoutBlank {
+			needBlank[idx+1] = true
+		}
+	}
+	// a closing } at depth 1 ends a top-level block
+	// 深度为 1 的结尾 } 结束一个顶层代码块
+	for idx, line := range lines {
+		if line.depth == 1 && line.kind == layoutCode && strings.HasPrefix(line.code, "}") && idx+1 < len(lines) && lines[idx+1].kind != layoutBlank {
+			needBlank[idx+1] = true
+		}
+	}
+	var results []*layoutLine
+	for idx, line := range lines {
+		if needBlank[idx] {
+			results = append(results, &layoutLine{kind: layoutBlank})
+		}
+		results = append(results, line)
+	}
+	return results
+}
@@ -0,0 +1,82 @@
+package protoformat_test
+
+import (
+	"testing"
+
+	"github.com/go-xlan/clang-format/protoformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/rese"
+)
+
+func TestApplyLayout(t *testing.T) {
+	source := `syntax = "proto3";
+package demo;
+// User is a user
+message User {
+  int32 id = 1;  // id
+  string display_name = 2 [deprecated=true,(validate.rules).string.min_len= 1];
+  // email
+  repeated string emails = 10 [ json_name = "mail" ];  // all emails
+  message Inner { int32 x = 1; }
+  oneof kind {
+    string a = 5;
+    int64 bb = 6;
+  }
+}
+enum Status {
+  STATUS_UNSPECIFIED = 0;
+  STATUS_NEGATIVE = -1;
+}
+message Empty {}
+service UserService {
+  rpc Get(User) returns (User);
+}
+`
+	expected := `syntax = "proto3";
+package demo;
+
+// User is a user
+message User {
+  int32 id               = 1;  // id
+  string display_name    = 2  [deprecated = true, (validate.rules).string.min_len = 1];
+  // email
+  repeated string emails = 10 [json_name = "mail"];  // all emails
+  message Inner { int32 x = 1; }
+  oneof kind {
+    string a = 5;
+    int64 bb = 6;
+  }
+}
+
+enum Status {
+  STATUS_UNSPECIFIED = 0;
+  STATUS_NEGATIVE    = -1;
+}
+
+message Empty {}
+
+service UserService {
+  rpc Get(User) returns (User);
+}
+`
+	output := rese.V1(protoformat.ApplyLayout([]byte(source), protoformat.NewLayoutStyle()))
+	require.Equal(t, expected, string(output))
+	require.Equal(t, expected, string(rese.V1(protoformat.ApplyLayout(output, protoformat.NewLayoutStyle()))))
+}
+
+func TestApplyLayoutRules(t *testing.T) {
+	source := "message A {\n  int32 id = 1;  // id\n  // name\n  string name = 2 [ deprecated=true ];  // name\n}\n"
+
+	// every rule disabled keeps the content
+	// 禁用全部规则时内容保持不变
+	require.Equal(t, source, string(rese.V1(protoformat.ApplyLayout([]byte(source), &protoformat.LayoutStyle{}))))
+
+	style := &protoformat.LayoutStyle{AlignFieldNumbers: true, AlignComments: true}
+	expected := "message A {\n  int32 id = 1;  // id\n  // name\n  string name = 2 [ deprecated=true ];  // name\n}\n"
+	require.Equal(t, expected, string(rese.V1(protoformat.ApplyLayout([]byte(source), style))))
+
+	style.AlignAcrossComments = true
+	style.NormalizeOptions = true
+	expected = "message A {\n  int32 id    = 1;  // id\n  // name\n  string name = 2 [deprecated = true];  // name\n}\n"
+	require.Equal(t, expected, string(rese.V1(protoformat.ApplyLayout([]byte(source), style))))
+}
@@ -0,0 +1,256 @@
+package protoformat
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/go-xlan/clang-format/internal/protosyntax"
+	"github.com/yyle88/erero"
+)
+
+// LintRule names a naming convention checked by Lint
+// Names follow the buf lint rule names
+//
+// LintRule 表示 Lint 检查的命名约定
+// 名称沿用 buf lint 的规则名称
+type LintRule string
+
+const (
+	LintMessagePascalCase   LintRule = "MESSAGE_PASCAL_CASE"         // Message names are PascalCase // 消息名称使用 PascalCase
+	LintEnumPascalCase      LintRule = "ENUM_PASCAL_CASE"            // Enum names are PascalCase // 枚举名称使用 PascalCase
+	LintEnumValueUpperSnake LintRule = "ENUM_VALUE_UPPER_SNAKE_CASE" // Enum values are UPPER_SNAKE_CASE // 枚举值使用 UPPER_SNAKE_CASE
+	LintEnumValuePrefix     LintRule = "ENUM_VALUE_PREFIX"           // Enum values start with the UPPER_SNAKE enum name // 枚举值以 UPPER_SNAKE 形式的枚举名开头
+	LintEnumZeroValueSuffix LintRule = "ENUM_ZERO_VALUE_SUFFIX"      // The zero value ends with the zero value suffix // 零值以零值后缀结尾
+	LintFieldLowerSnakeCase LintRule = "FIELD_LOWER_SNAKE_CASE"      // Field names are lower_snake_case // 字段名称使用 lower_snake_case
+)
+
+// LintConfig selects the rules Lint checks
+//
+// LintConfig 选择 Lint 检查的规则
+type LintConfig struct {
+	Rules           []LintRule // Enabled rules // 启用的规则
+	ZeroValueSuffix string     // Suffix of enum zero values // 枚举零值的后缀
+}
+
+// NewLintConfig creates a LintConfig with every rule enabled and the _UNSPECIFIED zero value suffix
+//
+// NewLintConfig 创建启用全部规则、零值后缀为 _UNSPECIFIED 的 LintConfig
+func NewLintConfig() *LintConfig {
+	return &LintConfig{
+		Rules:           slices.Clone(lintRules),
+		ZeroValueSuffix: "_UNSPECIFIED",
+	}
+}
+
+// lintRules lists every rule in report order
+// lintRules 按报告顺序列出全部规则
+var lintRules = []LintRule{
+	LintMessagePascalCase,
+	LintEnumPascalCase,
+	LintEnumValueUpperSnake,
+	LintEnumValuePrefix,
+	LintEnumZeroValueSuffix,
+	LintFieldLowerSnakeCase,
+}
+
+// ParseLintRules converts rule names into LintRule values
+// Returns error on unknown names
+//
+// ParseLintRules 将规则名称转换为 LintRule 值
+// 名称未知时返回错误
+func ParseLintRules(names []string) ([]LintRule, error) {
+	var rules []LintRule
+	for _, name := range names {
+		rule := LintRule(strings.ToUpper(strings.TrimSpace(name)))
+		if !slices.Contains(lintRules, rule) {
+			return nil, erero.Errorf("unknown lint rule %s", name)
+		}
+		if !slices.Contains(rules, rule) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// Violation reports a naming convention violation
+//
+// Violation 报告一个违反命名约定的问题
+type Violation struct {
+	Path    string   // File path // 文件路径
+	Line    int      // Line of the name, 1-based // 名称所在的行，从 1 开始
+	Rule    LintRule // Violated rule // 违反的规则
+	Message string   // Description // 描述
+}
+
+func (v *Violation) String() string {
+	return fmt.Sprintf("%s:%d: %s %s", v.Path, v.Line, v.Rule, v.Message)
+}
+
+var (
+	pascalCasePattern     = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+	upperSnakeCasePattern = regexp.MustCompile(`^[A-Z][A-Z0-9]*(_[A-Z0-9]+)*$`)
+	lowerSnakeCasePattern = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+)
+
+// Lint checks the naming conventions of the .proto source
+// Violations are returned in source order
+//
+// Lint 检查 .proto 源码的命名约定
+// 按源码顺序返回违规项
+func Lint(path string, source []byte, config *LintConfig) ([]*Violation, error) {
+	file, err := protosyntax.Parse(source)
+	if err != nil {
+		return nil, erero.WithMessage(err, path)
+	}
+	l := &linter{path: path, config: config}
+	l.lintNodes(file.Nodes)
+	return l.violations, nil
+}
+
+// LintFile checks the naming conventions of the .proto file
+//
+// LintFile 检查 .proto 文件的命名约定
+func LintFile(path string, config *LintConfig) ([]*Violation, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return Lint(path, source, config)
+}
+
+// LintProject checks the .proto files in the project, walking them like FormatProject
+//
+// LintProject 检查项目中的 .proto 文件，与 FormatProject 以相同方式遍历
+func LintProject(projectPath string, config *LintConfig) ([]*Violation, error) {
+	var violations []*Violation
+	if err := WalkProject(projectPath, ".proto", func(path string) error {
+		results, err := LintFile(path, config)
+		if err != nil {
+			return erero.Wro(err)
+		}
+		violations = append(violations, results...)
+		return nil
+	}); err != nil {
+		return nil, erero.Wro(err)
+	}
+	return violations, nil
+}
+
+type linter struct {
+	path       string
+	config     *LintConfig
+	violations []*Violation
+}
+
+func (l *linter) report(rule LintRule, token *protosyntax.Token, format string, args ...any) {
+	if !slices.Contains(l.config.Rules, rule) {
+		return
+	}
+	l.violations = append(l.violations, &Violation{
+		Path:    l.path,
+		Line:    token.Line,
+		Rule:    rule,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// lintNodes checks the declarations among the nodes and their bodies
+// lintNodes 检查节点中的声明及其主体
+func (l *linter) lintNodes(nodes []*protosyntax.Node) {
+	for _, node := range nodes {
+		switch node.Kind {
+		case protosyntax.BlockNode:
+			if len(node.Tokens) < 2 {
+				continue
+			}
+			name := node.Tokens[1]
+			switch node.Tokens[0].Text {
+			case "message":
+				if !pascalCasePattern.MatchString(name.Text) {
+					l.report(LintMessagePascalCase, name, "message %s should be PascalCase", name.Text)
+				}
+				l.lintNodes(node.Body)
+			case "enum":
+				if !pascalCasePattern.MatchString(name.Text) {
+					l.report(LintEnumPascalCase, name, "enum %s should be PascalCase", name.Text)
+				}
+				l.lintEnumValues(name.Text, node.Body)
+			case "oneof", "extend":
+				l.lintNodes(node.Body)
+			}
+		case protosyntax.StatementNode:
+			if name, _ := fieldName(node); name != nil && !lowerSnakeCasePattern.MatchString(name.Text) {
+				l.report(LintFieldLowerSnakeCase, name, "field %s should be lower_snake_case", name.Text)
+			}
+		}
+	}
+}
+
+// lintEnumValues checks the values of the enum
+// lintEnumValues 检查枚举的值
+func (l *linter) lintEnumValues(enumName string, nodes []*protosyntax.Node) {
+	prefix := toUpperSnakeCase(enumName) + "_"
+	for _, node := range nodes {
+		name, number := fieldName(node)
+		if name == nil {
+			continue
+		}
+		if !upperSnakeCasePattern.MatchString(name.Text) {
+			l.report(LintEnumValueUpperSnake, name, "enum value %s should be UPPER_SNAKE_CASE", name.Text)
+		}
+		if !strings.HasPrefix(name.Text, prefix) {
+			l.report(LintEnumValuePrefix, name, "enum value %s should be prefixed with %s", name.Text, prefix)
+		}
+		if number == "0" && !strings.HasSuffix(name.Text, l.config.ZeroValueSuffix) {
+			l.report(LintEnumZeroValueSuffix, name, "enum zero value %s should be suffixed with %s", name.Text, l.config.ZeroValueSuffix)
+		}
+	}
+}
+
+// fieldName returns the name token and number of a field or enum value statement
+// Returns nil on other statements such as option, reserved and extensions
+//
+// fieldName 返回字段或枚举值语句的名称词法单元和编号
+// 对 option、reserved 和 extensions 等其他语句返回 nil
+func fieldName(node *protosyntax.Node) (*protosyntax.Token, string) {
+	if node.Kind != protosyntax.StatementNode || len(node.Tokens) < 4 || node.Tokens[0].Kind != protosyntax.Ident {
+		return nil, ""
+	}
+	if slices.Contains([]string{"option", "reserved", "extensions", "syntax", "edition", "package", "import"}, node.Tokens[0].Text) {
+		return nil, ""
+	}
+	eq := slices.IndexFunc(node.Tokens, func(token *protosyntax.Token) bool { return token.Kind == protosyntax.Symbol && token.Text == "=" })
+	if eq < 1 || eq+1 >= len(node.Tokens) || node.Tokens[eq-1].Kind != protosyntax.Ident {
+		return nil, ""
+	}
+	number := node.Tokens[eq+1].Text
+	if number == "-" && eq+2 < len(node.Tokens) {
+		number += node.Tokens[eq+2].Text
+	}
+	return node.Tokens[eq-1], number
+}
+
+// toUpperSnakeCase converts PascalCase into UPPER_SNAKE_CASE, keeping acronyms together
+// Example: HTTPStatusCode becomes HTTP_STATUS_CODE
+//
+// toUpperSnakeCase 将 PascalCase 转换为 UPPER_SNAKE_CASE，保持缩写词完整
+// 示例：HTTPStatusCode 转换为 HTTP_STATUS_CODE
+func toUpperSnakeCase(name string) string {
+	runes := []rune(name)
+	var result strings.Builder
+	for idx, char := range runes {
+		if idx > 0 && unicode.IsUpper(char) {
+			prev := runes[idx-1]
+			nextLower := idx+1 < len(runes) && unicode.IsLower(runes[idx+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				result.WriteRune('_')
+			}
+		}
+		result.WriteRune(unicode.ToUpper(char))
+	}
+	return result.String()
+}
@@ -0,0 +1,80 @@
+package protoformat_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-xlan/clang-format/protoformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+func TestLint(t *testing.T) {
+	source := `syntax = "proto3";
+
+option java_package = "demo";
+
+message user_profile {
+  int32 id = 1;
+  string displayName = 2;
+  map<string, string> Labels = 3;
+  oneof kind {
+    string EmailAddress = 4;
+  }
+  message Inner {
+    reserved 5;
+  }
+}
+
+enum HTTPStatus {
+  HTTP_STATUS_OK = 0;
+  NOT_FOUND = 1;
+  HTTP_STATUS_bad = 2;
+}
+
+enum Color {
+  option allow_alias = true;
+  COLOR_UNSPECIFIED = 0;
+  COLOR_RED = 1;
+}
+`
+	violations := rese.V1(protoformat.Lint("demo.proto", []byte(source), protoformat.NewLintConfig()))
+	var results []string
+	for _, violation := range violations {
+		results = append(results, violation.String())
+	}
+	require.Equal(t, []string{
+		"demo.proto:5: MESSAGE_PASCAL_CASE message user_profile should be PascalCase",
+		"demo.proto:7: FIELD_LOWER_SNAKE_CASE field displayName should be lower_snake_case",
+		"demo.proto:8: FIELD_LOWER_SNAKE_CASE field Labels should be lower_snake_case",
+		"demo.proto:10: FIELD_LOWER_SNAKE_CASE field EmailAddress should be lower_snake_case",
+		"demo.proto:18: ENUM_ZERO_VALUE_SUFFIX enum zero value HTTP_STATUS_OK should be suffixed with _UNSPECIFIED",
+		"demo.proto:19: ENUM_VALUE_PREFIX enum value NOT_FOUND should be prefixed with HTTP_STATUS_",
+		"demo.proto:20: ENUM_VALUE_UPPER_SNAKE_CASE enum value HTTP_STATUS_bad should be UPPER_SNAKE_CASE",
+	}, results)
+
+	// only the enabled rules are reported
+	// 只报告启用的规则
+	config := &protoformat.LintConfig{Rules: rese.V1(protoformat.ParseLintRules([]string{"message_pascal_case"}))}
+	violations = rese.V1(protoformat.Lint("demo.proto", []byte(source), config))
+	require.Len(t, violations, 1)
+	require.Equal(t, protoformat.LintMessagePascalCase, violations[0].Rule)
+
+	_, err := protoformat.ParseLintRules([]string{"NO_SUCH_RULE"})
+	require.Error(t, err)
+}
+
+func TestLintProject(t *testing.T) {
+	tempDIR := rese.V1(os.MkdirTemp("", "proto-lint-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	must.Done(os.WriteFile(filepath.Join(tempDIR, "a.proto"), []byte("message a {}\n"), 0644))
+	must.Done(os.WriteFile(filepath.Join(tempDIR, "b.proto"), []byte("message B {}\n"), 0644))
+	must.Done(os.WriteFile(filepath.Join(tempDIR, "c.txt"), []byte("message c {}\n"), 0644))
+
+	violations := rese.V1(protoformat.LintProject(tempDIR, protoformat.NewLintConfig()))
+	require.Len(t, violations, 1)
+	require.Equal(t, filepath.Join(tempDIR, "a.proto"), violations[0].Path)
+}
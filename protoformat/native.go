@@ -0,0 +1,27 @@
+package protoformat
+
+import (
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/internal/protosyntax"
+	"github.com/yyle88/erero"
+)
+
+// formatNative formats .proto content with the pure Go parser and printer
+// Supports proto2, proto3 and editions files, keeping comments
+//
+// formatNative 使用纯 Go 解析器和打印器格式化 .proto 内容
+// 支持 proto2、proto3 和 editions 文件，并保留注释
+func formatNative(source []byte, style *clangformat.Style) ([]byte, error) {
+	file, err := protosyntax.Parse(source)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	indentWidth := style.IndentWidth
+	if indentWidth <= 0 {
+		indentWidth = 2
+	}
+	return protosyntax.Print(file, &protosyntax.Options{
+		IndentWidth:      indentWidth,
+		AlignAssignments: style.AlignConsecutiveAssignments,
+	}), nil
+}
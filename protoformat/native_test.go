@@ -0,0 +1,133 @@
+package protoformat_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-xlan/clang-format/protoformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+func TestNativeFormat(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "proto-format-native-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	// 创建一个格式不规范的 proto 文件，原生后端不需要 clang-format
+	protoFile := filepath.Join(tempDIR, "test.proto")
+	const originalContent = `syntax = "proto3";
+
+package test;
+
+option go_package = "test/proto;test";
+
+message User{
+int32    id=1;
+string name  =  2;
+  string email=3; // email address
+}
+
+enum Status{
+UNKNOWN=0;
+  ACTIVE = 1;
+    INACTIVE=2;
+}`
+
+	must.Done(os.WriteFile(protoFile, []byte(originalContent), 0644))
+
+	formatter := protoformat.NewFormatter().WithBackend(protoformat.BackendNative)
+
+	// 预览格式化结果，结果与 clang-format 一致
+	output, err := formatter.DryRun(nil, protoFile, protoformat.NewStyle())
+	require.NoError(t, err)
+	t.Log(string(output))
+
+	const expectedResult = `syntax = "proto3";
+
+package test;
+
+option go_package = "test/proto;test";
+
+message User {
+  int32 id = 1;
+  string name = 2;
+  string email = 3;  // email address
+}
+
+enum Status {
+  UNKNOWN = 0;
+  ACTIVE = 1;
+  INACTIVE = 2;
+}
+`
+	require.Equal(t, expectedResult, string(output))
+	require.Equal(t, originalContent, string(rese.V1(os.ReadFile(protoFile))))
+
+	// 直接格式化文件，写入时保持原始文件没有末尾换行的状态
+	rese.V1(formatter.Format(nil, protoFile, protoformat.NewStyle()))
+	require.Equal(t, strings.TrimSuffix(expectedResult, "\n"), string(rese.V1(os.ReadFile(protoFile))))
+
+	// 格式化整个项目
+	must.Done(formatter.FormatProject(nil, tempDIR, ".proto", protoformat.NewStyle()))
+	require.Equal(t, strings.TrimSuffix(expectedResult, "\n"), string(rese.V1(os.ReadFile(protoFile))))
+}
+
+func TestBackendNative(t *testing.T) {
+	tempDIR := rese.V1(os.MkdirTemp("", "proto-format-backend-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	protoFile := filepath.Join(tempDIR, "test.proto")
+	must.Done(os.WriteFile(protoFile, []byte("syntax = \"proto3\";\n\nmessage User{\nint32    id=1;\n}\n"), 0644))
+	const expectedResult = "syntax = \"proto3\";\n\nmessage User {\n  int32 id = 1;\n}\n"
+
+	// 不创建 Formatter，直接通过后端使用包级接口，无需 clang-format
+	output, err := protoformat.BackendNative.DryRun(nil, protoFile, protoformat.NewStyle())
+	require.NoError(t, err)
+	require.Equal(t, expectedResult, string(output))
+
+	must.Done(protoformat.BackendNative.FormatProject(nil, tempDIR, protoformat.NewStyle()))
+	require.Equal(t, expectedResult, string(rese.V1(os.ReadFile(protoFile))))
+}
+
+func TestNativeFormatError(t *testing.T) {
+	formatter := protoformat.NewFormatter().WithBackend(protoformat.BackendNative)
+	_, err := formatter.DryRunSource(nil, []byte("message User {\n  int32 id = 1;\n"), "broken.proto", protoformat.NewStyle())
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "missing }"))
+}
+
+func TestParseBackend(t *testing.T) {
+	require.Equal(t, protoformat.BackendNative, rese.V1(protoformat.ParseBackend("native")))
+	require.Equal(t, protoformat.BackendClangFormat, rese.V1(protoformat.ParseBackend("clang-format")))
+	_, err := protoformat.ParseBackend("buf")
+	require.Error(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	original := []byte("syntax = \"proto3\";\nmessage User { int32 id = 1; }\n")
+	require.NoError(t, protoformat.Verify("user.proto", original, []byte("syntax = \"proto3\";\n\nmessage User {\n  int32 id = 1;\n}\n")))
+
+	err := protoformat.Verify("user.proto", original, []byte("syntax = \"proto3\";\nmessage User { int32 id = 2; }\n"))
+	var divergence *protoformat.Divergence
+	require.True(t, errors.As(err, &divergence))
+	require.Equal(t, 2, divergence.OriginalLine)
+	require.Equal(t, "1", divergence.Original)
+	require.Equal(t, "2", divergence.Formatted)
+}
+
+func TestNativeFormatVerify(t *testing.T) {
+	tempDIR := rese.V1(os.MkdirTemp("", "proto-format-verify-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	protoFile := filepath.Join(tempDIR, "user.proto")
+	must.Done(os.WriteFile(protoFile, []byte("message User {   int32 id = 1;  }\n"), 0644))
+
+	formatter := protoformat.NewFormatter().WithBackend(protoformat.BackendNative).WithVerify(true)
+	rese.V1(formatter.Format(nil, protoFile, protoformat.NewStyle()))
+	require.Equal(t, "message User {\n  int32 id = 1;\n}\n", string(rese.V1(os.ReadFile(protoFile))))
+}
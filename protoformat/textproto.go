@@ -0,0 +1,297 @@
+package protoformat
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/internal/protosyntax"
+	"github.com/go-xlan/clang-format/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/eroticgo"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/osexistpath/osmustexist"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// NewTextProtoStyle creates the Style used on text format files such as .textproto, .txtpb and .pbtxt
+// Text format files follow the same settings as .proto files, see NewStyle
+//
+// NewTextProtoStyle 创建用于 .textproto、.txtpb 和 .pbtxt 等文本格式文件的样式
+// 文本格式文件沿用 .proto 文件的设置，参见 NewStyle
+func NewTextProtoStyle() *clangformat.Style {
+	return NewStyle()
+}
+
+// TextProtoHeader holds the schema comments at the top of a text format file
+//
+// TextProtoHeader 保存文本格式文件顶部的模式注释
+type TextProtoHeader struct {
+	ProtoFile    string   // Value of # proto-file: // # proto-file: 的值
+	ProtoMessage string   // Value of # proto-message: // # proto-message: 的值
+	ProtoImports []string // Values of # proto-import: // # proto-import: 的值
+	Line         int      // Line of the first header comment, 0 when absent // 第一条头部注释所在的行，不存在时为 0
+}
+
+// textProtoHeaderPattern matches a header comment line such as "# proto-file: a/b.proto"
+// textProtoHeaderPattern 匹配 "# proto-file: a/b.proto" 这样的头部注释行
+var textProtoHeaderPattern = regexp.MustCompile(`^#\s*(proto-file|proto-message|proto-import):\s*(\S+)\s*$`)
+
+// qualifiedNamePattern matches a fully-qualified message name
+// qualifiedNamePattern 匹配完全限定的消息名称
+var qualifiedNamePattern = regexp.MustCompile(`^\.?[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// ParseTextProtoHeader reads the header comments from the leading comment block of the content
+// Returns an empty header when the content has none
+//
+// ParseTextProtoHeader 从内容开头的注释块读取头部注释
+// 内容中没有头部注释时返回空的头部
+func ParseTextProtoHeader(source []byte) *TextProtoHeader {
+	header := &TextProtoHeader{}
+	scanner := bufio.NewScanner(bytes.NewReader(source))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if text == "" {
+			continue
+		}
+		if !strings.HasPrefix(text, "#") {
+			break
+		}
+		matches := textProtoHeaderPattern.FindStringSubmatch(text)
+		if matches == nil {
+			continue
+		}
+		if header.Line == 0 {
+			header.Line = line
+		}
+		switch matches[1] {
+		case "proto-file":
+			header.ProtoFile = matches[2]
+		case "proto-message":
+			header.ProtoMessage = matches[2]
+		case "proto-import":
+			header.ProtoImports = append(header.ProtoImports, matches[2])
+		}
+	}
+	return header
+}
+
+// HeaderCheck configures the validation of text format file headers
+// With ProtoPaths set, the proto-file is searched in those DIRs and must declare the proto-message
+//
+// HeaderCheck 配置文本格式文件头部的校验
+// 设置 ProtoPaths 后，会在这些目录中查找 proto-file，且该文件必须声明 proto-message
+type HeaderCheck struct {
+	Required   bool     // Whether files without header fail the check // 没有头部的文件是否校验失败
+	ProtoPaths []string // Import roots used to find proto-file // 用于查找 proto-file 的导入根目录
+}
+
+// NewHeaderCheck creates a HeaderCheck that validates headers when present, without looking up schemas
+//
+// NewHeaderCheck 创建在存在头部时进行校验的 HeaderCheck，不查找模式文件
+func NewHeaderCheck() *HeaderCheck {
+	return &HeaderCheck{}
+}
+
+// CheckTextProtoHeader validates the header comments of the text format content
+// Both proto-file and proto-message must be present together, and proto-message must be a qualified name
+//
+// CheckTextProtoHeader 校验文本格式内容的头部注释
+// proto-file 和 proto-message 必须同时存在，且 proto-message 必须是限定名称
+func CheckTextProtoHeader(path string, source []byte, check *HeaderCheck) error {
+	header := ParseTextProtoHeader(source)
+	if header.Line == 0 {
+		if check.Required {
+			return erero.Errorf("%s: missing # proto-file: and # proto-message: header", path)
+		}
+		return nil
+	}
+	if header.ProtoFile == "" {
+		return erero.Errorf("%s:%d: missing # proto-file: header", path, header.Line)
+	}
+	if header.ProtoMessage == "" {
+		return erero.Errorf("%s:%d: missing # proto-message: header", path, header.Line)
+	}
+	if filepath.Ext(header.ProtoFile) != ".proto" {
+		return erero.Errorf("%s:%d: proto-file %s is not a .proto file", path, header.Line, header.ProtoFile)
+	}
+	if !qualifiedNamePattern.MatchString(header.ProtoMessage) {
+		return erero.Errorf("%s:%d: proto-message %s is not a qualified message name", path, header.Line, header.ProtoMessage)
+	}
+	if len(check.ProtoPaths) == 0 {
+		return nil
+	}
+	for _, root := range check.ProtoPaths {
+		schema, err := os.ReadFile(filepath.Join(root, header.ProtoFile))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return erero.Wro(err)
+		}
+		names, err := messageNames(schema)
+		if err != nil {
+			return erero.WithMessage(err, header.ProtoFile)
+		}
+		if !slices.Contains(names, strings.TrimPrefix(header.ProtoMessage, ".")) {
+			return erero.Errorf("%s:%d: message %s not declared in %s", path, header.Line, header.ProtoMessage, header.ProtoFile)
+		}
+		return nil
+	}
+	return erero.Errorf("%s:%d: proto-file %s not found in proto paths", path, header.Line, header.ProtoFile)
+}
+
+// messageNames returns the fully-qualified names of the messages declared in the .proto source
+// messageNames 返回 .proto 源码中声明的消息的完全限定名称
+func messageNames(source []byte) ([]string, error) {
+	file, err := protosyntax.Parse(source)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	var prefix string
+	for _, node := range file.Nodes {
+		if node.Kind == protosyntax.StatementNode && node.Tokens[0].Text == "package" {
+			var parts []string
+			for _, token := range node.Tokens[1 : len(node.Tokens)-1] {
+				parts = append(parts, token.Text)
+			}
+			prefix = strings.Join(parts, "") + "."
+		}
+	}
+	var names []string
+	var collect func(nodes []*protosyntax.Node, prefix string)
+	collect = func(nodes []*protosyntax.Node, prefix string) {
+		for _, node := range nodes {
+			if node.Kind == protosyntax.BlockNode && len(node.Tokens) >= 2 && node.Tokens[0].Text == "message" {
+				names = append(names, prefix+node.Tokens[1].Text)
+				collect(node.Body, prefix+node.Tokens[1].Text+".")
+			}
+		}
+	}
+	collect(file.Nodes, prefix)
+	return names, nil
+}
+
+// TextProtoFormatter formats text format files through clang-format's TextProto language
+// Files are passed with an assumed .textproto name, so .txtpb, .pbtxt and .prototxt get the right language
+// Implements clangformat.Formatter so it can be registered as the TextProto language formatter
+//
+// TextProtoFormatter 通过 clang-format 的 TextProto 语言格式化文本格式文件
+// 文件以假定的 .textproto 名称传入，使 .txtpb、.pbtxt 和 .prototxt 获得正确的语言
+// 实现 clangformat.Formatter，可注册为 TextProto 语言的格式化器
+type TextProtoFormatter struct {
+	header  *HeaderCheck
+	options *clangformat.Options
+}
+
+// NewTextProtoFormatter creates a TextProtoFormatter without header validation
+//
+// NewTextProtoFormatter 创建不校验头部的 TextProtoFormatter
+func NewTextProtoFormatter() *TextProtoFormatter {
+	return &TextProtoFormatter{options: clangformat.NewOptions()}
+}
+
+// WithOptions sets the clangformat.Options running clang-format and writing the files, and returns the updated TextProtoFormatter
+//
+// WithOptions 设置运行 clang-format 和写入文件的 clangformat.Options 并返回更新后的 TextProtoFormatter
+func (f *TextProtoFormatter) WithOptions(options *clangformat.Options) *TextProtoFormatter {
+	f.options = options
+	return f
+}
+
+// WithHeaderCheck enables the header validation and returns the updated TextProtoFormatter
+// Files failing the check are rejected with an error and left untouched, nil disables the validation
+//
+// WithHeaderCheck 启用头部校验并返回更新后的 TextProtoFormatter
+// 校验失败的文件返回错误且保持不变，nil 表示禁用校验
+func (f *TextProtoFormatter) WithHeaderCheck(check *HeaderCheck) *TextProtoFormatter {
+	f.header = check
+	return f
+}
+
+// DryRun returns the formatted content of the text format file without modifying it
+//
+// DryRun 返回文本格式文件格式化后的内容，不修改文件
+func (f *TextProtoFormatter) DryRun(config *osexec.ExecConfig, path string, style *clangformat.Style) (output []byte, err error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return f.DryRunSource(config, source, path, style)
+}
+
+// DryRunSource formats in-memory text format content, path tells clang-format where to search .clang-format files
+// The content is validated with the header check and passed with the assumed .textproto name
+//
+// DryRunSource 格式化内存中的文本格式内容，path 告诉 clang-format 查找 .clang-format 文件的位置
+// 内容经过头部校验，并以假定的 .textproto 名称传入
+func (f *TextProtoFormatter) DryRunSource(config *osexec.ExecConfig, source []byte, path string, style *clangformat.Style) (output []byte, err error) {
+	if f.header != nil {
+		if err := CheckTextProtoHeader(path, source, f.header); err != nil {
+			return nil, err
+		}
+	}
+	return f.options.DryRunSource(config, source, path+".textproto", style)
+}
+
+// Format formats the text format file in place, writing only when the content changes
+//
+// Format 就地格式化文本格式文件，仅在内容变化时写入
+func (f *TextProtoFormatter) Format(config *osexec.ExecConfig, path string, style *clangformat.Style) (output []byte, err error) {
+	if err := f.checkHeader(path); err != nil {
+		return nil, err
+	}
+	return f.options.FormatAs(config, path, ".textproto", style)
+}
+
+// FormatProject formats the text format files with the extension in the project
+// Logs each file and shows SUCCESS upon completion
+//
+// FormatProject 格式化项目中带有该扩展名的文本格式文件
+// 记录每个文件的日志，完成时显示 SUCCESS
+func (f *TextProtoFormatter) FormatProject(config *osexec.ExecConfig, projectPath string, extension string, style *clangformat.Style) error {
+	if err := utils.WalkFilesWithExt(projectPath, extension, func(path string, info os.FileInfo) error {
+		zaplog.LOG.Debug("textproto-format", zap.String("path", path))
+		osmustexist.MustFile(path)
+
+		if _, err := f.Format(config, path, style); err != nil {
+			return erero.Wro(err)
+		}
+		return nil
+	}); err != nil {
+		return erero.Wro(err)
+	}
+	eroticgo.GREEN.ShowMessage("SUCCESS")
+	return nil
+}
+
+// NewLanguage creates the TextProto language bound to this TextProtoFormatter
+//
+// NewLanguage 创建绑定到该 TextProtoFormatter 的 TextProto 语言
+func (f *TextProtoFormatter) NewLanguage() *clangformat.Language {
+	return &clangformat.Language{
+		Name:       "TextProto",
+		Extensions: []string{".textproto", ".textpb", ".txtpb", ".pbtxt", ".prototxt", ".asciipb"},
+		NewStyle:   NewTextProtoStyle,
+		Formatter:  f,
+	}
+}
+
+// checkHeader validates the file header when the check is enabled
+// checkHeader 在启用校验时校验文件头部
+func (f *TextProtoFormatter) checkHeader(path string) error {
+	if f.header == nil {
+		return nil
+	}
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	return CheckTextProtoHeader(path, source, f.header)
+}
@@ -0,0 +1,95 @@
+package protoformat_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/protoformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+func TestParseTextProtoHeader(t *testing.T) {
+	source := "# Copyright notice\n\n# proto-file: demo/config.proto\n# proto-message: demo.Config\n# proto-import: demo/extra.proto\n\nname: \"x\"\n# proto-file: ignored.proto\n"
+	header := protoformat.ParseTextProtoHeader([]byte(source))
+	require.Equal(t, "demo/config.proto", header.ProtoFile)
+	require.Equal(t, "demo.Config", header.ProtoMessage)
+	require.Equal(t, []string{"demo/extra.proto"}, header.ProtoImports)
+	require.Equal(t, 3, header.Line)
+
+	require.Equal(t, 0, protoformat.ParseTextProtoHeader([]byte("name: \"x\"\n")).Line)
+}
+
+func TestCheckTextProtoHeader(t *testing.T) {
+	tempDIR := rese.V1(os.MkdirTemp("", "textproto-header-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	must.Done(os.MkdirAll(filepath.Join(tempDIR, "demo"), 0755))
+	must.Done(os.WriteFile(filepath.Join(tempDIR, "demo/config.proto"), []byte("syntax = \"proto3\";\npackage demo.v1;\nmessage Config {\n  message Server {}\n}\n"), 0644))
+
+	check := protoformat.NewHeaderCheck()
+	require.NoError(t, protoformat.CheckTextProtoHeader("a.txtpb", []byte("name: \"x\"\n"), check))
+	require.NoError(t, protoformat.CheckTextProtoHeader("a.txtpb", []byte("# proto-file: demo/config.proto\n# proto-message: demo.v1.Config\n"), check))
+
+	for source, message := range map[string]string{
+		"# proto-message: demo.v1.Config\n":                                "missing # proto-file:",
+		"# proto-file: demo/config.proto\n":                                "missing # proto-message:",
+		"# proto-file: demo/config.txt\n# proto-message: demo.v1.Config\n": "not a .proto file",
+		"# proto-file: demo/config.proto\n# proto-message: demo..Config\n": "not a qualified message name",
+	} {
+		err := protoformat.CheckTextProtoHeader("a.txtpb", []byte(source), check)
+		require.Error(t, err)
+		require.True(t, strings.Contains(err.Error(), message), err.Error())
+	}
+
+	check = &protoformat.HeaderCheck{Required: true, ProtoPaths: []string{filepath.Join(tempDIR, "missing"), tempDIR}}
+	require.Error(t, protoformat.CheckTextProtoHeader("a.txtpb", []byte("name: \"x\"\n"), check))
+	require.NoError(t, protoformat.CheckTextProtoHeader("a.txtpb", []byte("# proto-file: demo/config.proto\n# proto-message: demo.v1.Config.Server\n"), check))
+	require.Error(t, protoformat.CheckTextProtoHeader("a.txtpb", []byte("# proto-file: demo/config.proto\n# proto-message: demo.v1.Missing\n"), check))
+	require.Error(t, protoformat.CheckTextProtoHeader("a.txtpb", []byte("# proto-file: demo/other.proto\n# proto-message: demo.v1.Config\n"), check))
+}
+
+func TestTextProtoFormatterHeaderCheck(t *testing.T) {
+	tempDIR := rese.V1(os.MkdirTemp("", "textproto-format-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	path := filepath.Join(tempDIR, "config.pbtxt")
+	must.Done(os.WriteFile(path, []byte("# proto-file: config.proto\nname:   \"x\"\n"), 0644))
+
+	// the header check fails before clang-format runs, leaving the file untouched
+	// 头部校验在 clang-format 运行之前失败，文件保持不变
+	formatter := protoformat.NewTextProtoFormatter().WithHeaderCheck(protoformat.NewHeaderCheck())
+	_, err := formatter.Format(nil, path, protoformat.NewTextProtoStyle())
+	require.Error(t, err)
+	require.Equal(t, "# proto-file: config.proto\nname:   \"x\"\n", string(rese.V1(os.ReadFile(path))))
+
+	language := formatter.NewLanguage()
+	require.Equal(t, "TextProto", language.Name)
+	require.Contains(t, language.Extensions, ".pbtxt")
+}
+
+func TestTextProtoFormatterDryRunSource(t *testing.T) {
+	fake := clangformat.NewFakeExecutor()
+	formatter := protoformat.NewTextProtoFormatter().WithOptions(clangformat.NewOptions().WithExecutor(fake))
+	language := formatter.NewLanguage()
+
+	// in-memory buffers go through the TextProto language, not the language of the real extension
+	// 内存中的内容按 TextProto 语言格式化，而非真实扩展名对应的语言
+	source := []byte("name:   \"x\"\n")
+	output := rese.V1(language.DryRunSource(nil, source, "/project/config.pbtxt", protoformat.NewTextProtoStyle()))
+	require.Equal(t, string(source), string(output))
+	calls := fake.Calls()
+	require.Len(t, calls, 1)
+	require.Contains(t, calls[0].Args, "/project/config.pbtxt.textproto")
+
+	// the header check runs on the in-memory content before clang-format
+	// 头部校验在 clang-format 之前作用于内存中的内容
+	formatter.WithHeaderCheck(protoformat.NewHeaderCheck())
+	_, err := language.DryRunSource(nil, []byte("# proto-file: config.proto\n"), "/project/config.pbtxt", protoformat.NewTextProtoStyle())
+	require.Error(t, err)
+	require.Len(t, fake.Calls(), 1)
+}
@@ -0,0 +1,49 @@
+package protoformat
+
+import (
+	"fmt"
+
+	"github.com/go-xlan/clang-format/internal/protosyntax"
+	"github.com/yyle88/erero"
+)
+
+// Divergence is the error returned when formatting changes the .proto content beyond whitespace
+// Reports the first differing token on both sides with their line numbers
+//
+// Divergence 是格式化改变了 .proto 内容（不仅是空白）时返回的错误
+// 报告两侧第一个不同的词法单元及其行号
+type Divergence struct {
+	Path          string // File path // 文件路径
+	OriginalLine  int    // Line in the original content, 0 when the content ended // 原始内容中的行号，内容结束时为 0
+	FormattedLine int    // Line in the formatted content, 0 when the content ended // 格式化内容中的行号，内容结束时为 0
+	Original      string // Original token // 原始词法单元
+	Formatted     string // Formatted token // 格式化后的词法单元
+}
+
+func (d *Divergence) Error() string {
+	return fmt.Sprintf("%s: formatting changed tokens: original line %d %q, formatted line %d %q", d.Path, d.OriginalLine, d.Original, d.FormattedLine, d.Formatted)
+}
+
+// Verify checks that the formatted content has the same token stream as the original, ignoring whitespace
+// Strings, identifiers, numbers and comments must match, comment whitespace is collapsed before comparing
+// Returns *Divergence on the first mismatch
+//
+// Verify 检查格式化内容与原始内容的词法单元流是否相同，忽略空白
+// 字符串、标识符、数字和注释必须一致，注释中的空白在比较前会被合并
+// 第一处不一致时返回 *Divergence
+func Verify(path string, original []byte, formatted []byte) error {
+	divergence, err := protosyntax.Compare(original, formatted)
+	if err != nil {
+		return erero.Wro(err)
+	}
+	if divergence != nil {
+		return &Divergence{
+			Path:          path,
+			OriginalLine:  divergence.OriginalLine,
+			FormattedLine: divergence.FormattedLine,
+			Original:      divergence.Original,
+			Formatted:     divergence.Formatted,
+		}
+	}
+	return nil
+}
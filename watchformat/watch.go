@@ -0,0 +1,247 @@
+// Package watchformat: Format-on-save engine watching project DIRs through filesystem notifications
+// Collects change events, waits until they settle, then formats the changed files through the registry
+// Visits the same files as FormatProject: matching extensions, registered languages and ProjectFilter excludes
+// Remembers the content it leaves behind, so its own writes never trigger another round
+//
+// watchformat: 通过文件系统通知监听项目目录的保存即格式化引擎
+// 收集变更事件，待其平息后通过注册表格式化发生变化的文件
+// 与 FormatProject 访问相同的文件：匹配的扩展名、已注册的语言以及 ProjectFilter 的排除项
+// 记住其写入后的内容，使自身的写入不会触发新一轮格式化
+package watchformat
+
+import (
+	"context"
+	"crypto/sha256"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/internal/utils"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/osexec"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+)
+
+// Report describes one file the Watcher ran its formatter on
+//
+// Report 描述 Watcher 对其运行了格式化器的一个文件
+type Report struct {
+	Path    string // File path // 文件路径
+	Changed bool   // Whether formatting changed the content // 格式化是否改变了内容
+	Err     error  // Formatting error, the file is left as it was // 格式化错误，文件保持原样
+}
+
+// Watcher formats files of the watched DIRs as they change
+//
+// Watcher 在被监听目录中的文件发生变化时格式化它们
+type Watcher struct {
+	config     *osexec.ExecConfig
+	registry   *clangformat.Registry
+	extensions []string
+	debounce   time.Duration
+	report     func(report *Report)
+	roots      []string
+	settled    map[string][sha256.Size]byte
+}
+
+// NewWatcher creates a Watcher formatting the registered extensions, events settle for 200ms before formatting
+//
+// NewWatcher 创建格式化已注册扩展名的 Watcher，事件平息 200ms 后开始格式化
+func NewWatcher(config *osexec.ExecConfig, registry *clangformat.Registry) *Watcher {
+	return &Watcher{
+		config:     config,
+		registry:   registry,
+		extensions: registry.Extensions(),
+		debounce:   200 * time.Millisecond,
+		report:     func(report *Report) {},
+		settled:    map[string][sha256.Size]byte{},
+	}
+}
+
+// WithExtensions limits the formatted files to the extensions and returns the updated Watcher
+//
+// WithExtensions 将格式化的文件限制为这些扩展名并返回更新后的 Watcher
+func (w *Watcher) WithExtensions(extensions []string) *Watcher {
+	w.extensions = extensions
+	return w
+}
+
+// WithDebounce sets how long events must settle before the changed files are formatted and returns the updated Watcher
+// Editors saving through temp files and renames emit several events per save, they are formatted once
+//
+// WithDebounce 设置事件需要平息多久才格式化发生变化的文件，并返回更新后的 Watcher
+// 通过临时文件和重命名保存的编辑器每次保存会产生多个事件，这些事件只触发一次格式化
+func (w *Watcher) WithDebounce(debounce time.Duration) *Watcher {
+	w.debounce = debounce
+	return w
+}
+
+// WithReport sets the function receiving a Report per formatted file and returns the updated Watcher
+//
+// WithReport 设置接收每个已格式化文件 Report 的函数并返回更新后的 Watcher
+func (w *Watcher) WithReport(report func(report *Report)) *Watcher {
+	w.report = report
+	return w
+}
+
+// Run watches the DIRs and their sub DIRs, including ones created later, until the context is done
+// Existing files are not formatted at start, run FormatProject first to begin from a formatted tree
+//
+// Run 监听这些目录及其子目录（包括之后创建的目录），直到 context 结束
+// 启动时不会格式化已有文件，需要从已格式化的目录树开始时先运行 FormatProject
+func (w *Watcher) Run(ctx context.Context, roots ...string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return erero.Wro(err)
+	}
+	defer func() { _ = watcher.Close() }()
+
+	for _, root := range roots {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			return erero.Wro(err)
+		}
+		w.roots = append(w.roots, root)
+		if _, err := w.addTree(watcher, root); err != nil {
+			return erero.Wro(err)
+		}
+	}
+
+	timer := time.NewTimer(w.debounce)
+	timer.Stop()
+	pending := map[string]bool{}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				// the content left by the previous round is of no use once the file is gone
+				// 文件消失后，上一轮留下的内容不再有用
+				delete(w.settled, event.Name)
+			}
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+				// files copied or checked out together with a new DIR come without events of their own
+				// 随新目录一起复制或检出的文件没有自己的事件
+				paths, err := w.addTree(watcher, event.Name)
+				if err != nil {
+					zaplog.LOG.Warn("watch", zap.String("path", event.Name), zap.Error(err))
+				}
+				for _, path := range paths {
+					pending[path] = true
+				}
+			} else {
+				pending[event.Name] = true
+			}
+			timer.Reset(w.debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			zaplog.LOG.Warn("watch", zap.Error(err))
+		case <-timer.C:
+			paths := make([]string, 0, len(pending))
+			for path := range pending {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			clear(pending)
+			for _, path := range paths {
+				w.formatFile(path)
+			}
+		}
+	}
+}
+
+// addTree watches the DIR and its sub DIRs, returns the files found inside
+// Version control DIRs are skipped unless they are watched roots, as FormatProject skips them
+//
+// addTree 监听该目录及其子目录，返回其中找到的文件
+// 与 FormatProject 一致，版本控制目录除非是被监听的根目录，否则会被跳过
+func (w *Watcher) addTree(watcher *fsnotify.Watcher, root string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			paths = append(paths, path)
+			return nil
+		}
+		if slices.Contains(utils.VcsDIRs, entry.Name()) && !slices.Contains(w.roots, path) {
+			return filepath.SkipDir
+		}
+		zaplog.LOG.Debug("watch", zap.String("dir", path))
+		return watcher.Add(path)
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return paths, nil
+}
+
+// formatFile formats the changed file when FormatProject of its root would visit it
+// Files whose content is the one left by the previous round are skipped, those events come from its own writes
+//
+// formatFile 当所在根目录的 FormatProject 会访问该文件时格式化它
+// 内容与上一轮留下的内容相同的文件会被跳过，这些事件来自自身的写入
+func (w *Watcher) formatFile(path string) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		delete(w.settled, path)
+		return // removed or renamed away before the events settled // 事件平息前已被删除或重命名
+	}
+	if !utils.MatchExt(path, w.extensions) {
+		return
+	}
+	language, ok := w.registry.Lookup(filepath.Ext(path))
+	if !ok {
+		return
+	}
+	if filter, ok := language.Formatter.(clangformat.ProjectFilter); ok {
+		idx := slices.IndexFunc(w.roots, func(root string) bool { return root == path || utils.IsSubPath(root, path) })
+		if idx < 0 {
+			return
+		}
+		inProject, err := filter.InProject(w.roots[idx], path)
+		if err != nil {
+			w.report(&Report{Path: path, Err: erero.Wro(err)})
+			return
+		}
+		if !inProject {
+			return
+		}
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if settled, ok := w.settled[path]; ok && settled == sha256.Sum256(source) {
+		zaplog.LOG.Debug("watch", zap.String("path", path), zap.String("skip", "settled"))
+		return
+	}
+	if _, err := language.Formatter.Format(w.config, path, language.NewStyle()); err != nil {
+		w.report(&Report{Path: path, Err: erero.Wro(err)})
+		return
+	}
+	output, err := os.ReadFile(path)
+	if err != nil {
+		w.report(&Report{Path: path, Err: erero.Wro(err)})
+		return
+	}
+	w.settled[path] = sha256.Sum256(output)
+	w.report(&Report{Path: path, Changed: string(output) != string(source)})
+}
@@ -0,0 +1,101 @@
+package watchformat_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-xlan/clang-format/clangformat"
+	"github.com/go-xlan/clang-format/protoformat"
+	"github.com/go-xlan/clang-format/watchformat"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+)
+
+func TestWatcher(t *testing.T) {
+	// 创建临时目录用于测试
+	tempDIR := rese.V1(os.MkdirTemp("", "watch-format-test-*"))
+	defer func() { must.Done(os.RemoveAll(tempDIR)) }()
+
+	// buf 模块排除 vendor 目录，与 FormatProject 保持一致
+	must.Done(os.WriteFile(filepath.Join(tempDIR, "buf.yaml"), []byte("version: v1\nbuild:\n  excludes:\n    - vendor\n"), 0644))
+	must.Done(os.Mkdir(filepath.Join(tempDIR, "vendor"), 0755))
+
+	// 版本控制目录与 FormatProject 一样被跳过
+	must.Done(os.Mkdir(filepath.Join(tempDIR, ".git"), 0755))
+	vcs := filepath.Join(tempDIR, ".git", "demo.proto")
+	must.Done(os.WriteFile(vcs, []byte("message A{int32 a=1;}\n"), 0644))
+
+	// 原生后端不需要 clang-format
+	registry := clangformat.NewRegistry().Register(protoformat.NewFormatter().WithBackend(protoformat.BackendNative).NewLanguage())
+	var mutex sync.Mutex
+	var reports []*watchformat.Report
+	watcher := watchformat.NewWatcher(nil, registry).
+		WithExtensions([]string{".proto"}).
+		WithDebounce(50 * time.Millisecond).
+		WithReport(func(report *watchformat.Report) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			reports = append(reports, report)
+		})
+	countReports := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(reports)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- watcher.Run(ctx, tempDIR) }()
+	defer func() {
+		cancel()
+		must.Done(<-done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// 保存的文件被格式化，排除目录中的文件和其他扩展名的文件保持不变
+	path := filepath.Join(tempDIR, "demo.proto")
+	excluded := filepath.Join(tempDIR, "vendor", "demo.proto")
+	other := filepath.Join(tempDIR, "demo.txt")
+	must.Done(os.WriteFile(excluded, []byte("message A{int32 a=1;}\n"), 0644))
+	must.Done(os.WriteFile(vcs, []byte("message A{int32 a=1;}\n"), 0644))
+	must.Done(os.WriteFile(other, []byte("message A{int32 a=1;}\n"), 0644))
+	must.Done(os.WriteFile(path, []byte("message A{int32 a=1;}\n"), 0644))
+	require.Eventually(t, func() bool { return countReports() == 1 }, 5*time.Second, 20*time.Millisecond)
+	require.Equal(t, "message A {\n  int32 a = 1;\n}\n", string(rese.V1(os.ReadFile(path))))
+	require.Equal(t, "message A{int32 a=1;}\n", string(rese.V1(os.ReadFile(excluded))))
+	require.Equal(t, "message A{int32 a=1;}\n", string(rese.V1(os.ReadFile(other))))
+	require.Equal(t, "message A{int32 a=1;}\n", string(rese.V1(os.ReadFile(vcs))))
+
+	mutex.Lock()
+	require.Equal(t, path, reports[0].Path)
+	require.True(t, reports[0].Changed)
+	require.NoError(t, reports[0].Err)
+	mutex.Unlock()
+
+	// 自身的写入不会触发新一轮格式化
+	time.Sleep(300 * time.Millisecond)
+	require.Equal(t, 1, countReports())
+
+	// 新建目录中的文件同样被格式化
+	must.Done(os.Mkdir(filepath.Join(tempDIR, "sub"), 0755))
+	time.Sleep(100 * time.Millisecond)
+	nested := filepath.Join(tempDIR, "sub", "nested.proto")
+	must.Done(os.WriteFile(nested, []byte("message B{}\n"), 0644))
+	require.Eventually(t, func() bool { return countReports() == 2 }, 5*time.Second, 20*time.Millisecond)
+	require.Equal(t, "message B {}\n", string(rese.V1(os.ReadFile(nested))))
+
+	// 删除后的文件不再被记住，以相同内容重建时会再次运行格式化
+	must.Done(os.Remove(path))
+	time.Sleep(100 * time.Millisecond)
+	must.Done(os.WriteFile(path, []byte("message A {\n  int32 a = 1;\n}\n"), 0644))
+	require.Eventually(t, func() bool { return countReports() == 3 }, 5*time.Second, 20*time.Millisecond)
+	mutex.Lock()
+	require.Equal(t, path, reports[2].Path)
+	require.False(t, reports[2].Changed)
+	mutex.Unlock()
+}